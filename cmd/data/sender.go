@@ -28,7 +28,7 @@ func main() {
 	//	"2026-02-03\r\n10:20:05\r\n002\r\n\r\nGLU\t*250 mg/dL\r\nBIL\t*+\r\nSG\t1.030\r\nPH\t*8.5\r\nKET\t*+++\r\nBLD\t*+\r\nPRO\t*150 mg/dL\r\nURO\tNormal\r\nNIT\tNegative\r\nLEU\t*++\r\n",
 	//	"2026-02-03\r\n10:25:40\r\n003\r\n\r\nGLU\tNormal\r\nBIL\tNegative\r\nSG\t*1.005\r\nPH\t5.0\r\nKET\tNegative\r\nBLD\tTrace\r\nPRO\t*80 mg/dL\r\nURO\t*4 mg/dL\r\nNIT\tNegative\r\nLEU\t+\r\n",
 	//}
-	BasicNormalFrameHex := "AA052001000000000000001010002955"
+	BasicNormalFrameHex := "AA05200100000000000000001010004655"
 	frameData, err := hex.DecodeString(BasicNormalFrameHex)
 	// 发送测试数据
 	n, err := port.Write(frameData)
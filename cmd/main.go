@@ -1,20 +1,27 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"opm-mqtt-gateway/internal/config"
+	"opm-mqtt-gateway/internal/logutil"
 	"opm-mqtt-gateway/internal/models"
+	"opm-mqtt-gateway/internal/monitor"
 	"opm-mqtt-gateway/internal/mqtt"
 	"opm-mqtt-gateway/internal/parser"
 	"opm-mqtt-gateway/internal/serial"
+	"opm-mqtt-gateway/internal/sink"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 )
 
-// initLog 初始化日志（分级+文件输出，生产级必备，贴合配置）
-func initLog(cfg *config.Config) {
+// initLog 初始化日志（分级+文件输出，生产级必备，贴合配置）；开启日志合并时返回合并输出（退出前需Flush）
+func initLog(cfg *config.Config) *logutil.CoalesceWriter {
 	// 创建日志目录（不存在则自动创建）
 	logDir := filepath.Dir(cfg.Log.Path)
 	if err := os.MkdirAll(logDir, 0755); err != nil {
@@ -27,84 +34,540 @@ func initLog(cfg *config.Config) {
 		log.Fatalf("[FATAL] 打开日志文件失败：%v", err)
 	}
 
-	// 配置日志：时间+级别+文件+标准输出双写
-	log.SetOutput(logFile)
+	// 配置日志：时间+级别+文件+标准输出双写（纯文本模式去除emoji等装饰符号；合并窗口内连续相同日志）
+	var out io.Writer = logFile
+	if cfg.Log.PlainText {
+		out = logutil.NewPlainWriter(out)
+	}
+	var coalesce *logutil.CoalesceWriter
+	if cfg.Log.CoalesceWindowSec > 0 {
+		coalesce = logutil.NewCoalesceWriter(out, time.Duration(cfg.Log.CoalesceWindowSec)*time.Second)
+		out = coalesce
+	}
+	log.SetOutput(out)
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	return coalesce
 }
 
-func main() {
-	// 1. 加载配置文件（核心：硬件参数校验+默认值）
-	configPath := "configs/config.yaml"
-	if err := config.Load(configPath); err != nil {
-		log.Fatalf("[FATAL] 加载配置失败：%v", err)
+// healthWriteInterval 运行状态文件写入周期；状态文件超过3个周期未更新，-check 判定网关未运行
+const healthWriteInterval = 10 * time.Second
+
+// writeHealth 写入运行状态文件（供 -check 读取；多设备模式串口/MQTT取最严重状态，最近样本取各设备最新）
+func writeHealth(path string, pipelines []*pipeline) {
+	st := monitor.HealthState{UpdatedAt: time.Now(), Serial: models.DeviceStateOnline, MQTT: models.DeviceStateOnline}
+	counted := make(map[*mqtt.Client]bool, len(pipelines))
+	for _, p := range pipelines {
+		if !counted[p.link.client] { // shared模式多台设备共用一条连接（一个暂存队列）
+			counted[p.link.client] = true
+			st.SpoolPending += p.link.client.SpoolPending()
+			st.SpoolEvicted += p.link.client.SpoolEvicted()
+		}
+		mqttState := models.ConnState(p.link.client.IsConnected())
+		if p.link.client.LocalOnly() {
+			mqttState = models.DeviceStateLocalOnly
+		}
+		st.Serial = worseState(st.Serial, p.source.HealthState())
+		st.MQTT = worseState(st.MQTT, mqttState)
+		if last := p.gapMon.LastSample(); last.After(st.LastSampleAt) {
+			st.LastSampleAt = last
+		}
 	}
-	cfg := config.GlobalConfig
+	if err := monitor.WriteHealthState(path, st); err != nil {
+		log.Printf("[WARN] [main] 写入运行状态文件失败：%v", err)
+	}
+}
 
-	// 2. 初始化日志（生产级分级日志）
-	initLog(cfg)
+// worseState 两个健康状态中较严重者（online < error < offline/local_only）
+func worseState(a, b string) string {
+	rank := func(s string) int {
+		switch s {
+		case models.DeviceStateOnline:
+			return 0
+		case models.DeviceStateError:
+			return 1
+		default:
+			return 2
+		}
+	}
+	if rank(b) > rank(a) {
+		return b
+	}
+	return a
+}
+
+// runCheck 读取运行状态文件，输出Nagios/NRPE格式检查结果并返回退出码（未配置app.state_file时为UNKNOWN）
+func runCheck(cfg *config.Config) int {
+	if cfg.App.StateFile == "" {
+		fmt.Println("UNKNOWN: app.state_file not configured, gateway does not write a state file")
+		return monitor.CheckUnknown
+	}
+	st, err := monitor.ReadHealthState(cfg.App.StateFile)
+	line, code := monitor.NagiosCheck(st, err, time.Now(), 3*healthWriteInterval,
+		time.Duration(cfg.App.CheckSampleAgeSec)*time.Second)
+	fmt.Println(line)
+	return code
+}
 
-	// 3. 初始化有效帧通道（缓冲区100，适配设备检测频率）
-	frameChan := make(chan []byte, 100)
+// summaryCheckInterval 每日汇总时间检查周期
+const summaryCheckInterval = 30 * time.Second
 
-	// 4. 初始化核心模块（串口/MQTT/解析器，贴合硬件特性）
-	serialReader, err := serial.NewReader(frameChan)
+// watchDailySummary 每日汇总协程：到达汇总时间后发布当日统计到 前缀/device_id/summary，发布失败时保留汇总下次检查重试
+// serialQ/mqttQ非nil时附带连接质量
+func watchDailySummary(summary *monitor.DailySummary, serialQ, mqttQ *monitor.LinkQuality, mqttClient *mqtt.Client, cfg *config.Config, stop <-chan struct{}) {
+	ticker := time.NewTicker(summaryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		content, due := summary.Due()
+		if !due {
+			continue
+		}
+		if serialQ != nil && content.Serial == nil { // 重试时保留首次输出时的连接质量
+			content.Serial, content.MQTT = serialQ.Stats(), mqttQ.Stats()
+		}
+		log.Printf("[INFO] [main] 设备[%s]发布每日汇总：样本%d，异常%d，无效%d，离线%d秒",
+			cfg.Device.DeviceID, content.Samples, content.Abnormal, content.Invalid, content.DowntimeSec)
+		msg := models.NewMQTTMessage(cfg.Device.DeviceID, cfg.Device.Model, models.MQTTMsgTypeSummary, content)
+		if err := mqttClient.Publish(msg); err != nil {
+			log.Printf("[ERROR] [main] 发布每日汇总失败：%v，%v后重试", err, summaryCheckInterval)
+			continue
+		}
+		summary.Published()
+	}
+}
+
+// gapCheckInterval 样本中断检查周期
+const gapCheckInterval = 10 * time.Second
+
+// watchSampleGap 样本中断监测协程：工作时段内超过预期间隔无样本，上报state告警（sample_gap）
+func watchSampleGap(gapMon *monitor.GapMonitor, mqttClient *mqtt.Client, cfg *config.Config, stop <-chan struct{}) {
+	ticker := time.NewTicker(gapCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		gap, alert := gapMon.Check()
+		if !alert {
+			continue
+		}
+		log.Printf("[WARN] [main] 设备[%s]工作时段内%v无样本，上报样本中断告警", cfg.Device.DeviceID, gap.Truncate(time.Second))
+		alertMsg := models.NewMQTTMessage(
+			cfg.Device.DeviceID,
+			cfg.Device.Model,
+			models.MQTTMsgTypeState,
+			models.DeviceStateAlert{
+				State:  models.DeviceStateError,
+				Reason: models.StateReasonSampleGap,
+				GapSec: int64(gap / time.Second),
+			},
+		)
+		if err := mqttClient.Publish(alertMsg); err != nil {
+			log.Printf("[ERROR] [main] 上报样本中断告警失败：%v", err)
+		}
+	}
+}
+
+// watchSerialSilence 串口静默看门狗：串口健康状态转为error（在线但长时间无数据）时上报设备异常，恢复时记录日志
+func watchSerialSilence(serialReader serial.Source, mqttClient *mqtt.Client, cfg *config.Config, stop <-chan struct{}) {
+	ticker := time.NewTicker(gapCheckInterval)
+	defer ticker.Stop()
+	prev := models.DeviceStateOnline
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		state := serialReader.HealthState()
+		if state == prev {
+			continue
+		}
+		if prev == models.DeviceStateError {
+			log.Printf("[INFO] [main] 设备[%s]串口恢复收到数据，设备异常解除", cfg.Device.DeviceID)
+		}
+		prev = state
+		if state != models.DeviceStateError {
+			continue
+		}
+		log.Printf("[WARN] [main] 设备[%s]串口超过%d秒无数据，上报设备异常", cfg.Device.DeviceID, cfg.Serial.SilenceTimeoutS)
+		alertMsg := models.NewMQTTMessage(
+			cfg.Device.DeviceID,
+			cfg.Device.Model,
+			models.MQTTMsgTypeState,
+			models.DeviceStateAlert{
+				State:  models.DeviceStateError,
+				Reason: models.StateReasonSilence,
+				GapSec: int64(cfg.Serial.SilenceTimeoutS),
+			},
+		)
+		if err := mqttClient.Publish(alertMsg); err != nil {
+			log.Printf("[ERROR] [main] 上报串口静默告警失败：%v", err)
+		}
+	}
+}
+
+// mqttLink MQTT连接及其连接质量统计（per_device模式每台设备一个，shared模式所有设备共用）
+type mqttLink struct {
+	client  *mqtt.Client
+	quality *monitor.LinkQuality // 未配置app.link_quality_window_hours时为nil
+}
+
+// newMQTTLink 新建MQTT连接（连接状态变化记录日志并计入连接质量）
+func newMQTTLink(cfg *config.Config) (*mqttLink, error) {
+	client, err := mqtt.NewClientFor(cfg)
 	if err != nil {
-		log.Fatalf("[FATAL] 初始化串口失败：%v", err)
+		return nil, err
+	}
+	l := &mqttLink{client: client}
+	if cfg.App.LinkQualityWindowHours > 0 {
+		l.quality = monitor.NewLinkQuality(time.Duration(cfg.App.LinkQualityWindowHours)*time.Hour, client.IsConnected())
+	}
+	client.OnStateChange(func(old, new, reason string) {
+		logStateChange("mqtt", old, new, reason)
+		if l.quality != nil {
+			l.quality.SetUp(new == models.DeviceStateOnline)
+		}
+	})
+	return l, nil
+}
+
+// logStateChange 连接状态变化回调（串口/MQTT连通性告警的统一接入点，可在此转发Webhook/脚本）
+func logStateChange(who, old, new, reason string) {
+	log.Printf("[WARN] [main] [%s]连接状态变化：%s → %s，原因：%s", who, old, new, reason)
+}
+
+// publisher 处理链路发布检测结果所需的MQTT能力（*mqtt.Client实现，测试可替换）
+type publisher interface {
+	IsConnected() bool
+	LocalOnly() bool
+	Spooling() bool
+	Publish(mqttMsg *models.MQTTMessage) error
+}
+
+// pipeline 单台设备的处理链路（串口帧→解析→MQTT发布），多设备模式每台一条，独立启停
+type pipeline struct {
+	cfg        *config.Config
+	source     serial.Source
+	link       *mqttLink
+	pub        publisher // 检测结果发布（即link.client）
+	frameChan  chan models.Frame
+	opmParser  parser.ModelParser
+	quarantine *sink.Quarantine
+	retrigger  *parser.RetriggerFilter
+	gapMon     *monitor.GapMonitor
+	summary    *monitor.DailySummary // 未配置app.daily_summary_at时为nil
+	serialQ    *monitor.LinkQuality  // 未配置app.link_quality_window_hours时为nil
+	stats      monitor.PipelineStats
+	stop       chan struct{} // 关闭后监测/心跳协程退出
+	forwarded  chan struct{} // 帧转发协程退出（frameChan已关闭且全部提交）
+}
+
+// newPipeline 按设备配置初始化处理链路（串口/解析器/监测模块），不启动协程
+func newPipeline(cfg *config.Config, link *mqttLink, quarantine *sink.Quarantine) (*pipeline, error) {
+	p := &pipeline{
+		cfg:        cfg,
+		link:       link,
+		pub:        link.client,
+		frameChan:  make(chan models.Frame, 100), // 缓冲区100，适配设备检测频率
+		quarantine: quarantine,
+		stop:       make(chan struct{}),
+		forwarded:  make(chan struct{}),
+	}
+	var err error
+	if p.source, err = serial.NewSourceFor(cfg, p.frameChan); err != nil {
+		return nil, fmt.Errorf("初始化串口失败：%w", err)
+	}
+	// 按设备型号从解析器注册表选择协议实现
+	if p.opmParser, err = parser.NewForConfig(cfg); err != nil {
+		return nil, fmt.Errorf("初始化解析器失败：%w", err)
+	}
+	log.Printf("[INFO] [main] 设备[%s]解析器：型号%s，模式%s", cfg.Device.DeviceID, cfg.Device.Model, p.opmParser.Mode())
+	if path := cfg.Parser.DecodeTableFile; path != "" {
+		binParser, ok := p.opmParser.(*parser.Parser)
+		if !ok {
+			return nil, fmt.Errorf("型号%s的解析器不支持外部解码码表", cfg.Device.Model)
+		}
+		table, err := parser.LoadDecodeTable(path)
+		if err != nil {
+			return nil, fmt.Errorf("加载解码码表失败：%w", err)
+		}
+		binParser.SetDecodeTable(table)
+		log.Printf("[INFO] 已加载外部解码码表：%s", path)
+	}
+
+	// 连接质量统计（配置app.link_quality_window_hours后生效）
+	if cfg.App.LinkQualityWindowHours > 0 {
+		p.serialQ = monitor.NewLinkQuality(time.Duration(cfg.App.LinkQualityWindowHours)*time.Hour, p.source.IsConnected())
+	}
+
+	// 每日汇总（配置app.daily_summary_at后生效，串口离线计入停机时长）
+	if cfg.App.DailySummaryAt != "" {
+		atMin, _ := config.ParseClock(cfg.App.DailySummaryAt) // Load时已校验
+		loc := time.Local
+		if cfg.App.Timezone != "" {
+			loc, _ = time.LoadLocation(cfg.App.Timezone) // Load时已校验
+		}
+		p.summary = monitor.NewDailySummary(atMin, loc)
 	}
-	mqttClient, err := mqtt.NewClient()
+	p.source.OnStateChange(func(old, new, reason string) {
+		logStateChange(cfg.Device.DeviceID, old, new, reason)
+		if p.summary != nil {
+			p.summary.SetOnline(new == models.DeviceStateOnline)
+		}
+		if p.serialQ != nil {
+			p.serialQ.SetUp(new == models.DeviceStateOnline)
+		}
+	})
+	p.retrigger = parser.NewRetriggerFilter(time.Duration(cfg.App.MinSampleIntervalMs) * time.Millisecond)
+	activeStart, activeEnd, _ := config.ParseActiveHours(cfg.App.ActiveHours) // Load时已校验
+	p.gapMon = monitor.NewGapMonitor(time.Duration(cfg.App.ExpectedGapSec)*time.Second, activeStart, activeEnd)
+	return p, nil
+}
+
+// handleFrame 处理单帧：解析→去重→MQTT发布（解析协程池中执行）
+// 解析/隔离/计数先于MQTT状态判断，MQTT断开期间的帧同样进入解析统计与隔离文件
+func (p *pipeline) handleFrame(f models.Frame) {
+	cfg, frame := p.cfg, f.Raw
+	p.gapMon.Sample()
+	p.stats.Frames.Add(1)
+
+	// 解析串口帧为检测数据
+	deviceData, err := p.opmParser.ParseFrame(f)
 	if err != nil {
-		log.Fatalf("[FATAL] 初始化MQTT失败：%v", err)
+		log.Printf("[ERROR] [main] 设备[%s]解析帧失败：%v，帧：%s", cfg.Device.DeviceID, err, models.HexStr(frame))
+		p.stats.ParseErrors.Add(1)
+		if p.quarantine != nil {
+			if qerr := p.quarantine.Write(frame, parser.ErrorKind(err), err); qerr != nil {
+				log.Printf("[ERROR] [main] 写入隔离文件失败：%v", qerr)
+			}
+		}
+		return
+	}
+
+	// 容错1：同一样本重复触发（窗口内检测值一致），丢弃后一帧
+	if !p.retrigger.Allow(deviceData) {
+		log.Printf("[WARN] [main] 重复触发，丢弃结果（累计%d次），帧：%s", p.retrigger.Dropped(), models.HexStr(frame))
+		p.stats.Dropped.Add(1)
+		return
+	}
+
+	if p.summary != nil {
+		p.summary.Record(deviceData.DataState)
+	}
+
+	// 容错2：MQTT未连接且未开启离线暂存，结果无法送达，记录后丢弃（开启时由Publish落盘待补发）；
+	// 认证失败降级的本地模式下解析/隔离/汇总统计照常，仅不发布
+	if !p.pub.Spooling() && p.pub.LocalOnly() {
+		log.Printf("[INFO] [main] 本地模式（MQTT认证失败），设备[%s]检测结果仅本地记录，检测时间：%s，状态：%s，帧：%s",
+			cfg.Device.DeviceID, deviceData.TestTime, deviceData.DataState, models.HexStr(frame))
+		p.stats.Dropped.Add(1)
+		return
+	}
+	if !p.pub.IsConnected() && !p.pub.Spooling() {
+		log.Printf("[WARN] [main] MQTT未连接，设备[%s]检测结果未发布，检测时间：%s，状态：%s，帧：%s",
+			cfg.Device.DeviceID, deviceData.TestTime, deviceData.DataState, models.HexStr(frame))
+		p.stats.Dropped.Add(1)
+		return
+	}
+
+	// 构建标准化MQTT消息
+	mqttMsg := models.NewMQTTMessage(
+		cfg.Device.DeviceID,
+		cfg.Device.Model,
+		models.MQTTMsgTypeData,
+		deviceData,
+	)
+
+	// 发布MQTT消息（医用数据QoS1，保证至少送达）
+	if err := p.pub.Publish(mqttMsg); err != nil {
+		log.Printf("[ERROR] [main] 发布MQTT失败：%v，数据：%+v", err, deviceData)
+		p.stats.Dropped.Add(1)
+		return
 	}
-	opmParser := parser.NewParser()
+	p.stats.Published.Add(1)
 
-	// 5. 启动串口阅读器（数据采集+粘包拆包+重连）
-	serialReader.Start()
+	log.Printf("[INFO] [main] 数据处理完成，设备：%s，检测时间：%s，状态：%s",
+		deviceData.DeviceID, deviceData.TestTime, deviceData.DataState)
+}
+
+// start 启动串口阅读器、解析协程池及监测/心跳协程
+func (p *pipeline) start(pool *parser.WorkerPool) {
+	cfg, mqttClient := p.cfg, p.link.client
+
+	// 启动串口阅读器（数据采集+粘包拆包+重连）
+	p.source.Start()
 	log.Printf("[INFO] [main] 串口阅读器已启动，设备：%s", cfg.Device.DeviceID)
 
-	// 6. 启动数据处理协程（核心链路：串口帧→解析→MQTT发布）
+	// 启动数据处理协程（核心链路：串口帧→解析→MQTT发布）
+	p.startProcessing(pool)
+
+	// 启动样本中断监测（配置expected_gap_sec后生效）
+	if cfg.App.ExpectedGapSec > 0 {
+		go watchSampleGap(p.gapMon, mqttClient, cfg, p.stop)
+	}
+
+	// 启动串口静默看门狗（配置serial.silence_timeout_s后生效）
+	if cfg.Serial.SilenceTimeoutS > 0 {
+		go watchSerialSilence(p.source, mqttClient, cfg, p.stop)
+	}
+
+	// 启动每日汇总发布
+	if p.summary != nil {
+		go watchDailySummary(p.summary, p.serialQ, p.link.quality, mqttClient, cfg, p.stop)
+	}
+
+	// 运行心跳（独立定时器，不受数据流影响）
+	go monitor.RunHeartbeat(time.Duration(cfg.App.HeartbeatSec)*time.Second, p.stop, func() {
+		log.Printf("[INFO] [main] 服务运行中，设备：%s，串口：%s，MQTT：%s，%s",
+			cfg.Device.DeviceID, p.source.HealthState(), models.ConnState(mqttClient.IsConnected()), p.stats.String())
+		if d, ok := p.source.(interface{ Dropped() uint64 }); ok {
+			log.Printf("[INFO] [main] 设备[%s]串口层累计丢弃候选帧%d", cfg.Device.DeviceID, d.Dropped())
+		}
+		if p.serialQ != nil {
+			sq, mq := p.serialQ.Stats(), p.link.quality.Stats()
+			log.Printf("[INFO] [main] 连接质量（近%d小时）：串口可用率%.2f%%（断开%d次），MQTT可用率%.2f%%（断开%d次）",
+				cfg.App.LinkQualityWindowHours, sq.AvailabilityPct, sq.Failures, mq.AvailabilityPct, mq.Failures)
+		}
+	})
+}
+
+// startProcessing 启动帧转发协程，把本设备的帧提交到共用解析协程池（与MQTT连接状态无关，MQTT断开期间照常解析/隔离/暂存）
+func (p *pipeline) startProcessing(pool *parser.WorkerPool) {
+	cfg := p.cfg
 	go func() {
-		for frame := range frameChan {
-			// 容错1：MQTT未连接，丢弃帧并记录日志
-			if !mqttClient.IsConnected() {
-				log.Printf("[WARN] [main] MQTT未连接，丢弃帧：%s", models.HexStr(frame))
-				continue
+		defer close(p.forwarded)
+		// 单串口帧均属同一设备，按设备SN分配协程：同一设备保序，不同设备并行解析
+		for frame := range p.frameChan {
+			pool.Submit(cfg.Device.DeviceID, frame)
+		}
+	}()
+	log.Printf("[INFO] [main] 设备[%s]数据处理协程已启动，链路就绪", cfg.Device.DeviceID)
+}
+
+// close 关闭链路：停止监测协程→关闭串口（关闭帧通道）→等待帧全部提交到解析协程池（协程池由调用方统一关闭）
+func (p *pipeline) close() {
+	close(p.stop)
+	p.source.Close()
+	<-p.forwarded
+	log.Printf("[INFO] [main] 设备[%s]处理链路已关闭", p.cfg.Device.DeviceID)
+}
+
+func main() {
+	check := flag.Bool("check", false, "读取运行状态文件，输出Nagios/NRPE格式检查结果后退出")
+	flag.Parse()
+
+	// 1. 加载配置文件（核心：硬件参数校验+默认值）
+	configPath := "configs/config.yaml"
+	if err := config.Load(configPath); err != nil {
+		if *check {
+			fmt.Printf("UNKNOWN: cannot load config: %v\n", err)
+			os.Exit(monitor.CheckUnknown)
+		}
+		log.Fatalf("[FATAL] 加载配置失败：%v", err)
+	}
+	cfg := config.GlobalConfig
+	if *check {
+		os.Exit(runCheck(cfg))
+	}
+
+	// 2. 初始化日志（生产级分级日志）
+	coalesce := initLog(cfg)
+	stopLog := make(chan struct{})
+	if coalesce != nil {
+		// 重复日志停止后，合并窗口结束即输出汇总
+		go monitor.RunHeartbeat(time.Duration(cfg.Log.CoalesceWindowSec)*time.Second, stopLog, func() {
+			if err := coalesce.FlushExpired(); err != nil {
+				fmt.Fprintf(os.Stderr, "输出日志重复汇总失败：%v\n", err)
 			}
+		})
+	}
+	log.Printf("[INFO] [main] 生效配置（敏感字段已脱敏）：\n%s", cfg.Summary())
 
-			// 解析串口帧为检测数据
-			deviceData, err := opmParser.Parse(frame)
+	// 3. 解析失败帧隔离文件（配置sinks.quarantine.path后生效，各设备共用）
+	var quarantine *sink.Quarantine
+	if qc := cfg.Sinks.Quarantine; qc.Path != "" {
+		var err error
+		quarantine, err = sink.NewQuarantine(qc.Path, int64(qc.MaxMB)<<20, qc.MaxBackups)
+		if err != nil {
+			log.Fatalf("[FATAL] 初始化隔离文件失败：%v", err)
+		}
+		defer quarantine.Close()
+	}
+
+	// 4. 按设备初始化处理链路（串口/MQTT/解析器，贴合硬件特性；shared模式共用一条MQTT连接）
+	var links []*mqttLink
+	var pipelines []*pipeline
+	for _, unit := range cfg.Units() {
+		var link *mqttLink
+		if cfg.SharedConnection() && len(links) > 0 {
+			link = links[0]
+		} else {
+			l, err := newMQTTLink(unit)
 			if err != nil {
-				log.Printf("[ERROR] [main] 解析帧失败：%v，帧：%s", err, models.HexStr(frame))
-				continue
+				log.Fatalf("[FATAL] 设备[%s]初始化MQTT失败：%v", unit.Device.DeviceID, err)
 			}
+			link = l
+			links = append(links, link)
+		}
+		p, err := newPipeline(unit, link, quarantine)
+		if err != nil {
+			log.Fatalf("[FATAL] 设备[%s]%v", unit.Device.DeviceID, err)
+		}
+		pipelines = append(pipelines, p)
+	}
 
-			// 构建标准化MQTT消息
-			mqttMsg := models.NewMQTTMessage(
-				cfg.Device.DeviceID,
-				cfg.Device.Model,
-				models.MQTTMsgTypeData,
-				deviceData,
-			)
-
-			// 发布MQTT消息（医用数据QoS1，保证至少送达）
-			if err := mqttClient.Publish(mqttMsg); err != nil {
-				log.Printf("[ERROR] [main] 发布MQTT失败：%v，数据：%+v", err, deviceData)
-				continue
-			}
+	// 5. 启动共用解析协程池（按设备SN哈希分配，app.parse_workers>1时多台设备并行解析）及各设备处理链路
+	byDevice := make(map[string]*pipeline, len(pipelines))
+	for _, p := range pipelines {
+		byDevice[p.cfg.Device.DeviceID] = p
+	}
+	pool := parser.NewWorkerPool(cfg.App.ParseWorkers, 100, func(deviceID string, f models.Frame) {
+		byDevice[deviceID].handleFrame(f)
+	})
+	log.Printf("[INFO] [main] 解析协程池已启动，协程数：%d", cfg.App.ParseWorkers)
+	for _, p := range pipelines {
+		p.start(pool)
+	}
+	log.Printf("[INFO] [main] 全链路就绪，设备数：%d，MQTT连接数：%d", len(pipelines), len(links))
 
-			log.Printf("[INFO] [main] 数据处理完成，设备：%s，检测时间：%s，状态：%s",
-				deviceData.DeviceID, deviceData.TestTime, deviceData.DataState)
-		}
-	}()
-	log.Printf("[INFO] [main] 数据处理协程已启动，全链路就绪")
+	// 6. 运行状态文件（供 -check 读取）
+	stopHealth := make(chan struct{})
+	if cfg.App.StateFile != "" {
+		go monitor.RunHeartbeat(healthWriteInterval, stopHealth, func() {
+			writeHealth(cfg.App.StateFile, pipelines)
+		})
+	}
 
 	// 7. 捕获系统退出信号（SIGINT/SIGTERM），实现优雅退出（生产级必备）
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan // 阻塞等待退出信号
 
-	// 8. 优雅关闭所有模块（按顺序：串口→MQTT，释放所有资源）
+	// 8. 优雅关闭所有模块（按顺序：各设备链路→MQTT，释放所有资源）
 	log.Printf("[INFO] [main] 接收到退出信号，开始优雅关闭...")
-	serialReader.Close()
-	mqttClient.Close()
+	close(stopHealth)
+	for _, p := range pipelines {
+		p.close()
+	}
+	pool.Close() // 处理完已提交的帧后再关闭MQTT
+	for _, l := range links {
+		l.client.Close()
+	}
+	if cfg.App.StateFile != "" {
+		writeHealth(cfg.App.StateFile, pipelines) // 记录退出时未送达的暂存消息数
+	}
 	log.Printf("[INFO] [main] 所有模块已关闭，程序正常退出")
+	close(stopLog)
+	if coalesce != nil {
+		if err := coalesce.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "输出日志重复汇总失败：%v\n", err)
+		}
+	}
 }
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"opm-mqtt-gateway/internal/config"
+	"opm-mqtt-gateway/internal/models"
+	"opm-mqtt-gateway/internal/monitor"
+	"opm-mqtt-gateway/internal/parser"
+	"opm-mqtt-gateway/internal/serial"
+	"opm-mqtt-gateway/internal/sink"
+)
+
+// fakePublisher 模拟MQTT客户端（记录发布的消息，连接/暂存状态可设置）
+type fakePublisher struct {
+	mu        sync.Mutex
+	connected bool
+	localOnly bool
+	spooling  bool
+	published []*models.MQTTMessage
+}
+
+func (f *fakePublisher) IsConnected() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connected
+}
+func (f *fakePublisher) LocalOnly() bool { return f.localOnly }
+func (f *fakePublisher) Spooling() bool  { return f.spooling }
+func (f *fakePublisher) Publish(msg *models.MQTTMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.published = append(f.published, msg)
+	return nil
+}
+
+// count 已提交发布的消息数
+func (f *fakePublisher) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.published)
+}
+
+// newTestPipeline 新建只含解析/隔离/监测模块的处理链路（不打开串口与MQTT）
+func newTestPipeline(t *testing.T, pub publisher) (*pipeline, string) {
+	t.Helper()
+	cfg := &config.Config{
+		Device: config.DeviceConfig{DeviceID: "SN1234567890", Model: "OPM-1560B"},
+		Parser: config.ParserConfig{FrameStart: "AA", FrameEnd: "55", CheckType: "sum", FrameMinLen: 16},
+	}
+	qPath := filepath.Join(t.TempDir(), "quarantine.jsonl")
+	q, err := sink.NewQuarantine(qPath, 1<<20, 1)
+	if err != nil {
+		t.Fatalf("新建隔离文件失败：%v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	op, err := parser.NewForConfig(cfg)
+	if err != nil {
+		t.Fatalf("新建解析器失败：%v", err)
+	}
+	return &pipeline{
+		cfg:        cfg,
+		pub:        pub,
+		opmParser:  op,
+		quarantine: q,
+		retrigger:  parser.NewRetriggerFilter(0),
+		gapMon:     monitor.NewGapMonitor(0, 0, 0),
+	}, qPath
+}
+
+// TestHandleFrame_QuarantineWhileMQTTDown 测试：MQTT断开且未开启暂存时，帧照常解析计数，解析失败帧写入隔离文件
+func TestHandleFrame_QuarantineWhileMQTTDown(t *testing.T) {
+	p, qPath := newTestPipeline(t, &fakePublisher{})
+
+	good, _ := hex.DecodeString("AA05200100000000000000001010004655")
+	bad, _ := hex.DecodeString("AA05200100000000000000001010009955")
+	p.handleFrame(models.Frame{Raw: good})
+	p.handleFrame(models.Frame{Raw: bad})
+
+	if got := p.stats.Frames.Load(); got != 2 {
+		t.Errorf("收帧计数错误，预期2，实际%d", got)
+	}
+	if got := p.stats.ParseErrors.Load(); got != 1 {
+		t.Errorf("解析失败计数错误，预期1，实际%d", got)
+	}
+	if got := p.stats.Dropped.Load(); got != 1 {
+		t.Errorf("未发布计数错误，预期1（正常帧无法送达），实际%d", got)
+	}
+	raw, err := os.ReadFile(qPath)
+	if err != nil {
+		t.Fatalf("读取隔离文件失败：%v", err)
+	}
+	if !strings.Contains(string(raw), strings.ToUpper(hex.EncodeToString(bad))) {
+		t.Fatalf("MQTT断开期间的解析失败帧未写入隔离文件：%s", raw)
+	}
+}
+
+// TestHandleFrame_LocalOnlyKeepsProcessing 测试：认证失败降级的本地模式（未开启暂存）下帧照常解析计数，解析失败帧照常隔离，不发布
+func TestHandleFrame_LocalOnlyKeepsProcessing(t *testing.T) {
+	pub := &fakePublisher{localOnly: true}
+	p, qPath := newTestPipeline(t, pub)
+
+	good, _ := hex.DecodeString("AA05200100000000000000001010004655")
+	bad, _ := hex.DecodeString("AA05200100000000000000001010009955")
+	p.handleFrame(models.Frame{Raw: good})
+	p.handleFrame(models.Frame{Raw: bad})
+
+	if got := p.stats.ParseErrors.Load(); got != 1 {
+		t.Errorf("解析失败计数错误，预期1，实际%d", got)
+	}
+	if got := p.stats.Dropped.Load(); got != 1 {
+		t.Errorf("未发布计数错误，预期1，实际%d", got)
+	}
+	if pub.count() != 0 {
+		t.Fatalf("本地模式不应发布，实际%d条", pub.count())
+	}
+	raw, err := os.ReadFile(qPath)
+	if err != nil || !strings.Contains(string(raw), strings.ToUpper(hex.EncodeToString(bad))) {
+		t.Fatalf("本地模式下解析失败帧未写入隔离文件：%s（%v）", raw, err)
+	}
+}
+
+// TestPipeline_SerialAndMQTTIndependent 集成测试：串口侧与MQTT侧互不阻塞
+// MQTT断开（开启暂存）时回放帧照常解析、隔离并提交暂存；串口离线后MQTT侧保持在线，已提交的结果不受影响
+func TestPipeline_SerialAndMQTTIndependent(t *testing.T) {
+	pub := &fakePublisher{spooling: true}
+	p, qPath := newTestPipeline(t, pub)
+	p.frameChan = make(chan models.Frame, 10)
+	p.forwarded = make(chan struct{})
+	p.stop = make(chan struct{})
+
+	replay := filepath.Join(t.TempDir(), "replay.hex")
+	content := "AA05200100000000000000001010004655\nAA05200100000000000000001010009955\nAA03000100000000000000001010002455\n"
+	if err := os.WriteFile(replay, []byte(content), 0644); err != nil {
+		t.Fatalf("写入回放文件失败：%v", err)
+	}
+	src, err := serial.NewFileReaderFor(p.cfg, replay, 0, p.frameChan)
+	if err != nil {
+		t.Fatalf("新建回放数据源失败：%v", err)
+	}
+	p.source = src
+	var states []string
+	var statesMu sync.Mutex
+	src.OnStateChange(func(old, new, reason string) {
+		statesMu.Lock()
+		defer statesMu.Unlock()
+		states = append(states, new)
+	})
+
+	// 1. MQTT断开：串口侧照常采集，帧全部解析计数，解析失败帧隔离，正常帧提交暂存
+	pool := parser.NewWorkerPool(1, 10, func(_ string, f models.Frame) { p.handleFrame(f) })
+	src.Start()
+	p.startProcessing(pool)
+	deadline := time.Now().Add(2 * time.Second)
+	for p.stats.Frames.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := p.stats.Frames.Load(); got != 3 {
+		t.Fatalf("MQTT断开期间串口帧未全部进入处理，预期3，实际%d", got)
+	}
+
+	// 2. 串口离线：处理链路关闭，MQTT侧不受影响，随后恢复连接
+	p.close()
+	pool.Close()
+	pub.mu.Lock()
+	pub.connected = true
+	pub.mu.Unlock()
+
+	if got := pub.count(); got != 2 {
+		t.Errorf("MQTT断开期间应提交暂存2条正常结果，实际%d", got)
+	}
+	if got := p.stats.ParseErrors.Load(); got != 1 {
+		t.Errorf("解析失败计数错误，预期1，实际%d", got)
+	}
+	raw, err := os.ReadFile(qPath)
+	if err != nil || !strings.Contains(string(raw), "AA05200100000000000000001010009955") {
+		t.Errorf("MQTT断开期间的解析失败帧未隔离：%s（%v）", raw, err)
+	}
+	statesMu.Lock()
+	defer statesMu.Unlock()
+	if len(states) != 2 || states[1] != models.DeviceStateOffline || !pub.IsConnected() {
+		t.Errorf("串口离线不应影响MQTT侧：串口状态%v，MQTT在线%v", states, pub.IsConnected())
+	}
+}
@@ -2,13 +2,15 @@ module opm-mqtt-gateway
 
 go 1.25.5
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	github.com/eclipse/paho.mqtt.golang v1.5.1
+	go.bug.st/serial v1.6.4
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/creack/goselect v0.1.2 // indirect
-	github.com/eclipse/paho.mqtt.golang v1.5.1 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
-	go.bug.st/serial v1.6.4 // indirect
 	golang.org/x/net v0.44.0 // indirect
 	golang.org/x/sync v0.17.0 // indirect
 	golang.org/x/sys v0.36.0 // indirect
@@ -4,33 +4,97 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"opm-mqtt-gateway/internal/models"
 )
 
 // 全局配置实例，供所有模块调用
 var GlobalConfig *Config
 
-// Config 项目总配置，包含OPM-1560B专属/串口/MQTT/解析/日志配置
+// 分项主题模式
+const (
+	PerItemAlso = "also" // 汇总消息+分项消息
+	PerItemOnly = "only" // 仅分项消息
+)
+
+// MQTTConnectTimeout 单次MQTT连接等待上限（重连看门狗卡死判定时长须大于该值+重连基础间隔）
+const MQTTConnectTimeout = 30 * time.Second
+
+// 多设备MQTT连接模式（mqtt.multi_device_connection）
+const (
+	ConnPerDevice = "per_device" // 每台设备独立连接（独立遗嘱/下行命令）
+	ConnShared    = "shared"     // 所有设备共用一条连接（主题按消息device_id区分）
+)
+
+// Config 项目总配置，包含应用/OPM-1560B专属/串口/MQTT/解析/日志配置
 type Config struct {
+	App    AppConfig    `yaml:"app"    comment:"网关应用配置（名称/版本/操作员）"`
 	Device DeviceConfig `yaml:"device" comment:"OPM-1560B设备专属配置（必填SN）"`
 	Serial SerialConfig `yaml:"serial" comment:"串口配置（硬件固化参数默认）"`
 	MQTT   MQTTConfig   `yaml:"mqtt"   comment:"MQTT配置（医用数据QoS1默认）"`
 	Log    LogConfig    `yaml:"log"    comment:"日志配置"`
 	Parser ParserConfig `yaml:"parser" comment:"协议解析配置（硬件帧格式固定）"`
+	Sinks  SinksConfig  `yaml:"sinks"  comment:"附加输出配置（隔离文件等）"`
+	// 多设备：单进程接入多台分析仪，每项一台设备及其串口；配置后忽略顶层device/serial
+	Devices []DeviceUnit `yaml:"devices" comment:"多设备列表（device+serial），为空则使用顶层device/serial"`
+
+	units       []*Config      // 各设备独立配置（Load时展开，单设备为空）
+	connDevices []DeviceConfig // shared模式共用连接的全部设备（各设备配置相同，其余情况为空）
+}
+
+// DeviceUnit 多设备配置项：一台设备及其串口，其余配置（MQTT/解析/日志等）沿用顶层
+type DeviceUnit struct {
+	Device DeviceConfig `yaml:"device" comment:"设备配置（device_id不得重复）"`
+	Serial SerialConfig `yaml:"serial" comment:"串口配置"`
+}
+
+// AppConfig 网关应用配置（操作员/班次随检测结果上报，便于平台追溯检验人员）
+type AppConfig struct {
+	Name       string `yaml:"name"        comment:"应用名称"`
+	Version    string `yaml:"version"     comment:"应用版本"`
+	OperatorID string `yaml:"operator_id" comment:"当前操作员ID，为空则不上报，可通过下行命令修改"`
+	ShiftID    string `yaml:"shift_id"    comment:"当前班次ID，为空则不上报，可通过下行命令修改"`
+	// 重复触发过滤：窗口内内容相同的结果视为同一样本重复触发（重复按键/卡条），0为关闭
+	MinSampleIntervalMs int `yaml:"min_sample_interval_ms" comment:"相邻样本最小间隔，单位毫秒，默认0（关闭）"`
+	// 样本中断告警：工作时段内超过间隔无样本则上报state告警（sample_gap）
+	ExpectedGapSec int    `yaml:"expected_gap_sec" comment:"工作时段内最大无样本间隔，单位秒，默认0（关闭）"`
+	ActiveHours    string `yaml:"active_hours"     comment:"工作时段，格式HH:MM-HH:MM（可跨零点），为空则全天"`
+	// 部署环境标识：写入消息信封，可选追加到主题前缀，防止测试网关误发到生产平台
+	Environment         string   `yaml:"environment"          comment:"部署环境标识（如dev/staging/prod），为空则不上报"`
+	AllowedEnvironments []string `yaml:"allowed_environments" comment:"允许的环境标识列表，为空则不限制"`
+	EnvironmentInTopic  bool     `yaml:"environment_in_topic" comment:"是否将环境标识追加到主题前缀（前缀/环境/device_id/...），默认false"`
+	// 每日汇总：到达配置时间后发布当日样本数/异常数/离线时长到 前缀/device_id/summary
+	DailySummaryAt string `yaml:"daily_summary_at" comment:"每日汇总发布时间，格式HH:MM，为空则关闭"`
+	Timezone       string `yaml:"timezone"         comment:"每日汇总所用时区（如Asia/Shanghai），为空则使用系统时区"`
+	HeartbeatSec   int    `yaml:"heartbeat_sec"    comment:"运行心跳日志间隔（含链路计数），单位秒，默认60"`
+	// 运行状态文件：定期写入串口/MQTT状态及最近样本时间，供 -check（Nagios/NRPE）读取
+	StateFile         string `yaml:"state_file"           comment:"运行状态文件路径（-check读取），为空则不写入（默认）"`
+	CheckSampleAgeSec int    `yaml:"check_sample_age_sec" comment:"-check 最近样本超过该时长报WARNING，单位秒，默认0（不检查）"`
+	// 静态标签：平铺到每条消息信封顶层，供平台按病区/楼宇/资产编号路由与展示
+	Tags map[string]string `yaml:"tags" comment:"网关静态标签（键不得与信封字段重名），为空则不附加"`
+	// 解析协程池：按设备哈希分配协程，同一设备帧保序（多路复用器接入多台分析仪时提高吞吐）
+	ParseWorkers int `yaml:"parse_workers" comment:"解析协程数，默认1"`
+	// 连接质量：滚动窗口内统计串口/MQTT可用率与MTBF，输出到运行心跳及每日汇总
+	LinkQualityWindowHours int `yaml:"link_quality_window_hours" comment:"连接质量统计窗口，单位小时，默认0（关闭）"`
+	// 退出时离线暂存仍有未送达消息：记录WARN，便于监控发现未上报的检测数据
+	WarnOnSpoolRemaining bool `yaml:"warn_on_spool_remaining" comment:"退出时离线暂存有未送达消息是否告警（WARN），默认false"`
 }
 
 // DeviceConfig OPM-1560B设备专属配置
 type DeviceConfig struct {
 	DeviceID string `yaml:"device_id" comment:"设备唯一SN编号（必填，出厂固化）"`
-	Model    string `yaml:"model"    comment:"设备型号，固定为OPM-1560B"`
+	Model    string `yaml:"model"    comment:"设备型号，按型号选择已注册的解析器，默认OPM-1560B"`
 }
 
 // SerialConfig 串口配置（OPM-1560B硬件固化：9600/8/1/none，不可修改）
 type SerialConfig struct {
-	Port     string `yaml:"port"       comment:"串口名：Linux-/dev/ttyUSBx，Windows-COMx"`
+	Port     string `yaml:"port"       comment:"串口名：Linux-/dev/ttyUSBx，Windows-COMx，TCP透传-tcp://host:port，USB自动匹配-auto:VID:PID"`
 	BaudRate int    `yaml:"baud_rate"  comment:"波特率，仅支持9600/19200（硬件约束）"`
 	DataBits int    `yaml:"data_bits"  comment:"数据位，固定8（硬件约束，不可改）"`
 	StopBits int    `yaml:"stop_bits"  comment:"停止位，固定1（硬件约束，不可改）"`
@@ -38,11 +102,45 @@ type SerialConfig struct {
 	Timeout  int    `yaml:"timeout"    comment:"串口读写超时，单位秒，默认3"`
 	RetryCnt int    `yaml:"retry_cnt"  comment:"串口打开重试次数，默认3"`
 	RetryInt int    `yaml:"retry_int"  comment:"串口重试间隔，单位秒，默认2"`
+	MaxDrain int    `yaml:"max_drain" comment:"单次读取最多排空字节数，默认1024（高波特率减少帧拆分，等于read_chunk_size即关闭排空）"`
+	// 信号线控制：部分线缆须主机置位DTR/RTS设备才发送数据；未配置则保持驱动默认状态
+	RTS *bool `yaml:"rts" comment:"打开后置位(true)/复位(false)RTS，未配置不修改"`
+	DTR *bool `yaml:"dtr" comment:"打开后置位(true)/复位(false)DTR，未配置不修改"`
+	// 缓冲上限：帧头之后长时间收不到帧尾（线路噪声/帧尾丢失）时，保留数据超过上限即丢弃至下一个帧头
+	MaxFrameBytes int `yaml:"max_frame_bytes" comment:"等待帧尾时保留的最大字节数，默认4096"`
+	// 静默看门狗：串口已打开但超过该时长未收到任何字节，判定设备异常（上报error状态），收到数据后恢复
+	SilenceTimeoutS int `yaml:"silence_timeout_s" comment:"串口无数据判定设备异常的时长，单位秒，默认0（关闭）"`
+	// 波特率自动探测：打开后依次以9600/19200采样，按是否出现有效帧判定设备实际波特率，未识别时使用baud_rate
+	BaudAuto bool `yaml:"baud_auto" comment:"是否自动探测波特率（9600/19200），默认false"`
+	// 原始抓包：串口每次读取的原始字节（时间+16进制）异步写入文件，按大小滚动，供现场排查
+	CapturePath       string `yaml:"capture_path"        comment:"原始字节抓包文件路径，为空则关闭"`
+	CaptureMaxMB      int    `yaml:"capture_max_mb"      comment:"抓包文件滚动大小，单位MB，默认10"`
+	CaptureMaxBackups int    `yaml:"capture_max_backups" comment:"抓包文件滚动保留数，默认3"`
+	// 打开/重连后清空驱动输入缓冲（断线前残留的半帧会污染首帧解析）
+	FlushOnOpen *bool `yaml:"flush_on_open" comment:"打开/重连后是否清空驱动输入缓冲，默认true"`
+	// 单次读缓冲：多样本批量导出时调大可减少帧被拆到多次读取
+	ReadChunkSize int `yaml:"read_chunk_size" comment:"单次读缓冲大小，单位字节，默认128，范围16-4096"`
+	// 帧间静默：超过该时长无新数据，缓冲区残留的半帧视为过期丢弃（设备发送中途重启）
+	FrameGapMs int `yaml:"frame_gap_ms" comment:"帧间静默超时，单位毫秒，默认2000"`
+	// 帧尾挽救：静默超时时缓冲区有帧头无帧尾，补全帧尾后和校验通过则仍提交解析
+	SalvageOnGap bool `yaml:"salvage_on_gap" comment:"静默超时时是否挽救帧尾丢失但和校验通过的帧，默认false"`
+	// 重复帧合并：设备重发导致窗口内连续出现字节完全相同的帧，只提交一次
+	DupWindowMs int `yaml:"dup_window_ms" comment:"重复帧合并窗口，单位毫秒，默认0（关闭）"`
+	// 上电噪声：部分设备上电瞬间发出残缺/乱码帧，每次（重）连接后丢弃前N帧
+	DiscardFirstFrames int `yaml:"discard_first_frames" comment:"每次（重）连接后丢弃的帧数，默认0"`
+	// 握手确认：串口打开后须收到有效帧才判定设备在线（仅插着USB转串口适配器时不误报online）
+	RequireHandshake    bool `yaml:"require_handshake"     comment:"是否收到有效帧后才判定串口在线，默认false"`
+	HandshakeTimeoutSec int  `yaml:"handshake_timeout_sec" comment:"等待首个有效帧的告警超时，单位秒，默认30"`
+	// 串口层和校验：check_type=sum时，和校验失败（且未触发帧头重对齐）的帧直接丢弃，不交给解析器
+	DropBadChecksum bool `yaml:"drop_bad_checksum" comment:"是否在串口层丢弃和校验失败的帧，默认false"`
+	// 文件回放：以录制文件替代串口（无硬件联调/CI），.hex/.txt为每行一帧的16进制文本，其余为原始串口录制
+	ReplayFile       string `yaml:"replay_file"        comment:"回放文件路径，非空时不打开串口"`
+	ReplayIntervalMs int    `yaml:"replay_interval_ms" comment:"回放帧间间隔，单位毫秒，默认0（不等待）"`
 }
 
 // MQTTConfig MQTT配置（医用数据推荐QoS1，保证至少送达）
 type MQTTConfig struct {
-	Broker       string `yaml:"broker"        comment:"MQTT服务端：tcp://ip:port"`
+	Broker       string `yaml:"broker"        comment:"MQTT服务端：tcp://ip:port，TLS为tls://或ssl://"`
 	ClientID     string `yaml:"client_id"     comment:"客户端ID，为空则使用device_id"`
 	Username     string `yaml:"username"      comment:"MQTT用户名，无则留空"`
 	Password     string `yaml:"password"      comment:"MQTT密码，无则留空"`
@@ -54,12 +152,57 @@ type MQTTConfig struct {
 	WillMsg      string `yaml:"will_msg"      comment:"遗嘱消息，离线时发送offline"`
 	WillQoS      int    `yaml:"will_qos"      comment:"遗嘱QoS，默认1"`
 	WillRetain   bool   `yaml:"will_retain"   comment:"遗嘱是否保留，默认true"`
+	// 状态上报去重：相同状态在间隔内只上报一次（防止频繁重连刷屏state主题）
+	MinStateIntervalSec int `yaml:"min_state_interval_sec" comment:"相同状态最小上报间隔，单位秒，默认10"`
+	// 发布熔断：连续失败达到阈值后冷却期内跳过发布，冷却结束放行一条探测消息
+	BreakerThreshold   int `yaml:"breaker_threshold"    comment:"触发熔断的连续发布失败次数，默认0（关闭）"`
+	BreakerCooldownSec int `yaml:"breaker_cooldown_sec" comment:"熔断冷却时间，单位秒，默认30"`
+	// 认证失败降级：服务端拒绝用户名/密码时停止重连，进入本地模式（state原因auth_failed）
+	AuthFailLocalOnly bool `yaml:"auth_fail_local_only" comment:"认证失败时是否停止重连降级为本地模式，默认false（持续重连）"`
+	// 审计哈希链：每条发布消息追加链条目到 前缀/device_id/ledger，链头落盘跨重启续链
+	LedgerEnabled  bool   `yaml:"ledger_enabled"   comment:"是否发布消息哈希链条目，默认false"`
+	LedgerHeadPath string `yaml:"ledger_head_path" comment:"哈希链链头持久化文件，默认data/ledger.head"`
+	// 分项主题：每个检测项单独发布到 前缀/device_id/data/<检测项>，便于看板按项订阅
+	PerItemTopics string `yaml:"per_item_topics" comment:"分项主题模式：空=关闭，also=与汇总消息同时发布，only=仅分项"`
+	PerItemRetain bool   `yaml:"per_item_retain" comment:"分项消息是否保留（平台订阅即得各项最新值），默认false"`
+	// 重连看门狗：断开期间重连协程超过 倍数×重连基础间隔 未推进，判定卡死并重启重连协程
+	ReconnectWatchdogMult int `yaml:"reconnect_watchdog_mult" comment:"重连协程卡死判定倍数（×reconnect_int，须大于30s+reconnect_int），默认0（关闭）"`
+	// 多设备连接模式：per_device每台独立客户端ID（client_id-device_id）与遗嘱；shared共用一条连接，
+	// 状态上报/下行命令/哈希链按设备区分，遗嘱（每条连接仅一个）归属will_topic（默认第一台设备）
+	MultiDeviceConnection string `yaml:"multi_device_connection" comment:"多设备MQTT连接模式：per_device/shared，默认per_device"`
+	// 离线暂存：断开期间检测数据/汇总逐条落盘，重连后按序补发；超过上限丢弃最旧消息
+	SpoolDir         string `yaml:"spool_dir"          comment:"离线暂存目录，为空则关闭（断开期间消息丢弃）"`
+	SpoolMaxMessages int    `yaml:"spool_max_messages" comment:"离线暂存最大消息数，超过丢弃最旧，默认10000"`
+	SpoolMaxMB       int    `yaml:"spool_max_mb"       comment:"离线暂存文件总大小上限，单位MB，超过丢弃最旧，默认100"`
+	// TLS：broker为tls://或ssl://时生效；配置客户端证书/私钥启用双向认证
+	TLSCA                 string `yaml:"tls_ca"                   comment:"CA证书（PEM）路径，为空使用系统根证书"`
+	TLSCert               string `yaml:"tls_cert"                 comment:"客户端证书（PEM）路径，双向认证时与tls_key同时配置"`
+	TLSKey                string `yaml:"tls_key"                  comment:"客户端私钥（PEM）路径，双向认证时与tls_cert同时配置"`
+	TLSInsecureSkipVerify bool   `yaml:"tls_insecure_skip_verify" comment:"是否跳过服务端证书校验（仅限联调），默认false"`
+	// 出站校验：序列化后按内置schema校验消息，不符合的消息记录日志并丢弃，不发布也不暂存
+	ValidateOutput bool `yaml:"validate_output" comment:"发布前是否按内置schema校验消息，默认false"`
 }
 
 // LogConfig 日志配置
 type LogConfig struct {
 	Path  string `yaml:"path"  comment:"日志文件路径，默认logs/app.log"`
 	Level string `yaml:"level" comment:"日志级别：INFO/WARN/ERROR/FATAL，默认INFO"`
+	// 纯文本日志：统一去除emoji/装饰符号，兼容日志采集器与grep
+	PlainText bool `yaml:"plain_text" comment:"是否去除日志中的emoji及装饰符号，默认false"`
+	// 日志合并：窗口内连续相同的日志只输出首条，内容变化时汇总重复次数（线缆抖动防刷屏）
+	CoalesceWindowSec int `yaml:"coalesce_window_sec" comment:"相同日志合并窗口，单位秒，默认0（关闭）"`
+}
+
+// SinksConfig 附加输出配置（MQTT之外的本地落盘/转发）
+type SinksConfig struct {
+	Quarantine QuarantineConfig `yaml:"quarantine" comment:"解析失败帧隔离文件（现场问题分析）"`
+}
+
+// QuarantineConfig 解析失败帧隔离配置（按大小滚动，便于回收现场异常帧改进解析器）
+type QuarantineConfig struct {
+	Path       string `yaml:"path"        comment:"隔离文件路径，为空则关闭"`
+	MaxMB      int    `yaml:"max_mb"      comment:"单个文件最大大小，单位MB，默认10"`
+	MaxBackups int    `yaml:"max_backups" comment:"滚动保留的历史文件数，默认3"`
 }
 
 // ParserConfig 协议解析配置（OPM-1560B硬件固定：AA帧头/55帧尾/和校验）
@@ -68,6 +211,27 @@ type ParserConfig struct {
 	FrameEnd    string `yaml:"frame_end"    comment:"帧尾，16进制，固定55（硬件约束）"`
 	CheckType   string `yaml:"check_type"   comment:"校验方式，固定sum（和校验，硬件约束）"`
 	FrameMinLen int    `yaml:"frame_min_len" comment:"最小帧长度，固定16（硬件约束）"`
+	// 连续和校验失败达到次数后，串口层跳过疑似误判的帧头（数据中的0xAA）重新对齐
+	ResyncAfterFailures int  `yaml:"resync_after_failures" comment:"触发帧头重对齐的连续和校验失败次数，默认0（关闭，校验失败帧交给解析器计数/隔离）"`
+	IncludeFieldHex     bool `yaml:"include_field_hex"     comment:"是否附带各检测项原始字节16进制（审计溯源），默认false"`
+	// 长度字段模式：帧头后1字节为数据段长度，按声明长度定界（数据中出现55也不会误切分）
+	HasLengthField bool `yaml:"has_length_field" comment:"帧头后是否带长度字节，默认false（按帧尾55定界）"`
+	FrameMaxLen    int  `yaml:"frame_max_len"    comment:"最大帧长度，默认128（长度字段模式校验声明长度）"`
+	// 严格边界：帧尾55之后须紧跟帧头AA（或缓冲区结束），避免数据段中的55导致提前切分
+	StrictBoundary bool `yaml:"strict_boundary" comment:"帧尾后是否须紧跟帧头才确认帧边界，默认false"`
+	QualityScore   bool `yaml:"quality_score"   comment:"是否为每条结果附带质量评分（0-100），默认false"`
+	// 原始帧编码：hex输出raw_frame_hex，base64输出raw_frame_base64（报文更紧凑）
+	RawEncoding string `yaml:"raw_encoding" comment:"原始帧编码：hex/base64，默认hex"`
+	// 物理可能范围校验：PH超出0-14、比重超出0.9-1.2视为解码错误/数据损坏，标记invalid而非abnormal
+	PlausibilityCheck bool `yaml:"plausibility_check" comment:"是否校验PH/比重物理可能范围，默认false"`
+	// 参考范围：按检测项覆盖内置范围（数值项min/max，等级项allowed），未配置项使用内置PH 4.5-8.0、比重1.005-1.030
+	ReferenceRanges map[string]models.ReferenceRange `yaml:"reference_ranges" comment:"检测项参考范围（键同检测数据JSON字段名），为空使用内置范围"`
+	// 外部码表：等级/亚硝酸盐编码及检测项名称/单位/参考范围/LOINC，逐项覆盖内置码表
+	DecodeTableFile string `yaml:"decode_table_file" comment:"外部解码码表文件（YAML/JSON），空则使用内置码表"`
+	// 数值代理：等级项（如蛋白2+）按阶梯附带数值浓度，供下游分析；原等级值保留用于展示
+	EmitNumericProxy bool `yaml:"emit_numeric_proxy" comment:"是否为等级项附带数值代理，默认false"`
+	// 数值代理阶梯：检测项→等级→数值，须覆盖该项全部等级；开启且未配置时使用内置蛋白/葡萄糖阶梯
+	NumericProxy map[string]map[string]float64 `yaml:"numeric_proxy" comment:"数值代理阶梯（检测项→等级→数值）"`
 }
 
 // Load 加载配置文件，执行：默认值设置→环境变量覆盖→硬件合法性校验
@@ -84,6 +248,23 @@ func Load(configPath string) error {
 		return fmt.Errorf("解析YAML失败: %w", err)
 	}
 
+	// 多设备：逐台展开为独立配置，顶层沿用第一台（日志/健康文件等单设备代码路径）
+	if len(cfg.Devices) > 0 {
+		units, err := expandUnits(&cfg)
+		if err != nil {
+			return fmt.Errorf("硬件配置校验失败: %w", err)
+		}
+		top := *units[0]
+		top.units = units
+		top.Devices = make([]DeviceUnit, len(units))
+		for i, u := range units {
+			top.Devices[i] = DeviceUnit{Device: u.Device, Serial: u.Serial}
+		}
+		GlobalConfig = &top
+		fmt.Printf("[INFO] 配置加载成功，设备数：%d，MQTT服务端：%s，连接模式：%s\n", len(units), top.MQTT.Broker, top.MQTT.MultiDeviceConnection)
+		return nil
+	}
+
 	// 2. 设置硬件固化默认值（核心：配置缺失时自动兜底，避免运行失败）
 	setHardwareDefaults(&cfg)
 	// 3. 环境变量覆盖配置（适配容器化，无需修改配置文件）
@@ -128,11 +309,47 @@ func setHardwareDefaults(cfg *Config) {
 	if cfg.Serial.RetryInt == 0 {
 		cfg.Serial.RetryInt = 2
 	}
+	if cfg.Serial.MaxFrameBytes == 0 {
+		cfg.Serial.MaxFrameBytes = 4096
+	}
+	if cfg.Serial.CaptureMaxMB == 0 {
+		cfg.Serial.CaptureMaxMB = 10
+	}
+	if cfg.Serial.CaptureMaxBackups == 0 {
+		cfg.Serial.CaptureMaxBackups = 3
+	}
+	if cfg.Serial.FlushOnOpen == nil {
+		flush := true
+		cfg.Serial.FlushOnOpen = &flush
+	}
+	if cfg.Serial.ReadChunkSize == 0 {
+		cfg.Serial.ReadChunkSize = 128
+	}
+	if cfg.Serial.MaxDrain == 0 {
+		cfg.Serial.MaxDrain = 1024
+	}
+	if cfg.Serial.FrameGapMs == 0 {
+		cfg.Serial.FrameGapMs = 2000
+	}
+	if cfg.Serial.HandshakeTimeoutSec == 0 {
+		cfg.Serial.HandshakeTimeoutSec = 30
+	}
+
+	// 应用默认值
+	if cfg.App.HeartbeatSec == 0 {
+		cfg.App.HeartbeatSec = 60
+	}
+	if cfg.App.ParseWorkers == 0 {
+		cfg.App.ParseWorkers = 1
+	}
 
 	// MQTT默认值（医用数据优化：QoS1+遗嘱）
 	if cfg.MQTT.TopicPrefix == "" {
 		cfg.MQTT.TopicPrefix = "opm1560b/urine/analyzer"
 	}
+	if cfg.App.EnvironmentInTopic && cfg.App.Environment != "" {
+		cfg.MQTT.TopicPrefix += "/" + cfg.App.Environment
+	}
 	if cfg.MQTT.QoS == 0 {
 		cfg.MQTT.QoS = 1
 	}
@@ -157,6 +374,21 @@ func setHardwareDefaults(cfg *Config) {
 	if !cfg.MQTT.WillRetain {
 		cfg.MQTT.WillRetain = true
 	}
+	if cfg.MQTT.MinStateIntervalSec == 0 {
+		cfg.MQTT.MinStateIntervalSec = 10
+	}
+	if cfg.MQTT.BreakerCooldownSec == 0 {
+		cfg.MQTT.BreakerCooldownSec = 30
+	}
+	if cfg.MQTT.LedgerHeadPath == "" {
+		cfg.MQTT.LedgerHeadPath = "data/ledger.head"
+	}
+	if cfg.MQTT.SpoolMaxMessages == 0 {
+		cfg.MQTT.SpoolMaxMessages = 10000
+	}
+	if cfg.MQTT.SpoolMaxMB == 0 {
+		cfg.MQTT.SpoolMaxMB = 100
+	}
 
 	// 日志默认值
 	if cfg.Log.Path == "" {
@@ -166,6 +398,14 @@ func setHardwareDefaults(cfg *Config) {
 		cfg.Log.Level = "INFO"
 	}
 
+	// 隔离文件默认值
+	if cfg.Sinks.Quarantine.MaxMB == 0 {
+		cfg.Sinks.Quarantine.MaxMB = 10
+	}
+	if cfg.Sinks.Quarantine.MaxBackups == 0 {
+		cfg.Sinks.Quarantine.MaxBackups = 3
+	}
+
 	// 解析器默认值（硬件固化：AA/55/和校验/16字节最小帧）
 	if cfg.Parser.FrameStart == "" {
 		cfg.Parser.FrameStart = "AA"
@@ -179,10 +419,79 @@ func setHardwareDefaults(cfg *Config) {
 	if cfg.Parser.FrameMinLen == 0 {
 		cfg.Parser.FrameMinLen = 16
 	}
+	if cfg.Parser.FrameMaxLen == 0 {
+		cfg.Parser.FrameMaxLen = 128
+	}
+	if cfg.Parser.RawEncoding == "" {
+		cfg.Parser.RawEncoding = models.RawEncodingHex
+	}
+	if cfg.Parser.EmitNumericProxy && len(cfg.Parser.NumericProxy) == 0 {
+		cfg.Parser.NumericProxy = models.DefaultNumericProxy()
+	}
+}
+
+// validateReferenceRanges 校验参考范围：检测项须已知，数值项须同时配置min/max且min<max，等级项须配置allowed
+func validateReferenceRanges(ranges map[string]models.ReferenceRange) error {
+	numeric := make(map[string]bool)
+	for _, item := range (&models.OPM1560BDeviceData{}).Items() {
+		_, numeric[item.Item] = item.Value.(float64)
+	}
+	for key, r := range ranges {
+		isNumeric, known := numeric[key]
+		switch {
+		case !known:
+			return fmt.Errorf("未知检测项：%s", key)
+		case isNumeric && (r.Min == nil || r.Max == nil):
+			return fmt.Errorf("%s 须同时配置min/max", key)
+		case isNumeric && *r.Min >= *r.Max:
+			return fmt.Errorf("%s 的min(%v)须小于max(%v)", key, *r.Min, *r.Max)
+		case isNumeric && len(r.Allowed) > 0:
+			return fmt.Errorf("%s 为数值项，不支持allowed", key)
+		case !isNumeric && (r.Min != nil || r.Max != nil):
+			return fmt.Errorf("%s 为等级项，不支持min/max", key)
+		case !isNumeric && len(r.Allowed) == 0:
+			return fmt.Errorf("%s 须配置allowed允许值", key)
+		}
+	}
+	return nil
+}
+
+// validateNumericProxy 校验数值代理阶梯：检测项须为已知等级项，且须覆盖该项全部等级
+func validateNumericProxy(ladders map[string]map[string]float64) error {
+	graded := make(map[string]bool)
+	for _, item := range (&models.OPM1560BDeviceData{}).Items() {
+		_, graded[item.Item] = item.Value.(string)
+	}
+	for key, ladder := range ladders {
+		isGraded, known := graded[key]
+		switch {
+		case !known:
+			return fmt.Errorf("未知检测项：%s", key)
+		case !isGraded:
+			return fmt.Errorf("%s 为数值项，不支持数值代理", key)
+		}
+		for _, level := range models.LevelsFor(key) {
+			if _, ok := ladder[level]; !ok {
+				return fmt.Errorf("%s 的阶梯缺少等级%s", key, level)
+			}
+		}
+	}
+	return nil
+}
+
+// containsString 字符串是否在列表中
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
 
 // overrideByEnv 环境变量覆盖配置，格式：OPM_模块_字段（如OPM_SERIAL_PORT=/dev/ttyUSB1）
 func overrideByEnv(cfg *Config) {
+	overrideSharedByEnv(cfg)
 	// 设备配置
 	if v := os.Getenv("OPM_DEVICE_DEVICEID"); v != "" {
 		cfg.Device.DeviceID = v
@@ -196,6 +505,17 @@ func overrideByEnv(cfg *Config) {
 			cfg.Serial.BaudRate = br
 		}
 	}
+}
+
+// overrideSharedByEnv 环境变量覆盖各设备共用的配置（多设备模式下设备/串口环境变量无对应设备，不生效）
+func overrideSharedByEnv(cfg *Config) {
+	// 应用配置（自助登录终端写入当前操作员/班次）
+	if v := os.Getenv("OPM_APP_OPERATORID"); v != "" {
+		cfg.App.OperatorID = v
+	}
+	if v := os.Getenv("OPM_APP_SHIFTID"); v != "" {
+		cfg.App.ShiftID = v
+	}
 	// MQTT核心配置
 	if v := os.Getenv("OPM_MQTT_BROKER"); v != "" {
 		cfg.MQTT.Broker = v
@@ -210,15 +530,78 @@ func overrideByEnv(cfg *Config) {
 
 // validateHardwareConfig OPM-1560B硬件强约束校验（非法配置直接返回错误）
 func validateHardwareConfig(cfg *Config) error {
+	// 0. 应用配置校验
+	if cfg.App.MinSampleIntervalMs < 0 {
+		return errors.New("app.min_sample_interval_ms 不能为负数")
+	}
+	if cfg.App.ExpectedGapSec < 0 {
+		return errors.New("app.expected_gap_sec 不能为负数")
+	}
+	if _, _, err := ParseActiveHours(cfg.App.ActiveHours); err != nil {
+		return fmt.Errorf("app.active_hours 非法：%w", err)
+	}
+	if cfg.App.HeartbeatSec < 0 {
+		return errors.New("app.heartbeat_sec 不能为负数")
+	}
+	if cfg.App.LinkQualityWindowHours < 0 {
+		return errors.New("app.link_quality_window_hours 不能为负数")
+	}
+	if cfg.App.ParseWorkers < 0 {
+		return errors.New("app.parse_workers 不能为负数")
+	}
+	if cfg.App.CheckSampleAgeSec < 0 {
+		return errors.New("app.check_sample_age_sec 不能为负数")
+	}
+	reserved := models.EnvelopeKeys()
+	for k := range cfg.App.Tags {
+		if k == "" {
+			return errors.New("app.tags 键不能为空")
+		}
+		if containsString(reserved, k) {
+			return fmt.Errorf("app.tags 键 %q 与消息信封字段重名", k)
+		}
+	}
+	if cfg.App.DailySummaryAt != "" {
+		if _, err := ParseClock(cfg.App.DailySummaryAt); err != nil {
+			return fmt.Errorf("app.daily_summary_at 非法：%w", err)
+		}
+	}
+	if _, err := time.LoadLocation(cfg.App.Timezone); err != nil {
+		return fmt.Errorf("app.timezone 非法：%w", err)
+	}
+	if cfg.App.EnvironmentInTopic && cfg.App.Environment == "" {
+		return errors.New("app.environment_in_topic 开启时 app.environment 不能为空")
+	}
+	if len(cfg.App.AllowedEnvironments) > 0 && !containsString(cfg.App.AllowedEnvironments, cfg.App.Environment) {
+		return fmt.Errorf("app.environment 非法：%q 不在允许列表%v中", cfg.App.Environment, cfg.App.AllowedEnvironments)
+	}
+
 	// 1. 设备校验：SN编号为必填项（出厂固化，唯一标识）
 	if cfg.Device.DeviceID == "" {
 		return errors.New("device.device_id 为必填项（请填写设备出厂SN编号）")
 	}
 
 	// 2. 串口校验（硬件固化约束，不可突破）
-	if cfg.Serial.Port == "" {
+	if cfg.Serial.Port == "" && cfg.Serial.ReplayFile == "" {
 		return errors.New("serial.port 为必填项（Linux:/dev/ttyUSBx，Windows:COMx）")
 	}
+	if strings.HasPrefix(cfg.Serial.Port, AutoPortPrefix) {
+		if _, _, err := ParseAutoPort(cfg.Serial.Port); err != nil {
+			return fmt.Errorf("serial.port 非法：%w", err)
+		}
+	}
+	if cfg.Serial.SilenceTimeoutS < 0 {
+		return errors.New("serial.silence_timeout_s 不能为负数")
+	}
+	if cfg.Serial.MaxFrameBytes < cfg.Parser.FrameMaxLen {
+		return errors.New("serial.max_frame_bytes 不得小于parser.frame_max_len")
+	}
+	if cfg.Serial.CaptureMaxMB < 0 || cfg.Serial.CaptureMaxBackups < 0 {
+		return errors.New("serial.capture_max_mb/capture_max_backups 不能为负数")
+	}
+	if cfg.Serial.ReplayIntervalMs < 0 {
+		return errors.New("serial.replay_interval_ms 不能为负数")
+	}
 	if cfg.Serial.BaudRate != 9600 && cfg.Serial.BaudRate != 19200 {
 		return errors.New("serial.baud_rate 仅支持9600/19200（OPM-1560B硬件固化）")
 	}
@@ -228,6 +611,24 @@ func validateHardwareConfig(cfg *Config) error {
 	if cfg.Serial.StopBits != 1 {
 		return errors.New("serial.stop_bits 必须为1（OPM-1560B硬件固化，不可修改）")
 	}
+	if cfg.Serial.ReadChunkSize < 16 || cfg.Serial.ReadChunkSize > 4096 {
+		return errors.New("serial.read_chunk_size 须在16-4096之间")
+	}
+	if cfg.Serial.MaxDrain < cfg.Serial.ReadChunkSize {
+		return errors.New("serial.max_drain 不得小于read_chunk_size（单次读缓冲大小）")
+	}
+	if cfg.Serial.DupWindowMs < 0 {
+		return errors.New("serial.dup_window_ms 不能为负数")
+	}
+	if cfg.Serial.HandshakeTimeoutSec < 0 {
+		return errors.New("serial.handshake_timeout_sec 不能为负数")
+	}
+	if cfg.Serial.DiscardFirstFrames < 0 {
+		return errors.New("serial.discard_first_frames 不能为负数")
+	}
+	if cfg.Serial.FrameGapMs < 0 {
+		return errors.New("serial.frame_gap_ms 不能为负数")
+	}
 
 	// 3. MQTT校验
 	if cfg.MQTT.Broker == "" {
@@ -236,6 +637,34 @@ func validateHardwareConfig(cfg *Config) error {
 	if cfg.MQTT.QoS < 0 || cfg.MQTT.QoS > 2 {
 		return errors.New("mqtt.qos 仅支持0/1/2（推荐1，医用数据不丢失）")
 	}
+	if cfg.MQTT.MinStateIntervalSec < 0 {
+		return errors.New("mqtt.min_state_interval_sec 不能为负数")
+	}
+	if cfg.MQTT.BreakerThreshold < 0 || cfg.MQTT.BreakerCooldownSec < 0 {
+		return errors.New("mqtt.breaker_threshold/breaker_cooldown_sec 不能为负数")
+	}
+	if cfg.MQTT.ReconnectWatchdogMult < 0 {
+		return errors.New("mqtt.reconnect_watchdog_mult 不能为负数")
+	}
+	// 重连协程两次心跳之间最长为一次连接等待（+重连间隔），卡死判定时长不大于此值会把正常重连误判为卡死
+	if stall := time.Duration(cfg.MQTT.ReconnectWatchdogMult*cfg.MQTT.ReconnectInt) * time.Second; cfg.MQTT.ReconnectWatchdogMult > 0 &&
+		stall <= MQTTConnectTimeout+time.Duration(cfg.MQTT.ReconnectInt)*time.Second {
+		return fmt.Errorf("mqtt.reconnect_watchdog_mult×reconnect_int（%v）须大于单次连接等待上限%v+reconnect_int", stall, MQTTConnectTimeout)
+	}
+	switch cfg.MQTT.PerItemTopics {
+	case "", PerItemAlso, PerItemOnly:
+	default:
+		return errors.New("mqtt.per_item_topics 仅支持空/also/only")
+	}
+	if cfg.MQTT.SpoolMaxMessages < 0 {
+		return errors.New("mqtt.spool_max_messages 不能为负数")
+	}
+	if cfg.MQTT.SpoolMaxMB < 0 {
+		return errors.New("mqtt.spool_max_mb 不能为负数")
+	}
+	if (cfg.MQTT.TLSCert == "") != (cfg.MQTT.TLSKey == "") {
+		return errors.New("mqtt.tls_cert 与 mqtt.tls_key 须同时配置")
+	}
 
 	// 4. 解析器校验（硬件帧格式约束）
 	if _, err := hexStrToBytes(cfg.Parser.FrameStart); err != nil {
@@ -250,8 +679,31 @@ func validateHardwareConfig(cfg *Config) error {
 	if cfg.Parser.FrameMinLen < 16 {
 		return errors.New("parser.frame_min_len 最小16字节（OPM-1560B硬件帧格式）")
 	}
+	if cfg.Parser.FrameMaxLen < cfg.Parser.FrameMinLen {
+		return errors.New("parser.frame_max_len 不得小于frame_min_len")
+	}
+	if cfg.Parser.RawEncoding != models.RawEncodingHex && cfg.Parser.RawEncoding != models.RawEncodingBase64 {
+		return errors.New("parser.raw_encoding 仅支持hex/base64")
+	}
+	if err := validateReferenceRanges(cfg.Parser.ReferenceRanges); err != nil {
+		return fmt.Errorf("parser.reference_ranges 非法：%w", err)
+	}
+	if err := validateNumericProxy(cfg.Parser.NumericProxy); err != nil {
+		return fmt.Errorf("parser.numeric_proxy 非法：%w", err)
+	}
+	if cfg.Parser.ResyncAfterFailures < 0 {
+		return errors.New("parser.resync_after_failures 不能为负数")
+	}
+
+	// 5. 附加输出校验
+	if cfg.Sinks.Quarantine.MaxMB < 0 || cfg.Sinks.Quarantine.MaxBackups < 0 {
+		return errors.New("sinks.quarantine.max_mb/max_backups 不能为负数")
+	}
 
-	// 5. 日志级别校验
+	if cfg.Log.CoalesceWindowSec < 0 {
+		return errors.New("log.coalesce_window_sec 不能为负数")
+	}
+	// 6. 日志级别校验
 	validLevels := map[string]bool{"INFO": true, "WARN": true, "ERROR": true, "FATAL": true}
 	if !validLevels[cfg.Log.Level] {
 		return errors.New("log.level 仅支持INFO/WARN/ERROR/FATAL")
@@ -260,6 +712,157 @@ func validateHardwareConfig(cfg *Config) error {
 	return nil
 }
 
+// expandUnits 将多设备列表展开为各设备独立配置（逐台补默认值/校验，device_id与串口不得重复）
+func expandUnits(raw *Config) ([]*Config, error) {
+	switch raw.MQTT.MultiDeviceConnection {
+	case "":
+		raw.MQTT.MultiDeviceConnection = ConnPerDevice
+	case ConnPerDevice, ConnShared:
+	default:
+		return nil, fmt.Errorf("mqtt.multi_device_connection 非法：%q，仅支持%s/%s",
+			raw.MQTT.MultiDeviceConnection, ConnPerDevice, ConnShared)
+	}
+	if raw.MQTT.WillTopic != "" && raw.MQTT.MultiDeviceConnection == ConnPerDevice {
+		return nil, errors.New("mqtt.will_topic 在多设备per_device模式下须留空（按设备自动生成）")
+	}
+	units := make([]*Config, 0, len(raw.Devices))
+	seenID := make(map[string]bool)
+	seenPort := make(map[string]bool)
+	for i, d := range raw.Devices {
+		u := *raw
+		u.Devices = nil
+		u.Device, u.Serial = d.Device, d.Serial
+		if raw.MQTT.ClientID != "" && raw.MQTT.MultiDeviceConnection == ConnPerDevice {
+			u.MQTT.ClientID = raw.MQTT.ClientID + "-" + d.Device.DeviceID
+		}
+		setHardwareDefaults(&u)
+		overrideSharedByEnv(&u)
+		if raw.MQTT.MultiDeviceConnection == ConnPerDevice {
+			u.MQTT.LedgerHeadPath += "." + u.Device.DeviceID // 每条连接独立哈希链
+			if u.MQTT.SpoolDir != "" {
+				u.MQTT.SpoolDir = filepath.Join(u.MQTT.SpoolDir, u.Device.DeviceID) // 每条连接独立暂存队列
+			}
+		}
+		if err := validateHardwareConfig(&u); err != nil {
+			return nil, fmt.Errorf("devices[%d]：%w", i, err)
+		}
+		if seenID[u.Device.DeviceID] {
+			return nil, fmt.Errorf("devices[%d]：device.device_id %q 重复", i, u.Device.DeviceID)
+		}
+		seenID[u.Device.DeviceID] = true
+		if u.Serial.ReplayFile == "" {
+			if seenPort[u.Serial.Port] {
+				return nil, fmt.Errorf("devices[%d]：serial.port %q 重复", i, u.Serial.Port)
+			}
+			seenPort[u.Serial.Port] = true
+		}
+		units = append(units, &u)
+	}
+	if raw.MQTT.MultiDeviceConnection == ConnShared {
+		devices := make([]DeviceConfig, len(units))
+		for i, u := range units {
+			devices[i] = u.Device
+		}
+		for _, u := range units {
+			u.connDevices = devices
+		}
+	}
+	return units, nil
+}
+
+// Units 各设备的独立配置（多设备模式每台一份，单设备返回自身）
+func (c *Config) Units() []*Config {
+	if len(c.units) == 0 {
+		return []*Config{c}
+	}
+	return c.units
+}
+
+// ConnDevices 本设备MQTT连接承载的全部设备（shared模式为全部设备，否则仅本设备）
+func (c *Config) ConnDevices() []DeviceConfig {
+	if len(c.connDevices) == 0 {
+		return []DeviceConfig{c.Device}
+	}
+	return c.connDevices
+}
+
+// SharedConnection 多设备是否共用一条MQTT连接
+func (c *Config) SharedConnection() bool {
+	return len(c.units) > 1 && c.MQTT.MultiDeviceConnection == ConnShared
+}
+
+// secretMask 敏感字段脱敏占位符
+const secretMask = "******"
+
+// Summary 生效配置摘要（默认值/环境变量覆盖后的最终配置，密码等敏感字段脱敏，启动时留档审计）
+func (c *Config) Summary() string {
+	out, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return fmt.Sprintf("配置序列化失败：%v", err)
+	}
+	return string(out)
+}
+
+// Redacted 返回敏感字段脱敏后的配置副本（不修改原配置）
+func (c *Config) Redacted() *Config {
+	r := *c
+	if r.MQTT.Password != "" {
+		r.MQTT.Password = secretMask
+	}
+	return &r
+}
+
+// ParseActiveHours 解析工作时段（HH:MM-HH:MM），返回起止分钟数（当天0点起）；为空表示全天（0,0）
+func ParseActiveHours(s string) (startMin, endMin int, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, 0, nil
+	}
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return 0, 0, errors.New("格式应为HH:MM-HH:MM")
+	}
+	if startMin, err = ParseClock(parts[0]); err != nil {
+		return 0, 0, err
+	}
+	if endMin, err = ParseClock(parts[1]); err != nil {
+		return 0, 0, err
+	}
+	if startMin == endMin {
+		return 0, 0, errors.New("起止时间不能相同")
+	}
+	return startMin, endMin, nil
+}
+
+// AutoPortPrefix serial.port以该前缀开头时按USB VID/PID自动匹配串口（auto:VID:PID，如auto:1A86:7523）
+const AutoPortPrefix = "auto:"
+
+// ParseAutoPort 解析auto:VID:PID，返回大写的4位16进制VID/PID
+func ParseAutoPort(s string) (vid, pid string, err error) {
+	parts := strings.Split(strings.TrimPrefix(s, AutoPortPrefix), ":")
+	if !strings.HasPrefix(s, AutoPortPrefix) || len(parts) != 2 {
+		return "", "", fmt.Errorf("%q 格式应为auto:VID:PID", s)
+	}
+	for _, p := range parts {
+		if _, err := strconv.ParseUint(p, 16, 16); err != nil || len(p) != 4 {
+			return "", "", fmt.Errorf("%q 中VID/PID须为4位16进制", s)
+		}
+	}
+	return strings.ToUpper(parts[0]), strings.ToUpper(parts[1]), nil
+}
+
+// ParseClock 解析HH:MM为当天分钟数
+func ParseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d", &h, &m); err != nil {
+		return 0, fmt.Errorf("时间%q非法：%w", s, err)
+	}
+	if h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("时间%q超出范围", s)
+	}
+	return h*60 + m, nil
+}
+
 // 工具方法：16进制字符串转字节数组（帧头/帧尾解析）
 func hexStrToBytes(s string) ([]byte, error) {
 	s = strings.TrimSpace(s)
@@ -277,12 +880,22 @@ func hexStrToBytes(s string) ([]byte, error) {
 
 // GetFrameStart 全局快捷方法：获取帧头字节数组（避免各模块重复解析）
 func GetFrameStart() []byte {
-	b, _ := hexStrToBytes(GlobalConfig.Parser.FrameStart)
-	return b
+	return GlobalConfig.Parser.FrameStartBytes()
 }
 
 // GetFrameEnd 全局快捷方法：获取帧尾字节数组
 func GetFrameEnd() []byte {
-	b, _ := hexStrToBytes(GlobalConfig.Parser.FrameEnd)
+	return GlobalConfig.Parser.FrameEndBytes()
+}
+
+// FrameStartBytes 本配置的帧头字节数组（多设备模式按设备取，Load时已校验）
+func (p ParserConfig) FrameStartBytes() []byte {
+	b, _ := hexStrToBytes(p.FrameStart)
+	return b
+}
+
+// FrameEndBytes 本配置的帧尾字节数组
+func (p ParserConfig) FrameEndBytes() []byte {
+	b, _ := hexStrToBytes(p.FrameEnd)
 	return b
 }
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"opm-mqtt-gateway/internal/models"
+)
+
+// newTestConfig 构建已设置默认值的测试配置
+func newTestConfig() *Config {
+	cfg := &Config{
+		Device: DeviceConfig{DeviceID: "SN1234567890"},
+		Serial: SerialConfig{Port: "COM1"},
+		MQTT: MQTTConfig{
+			Broker:   "tcp://127.0.0.1:1883",
+			Username: "admin",
+			Password: "8SfPtX184y2yVhBg",
+		},
+	}
+	setHardwareDefaults(cfg)
+	return cfg
+}
+
+// TestSummary_RedactsSecrets 测试：配置摘要脱敏密码，且包含关键字段
+func TestSummary_RedactsSecrets(t *testing.T) {
+	cfg := newTestConfig()
+	summary := cfg.Summary()
+
+	if strings.Contains(summary, "8SfPtX184y2yVhBg") {
+		t.Fatalf("配置摘要泄露密码：\n%s", summary)
+	}
+	for _, want := range []string{"password: '******'", "device_id: SN1234567890", "port: COM1", "broker: tcp://127.0.0.1:1883", "username: admin", "baud_rate: 9600"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("配置摘要缺少%q：\n%s", want, summary)
+		}
+	}
+
+	// 脱敏不得修改原配置
+	if cfg.MQTT.Password != "8SfPtX184y2yVhBg" {
+		t.Errorf("脱敏修改了原配置密码：%s", cfg.MQTT.Password)
+	}
+}
+
+// TestEnvironment_TopicAndAllowedSet 测试：环境标识追加到主题前缀，且须在允许列表中
+func TestEnvironment_TopicAndAllowedSet(t *testing.T) {
+	cfg := &Config{
+		App:    AppConfig{Environment: "staging", EnvironmentInTopic: true, AllowedEnvironments: []string{"dev", "staging", "prod"}},
+		Device: DeviceConfig{DeviceID: "SN1234567890"},
+		Serial: SerialConfig{Port: "COM1"},
+		MQTT:   MQTTConfig{Broker: "tcp://127.0.0.1:1883"},
+	}
+	setHardwareDefaults(cfg)
+	if cfg.MQTT.TopicPrefix != "opm1560b/urine/analyzer/staging" {
+		t.Fatalf("主题前缀未追加环境标识：%s", cfg.MQTT.TopicPrefix)
+	}
+	if cfg.MQTT.WillTopic != "opm1560b/urine/analyzer/staging/SN1234567890/state" {
+		t.Fatalf("遗嘱主题未追加环境标识：%s", cfg.MQTT.WillTopic)
+	}
+	if err := validateHardwareConfig(cfg); err != nil {
+		t.Fatalf("合法环境标识校验失败：%v", err)
+	}
+
+	cfg.App.Environment = "prd"
+	if err := validateHardwareConfig(cfg); err == nil {
+		t.Fatalf("不在允许列表中的环境标识应校验失败")
+	}
+}
+
+// TestTags_ReservedKeyRejected 测试：静态标签键与信封字段重名时校验失败
+func TestTags_ReservedKeyRejected(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.App.Tags = map[string]string{"ward": "3F"}
+	if err := validateHardwareConfig(cfg); err != nil {
+		t.Fatalf("合法标签校验失败：%v", err)
+	}
+
+	cfg.App.Tags["device_id"] = "X"
+	if err := validateHardwareConfig(cfg); err == nil {
+		t.Fatalf("与信封字段重名的标签应校验失败")
+	}
+}
+
+// TestReferenceRanges_Validate 测试：参考范围min须小于max，等级项须配置允许值，未知检测项拒绝
+func TestReferenceRanges_Validate(t *testing.T) {
+	bound := func(v float64) *float64 { return &v }
+	cases := []struct {
+		name   string
+		ranges map[string]models.ReferenceRange
+		ok     bool
+	}{
+		{"合法", map[string]models.ReferenceRange{"ph": {Min: bound(5), Max: bound(8)}, "protein": {Allowed: []string{"-"}}}, true},
+		{"min等于max", map[string]models.ReferenceRange{"ph": {Min: bound(7), Max: bound(7)}}, false},
+		{"min大于max", map[string]models.ReferenceRange{"specific_grav": {Min: bound(1.03), Max: bound(1.005)}}, false},
+		{"缺max", map[string]models.ReferenceRange{"ph": {Min: bound(5)}}, false},
+		{"等级项无允许值", map[string]models.ReferenceRange{"protein": {}}, false},
+		{"未知检测项", map[string]models.ReferenceRange{"glu": {Allowed: []string{"-"}}}, false},
+	}
+	for _, c := range cases {
+		cfg := newTestConfig()
+		cfg.Parser.ReferenceRanges = c.ranges
+		if err := validateHardwareConfig(cfg); (err == nil) != c.ok {
+			t.Errorf("%s：校验结果%v，预期通过=%v", c.name, err, c.ok)
+		}
+	}
+}
+
+// TestNumericProxy_Validate 测试：数值代理阶梯须覆盖全部等级，数值项/未知项拒绝，开启且未配置时使用内置阶梯
+func TestNumericProxy_Validate(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Parser.EmitNumericProxy = true
+	setHardwareDefaults(cfg)
+	if err := validateHardwareConfig(cfg); err != nil || len(cfg.Parser.NumericProxy) == 0 {
+		t.Fatalf("内置阶梯应生效且校验通过：%v", err)
+	}
+
+	cases := []struct {
+		name   string
+		ladder map[string]map[string]float64
+	}{
+		{"缺少等级", map[string]map[string]float64{"protein": {"-": 0, "+": 30}}},
+		{"数值项", map[string]map[string]float64{"ph": {"-": 0}}},
+		{"未知项", map[string]map[string]float64{"albumin": {"-": 0}}},
+	}
+	for _, c := range cases {
+		cfg.Parser.NumericProxy = c.ladder
+		if err := validateHardwareConfig(cfg); err == nil {
+			t.Errorf("%s：应校验失败", c.name)
+		}
+	}
+	cfg.Parser.NumericProxy = map[string]map[string]float64{"nitrite": {"-": 0, "+": 1}}
+	if err := validateHardwareConfig(cfg); err != nil {
+		t.Fatalf("亚硝酸盐仅需覆盖-/+：%v", err)
+	}
+}
+
+// TestParseAutoPort 测试：auto:VID:PID须为两段4位16进制，结果统一大写
+func TestParseAutoPort(t *testing.T) {
+	vid, pid, err := ParseAutoPort("auto:1a86:7523")
+	if err != nil || vid != "1A86" || pid != "7523" {
+		t.Fatalf("解析错误：%s:%s，%v", vid, pid, err)
+	}
+	for _, s := range []string{"auto:1A86", "auto:1A86:75", "auto:ZZZZ:7523", "auto:1A86:7523:00"} {
+		if _, _, err := ParseAutoPort(s); err == nil {
+			t.Errorf("%s 应解析失败", s)
+		}
+	}
+}
+
+// TestExpandUnits 测试：多设备逐台展开（独立客户端ID/遗嘱主题/串口默认值），device_id重复时校验失败
+func TestExpandUnits(t *testing.T) {
+	raw := &Config{
+		MQTT: MQTTConfig{Broker: "tcp://127.0.0.1:1883", ClientID: "gw", SpoolDir: "data/spool"},
+		Devices: []DeviceUnit{
+			{Device: DeviceConfig{DeviceID: "SN-A"}, Serial: SerialConfig{Port: "COM1"}},
+			{Device: DeviceConfig{DeviceID: "SN-B"}, Serial: SerialConfig{Port: "COM2", BaudRate: 19200}},
+		},
+	}
+	units, err := expandUnits(raw)
+	if err != nil {
+		t.Fatalf("合法多设备配置展开失败：%v", err)
+	}
+	if len(units) != 2 {
+		t.Fatalf("展开设备数错误：期望2，实际%d", len(units))
+	}
+	if units[0].MQTT.ClientID != "gw-SN-A" || units[1].MQTT.ClientID != "gw-SN-B" {
+		t.Fatalf("per_device模式客户端ID错误：%s / %s", units[0].MQTT.ClientID, units[1].MQTT.ClientID)
+	}
+	if units[1].MQTT.WillTopic != "opm1560b/urine/analyzer/SN-B/state" {
+		t.Fatalf("遗嘱主题未按设备生成：%s", units[1].MQTT.WillTopic)
+	}
+	if units[0].MQTT.LedgerHeadPath != "data/ledger.head.SN-A" {
+		t.Fatalf("per_device模式哈希链链头文件未按设备区分：%s", units[0].MQTT.LedgerHeadPath)
+	}
+	if units[1].MQTT.SpoolDir != filepath.Join("data/spool", "SN-B") {
+		t.Fatalf("per_device模式离线暂存目录未按设备区分：%s", units[1].MQTT.SpoolDir)
+	}
+	if units[0].Serial.BaudRate != 9600 || units[1].Serial.BaudRate != 19200 {
+		t.Fatalf("串口默认值/配置值错误：%d / %d", units[0].Serial.BaudRate, units[1].Serial.BaudRate)
+	}
+	if len(units[0].Units()) != 1 || units[0].Units()[0] != units[0] {
+		t.Fatalf("展开后的单设备配置Units应返回自身")
+	}
+	if d := units[1].ConnDevices(); len(d) != 1 || d[0].DeviceID != "SN-B" {
+		t.Fatalf("per_device模式连接仅承载本设备：%+v", d)
+	}
+
+	raw.MQTT.MultiDeviceConnection = ConnShared
+	shared, err := expandUnits(raw)
+	if err != nil {
+		t.Fatalf("shared模式展开失败：%v", err)
+	}
+	if d := shared[0].ConnDevices(); len(d) != 2 || d[0].DeviceID != "SN-A" || d[1].DeviceID != "SN-B" {
+		t.Fatalf("shared模式连接应承载全部设备：%+v", d)
+	}
+	raw.MQTT.MultiDeviceConnection = ConnPerDevice
+
+	raw.Devices[1].Device.DeviceID = "SN-A"
+	if _, err := expandUnits(raw); err == nil {
+		t.Fatalf("device_id重复应校验失败")
+	}
+	raw.Devices[1].Device.DeviceID = "SN-B"
+	raw.MQTT.MultiDeviceConnection = "pooled"
+	if _, err := expandUnits(raw); err == nil {
+		t.Fatalf("非法连接模式应校验失败")
+	}
+}
+
+// TestTLS_CertKeyPair 测试：客户端证书与私钥须同时配置
+func TestTLS_CertKeyPair(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.MQTT.Broker = "tls://127.0.0.1:8883"
+	cfg.MQTT.TLSCert = "certs/client.pem"
+	if err := validateHardwareConfig(cfg); err == nil {
+		t.Fatalf("仅配置tls_cert应校验失败")
+	}
+	cfg.MQTT.TLSKey = "certs/client.key"
+	if err := validateHardwareConfig(cfg); err != nil {
+		t.Fatalf("证书与私钥同时配置校验失败：%v", err)
+	}
+}
+
+// TestReconnectWatchdog_StallExceedsConnectTimeout 测试：看门狗卡死判定时长须大于单次连接等待上限+重连间隔
+func TestReconnectWatchdog_StallExceedsConnectTimeout(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.MQTT.ReconnectInt = 2
+	cfg.MQTT.ReconnectWatchdogMult = 5 // 10s，小于一次连接等待
+	if err := validateHardwareConfig(cfg); err == nil {
+		t.Fatalf("卡死判定时长不足一次连接等待应校验失败")
+	}
+	cfg.MQTT.ReconnectWatchdogMult = 20 // 40s
+	if err := validateHardwareConfig(cfg); err != nil {
+		t.Fatalf("卡死判定时长充足时校验失败：%v", err)
+	}
+}
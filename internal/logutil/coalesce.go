@@ -0,0 +1,79 @@
+package logutil
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// logTimePrefix log包默认时间前缀（日期+时间，可带微秒），比较日志内容时忽略
+var logTimePrefix = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(\.\d+)? `)
+
+// CoalesceWriter 日志合并输出：窗口内连续相同的日志只输出首条，其余计数，
+// 内容变化或窗口结束时补一行"重复N次"汇总（串口线缆抖动时避免刷屏）
+type CoalesceWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	window  time.Duration    // 合并窗口（从首条开始计时）
+	last    string           // 上一条日志内容（去除时间前缀）
+	firstAt time.Time        // 本轮首条输出时间
+	repeats int              // 本轮被合并的条数
+	now     func() time.Time // 时钟（测试可替换）
+}
+
+// NewCoalesceWriter 包装日志输出（log.SetOutput使用，所有模块统一生效）
+func NewCoalesceWriter(w io.Writer, window time.Duration) *CoalesceWriter {
+	return &CoalesceWriter{w: w, window: window, now: time.Now}
+}
+
+// Write 相同内容在窗口内合并，否则先输出上一轮汇总再输出本条
+func (c *CoalesceWriter) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	key := logTimePrefix.ReplaceAllString(string(b), "")
+	if key == c.last && now.Sub(c.firstAt) < c.window {
+		c.repeats++
+		return len(b), nil
+	}
+	if err := c.flush(); err != nil {
+		return 0, err
+	}
+	c.last, c.firstAt = key, now
+	if _, err := c.w.Write(b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush 输出未汇总的重复计数（程序退出前调用）
+func (c *CoalesceWriter) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush()
+}
+
+// FlushExpired 合并窗口已结束时输出未汇总的重复计数（定时调用，重复日志停止后汇总不会一直滞留）
+func (c *CoalesceWriter) FlushExpired() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.now().Sub(c.firstAt) < c.window {
+		return nil
+	}
+	return c.flush()
+}
+
+// flush 输出本轮重复汇总（调用方需持有c.mu）
+func (c *CoalesceWriter) flush() error {
+	if c.repeats == 0 {
+		return nil
+	}
+	line := fmt.Sprintf("%s [INFO] [log] 上一条日志在%v内重复%d次：%s",
+		c.now().Format("2006/01/02 15:04:05"), c.window, c.repeats, c.last)
+	c.repeats = 0
+	_, err := io.WriteString(c.w, line)
+	return err
+}
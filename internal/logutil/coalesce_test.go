@@ -0,0 +1,77 @@
+package logutil
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCoalesceWriter_RepeatedLines 测试：窗口内连续相同日志合并为一条，内容变化时输出重复次数汇总
+func TestCoalesceWriter_RepeatedLines(t *testing.T) {
+	var buf bytes.Buffer
+	cw := NewCoalesceWriter(&buf, time.Minute)
+	now := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	cw.now = func() time.Time { return now }
+	logger := log.New(cw, "", log.Ldate|log.Ltime)
+
+	for i := 0; i < 100; i++ {
+		logger.Printf("[ERROR] [serial] 读数据失败：input/output error，标记断开")
+	}
+	logger.Printf("[INFO] [serial] 串口重连成功：COM1")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("合并后应输出3行（首条+汇总+新日志），实际%d行：\n%s", len(lines), buf.String())
+	}
+	if !strings.Contains(lines[1], "重复99次") || !strings.Contains(lines[1], "读数据失败") {
+		t.Errorf("汇总行错误：%s", lines[1])
+	}
+	if !strings.Contains(lines[2], "串口重连成功") {
+		t.Errorf("新日志未输出：%s", lines[2])
+	}
+}
+
+// TestCoalesceWriter_WindowExpiry 测试：超过窗口后相同日志重新输出（附带汇总），避免长时间无输出
+func TestCoalesceWriter_WindowExpiry(t *testing.T) {
+	var buf bytes.Buffer
+	cw := NewCoalesceWriter(&buf, time.Minute)
+	now := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	cw.now = func() time.Time { return now }
+	logger := log.New(cw, "", log.Ldate|log.Ltime)
+
+	logger.Printf("[WARN] [mqtt] 连接丢失")
+	logger.Printf("[WARN] [mqtt] 连接丢失")
+	now = now.Add(2 * time.Minute)
+	logger.Printf("[WARN] [mqtt] 连接丢失")
+
+	if n := strings.Count(buf.String(), "连接丢失"); n != 3 {
+		t.Fatalf("窗口结束后应输出汇总并重新输出日志，出现%d次：\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), "重复1次") {
+		t.Errorf("缺少重复汇总：\n%s", buf.String())
+	}
+}
+
+// TestCoalesceWriter_FlushExpired 测试：重复日志停止后，窗口结束时定时汇总输出，窗口内不提前输出
+func TestCoalesceWriter_FlushExpired(t *testing.T) {
+	var buf bytes.Buffer
+	cw := NewCoalesceWriter(&buf, time.Minute)
+	now := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	cw.now = func() time.Time { return now }
+	logger := log.New(cw, "", log.Ldate|log.Ltime)
+
+	for i := 0; i < 5; i++ {
+		logger.Printf("[WARN] [mqtt] 连接丢失")
+	}
+	cw.FlushExpired()
+	if strings.Contains(buf.String(), "重复") {
+		t.Fatalf("窗口内不应输出汇总：\n%s", buf.String())
+	}
+	now = now.Add(time.Minute)
+	cw.FlushExpired()
+	if !strings.Contains(buf.String(), "重复4次") {
+		t.Fatalf("窗口结束后应输出汇总：\n%s", buf.String())
+	}
+}
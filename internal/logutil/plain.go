@@ -0,0 +1,73 @@
+package logutil
+
+import (
+	"io"
+	"strings"
+)
+
+// PlainWriter 纯文本日志输出：去除emoji及装饰符号（保留中文等正文），兼容不支持多字节符号的日志采集器
+type PlainWriter struct {
+	w io.Writer
+}
+
+// NewPlainWriter 包装日志输出（log.SetOutput使用，所有模块统一生效）
+func NewPlainWriter(w io.Writer) *PlainWriter {
+	return &PlainWriter{w: w}
+}
+
+// Write 去除装饰符号后写入；返回值按原始长度，避免log包误判为短写
+func (p *PlainWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(p.w, StripDecoration(string(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// StripDecoration 去除emoji、杂项符号/箭头/装饰符及其变体选择符；
+// 仅收敛被去除符号两侧的空格（两侧均为空格时保留一个，行首/行尾/标点旁不留空格），正文中的其它空格原样保留
+func StripDecoration(s string) string {
+	runes := []rune(s)
+	var sb strings.Builder
+	sb.Grow(len(s))
+	stripped := false
+	for i := 0; i < len(runes); i++ {
+		if !isDecoration(runes[i]) {
+			sb.WriteRune(runes[i])
+			continue
+		}
+		stripped = true
+		for i+1 < len(runes) && isDecoration(runes[i+1]) {
+			i++
+		}
+		out := sb.String()
+		leftSpace := strings.HasSuffix(out, " ")
+		rightSpace := i+1 < len(runes) && runes[i+1] == ' '
+		lineStart := out == "" || strings.HasSuffix(out, "\n")
+		switch {
+		case leftSpace && rightSpace, rightSpace && lineStart:
+			i++ // 去除右侧空格
+		case leftSpace:
+			sb.Reset()
+			sb.WriteString(out[:len(out)-1]) // 去除左侧空格
+		}
+	}
+	if !stripped {
+		return s
+	}
+	return sb.String()
+}
+
+// isDecoration 是否为装饰符号（emoji/杂项符号/丁巴特/零宽连接符/变体选择符）
+func isDecoration(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF: // emoji、扑克/麻将、补充符号与象形文字
+		return true
+	case r >= 0x2600 && r <= 0x27BF: // 杂项符号、丁巴特（✅❌⚠等）
+		return true
+	case r >= 0x2B00 && r <= 0x2BFF: // 杂项符号和箭头（⭐⬆等）
+		return true
+	case r == 0x200D || (r >= 0xFE00 && r <= 0xFE0F): // 零宽连接符、变体选择符
+		return true
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package logutil
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+// TestPlainWriter_StripsEmoji 测试：纯文本模式去除emoji，保留中文正文
+func TestPlainWriter_StripsEmoji(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(NewPlainWriter(&buf), "", 0)
+
+	logger.Printf("✅ [INFO] [mqtt] 连接成功 🚀，服务端：%s ⚠️", "tcp://127.0.0.1:1883")
+	want := "[INFO] [mqtt] 连接成功，服务端：tcp://127.0.0.1:1883\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("emoji未去除，预期%q，实际%q", want, got)
+	}
+}
+
+// TestStripDecoration_NoChange 测试：无装饰符号的日志原样输出
+func TestStripDecoration_NoChange(t *testing.T) {
+	s := "[WARN] [serial] 静默2s超过帧间超时，丢弃残留半帧：aa05  20"
+	if got := StripDecoration(s); got != s {
+		t.Fatalf("无装饰符号日志被修改：%q", got)
+	}
+}
+
+// TestStripDecoration_KeepsOtherSpaces 测试：仅收敛被去除符号两侧的空格，正文中的连续空格原样保留
+func TestStripDecoration_KeepsOtherSpaces(t *testing.T) {
+	cases := map[string]string{
+		"⚠️ [WARN] [serial] 丢弃残留半帧：aa05  20": "[WARN] [serial] 丢弃残留半帧：aa05  20",
+		"[INFO] 状态 ✅ 正常，帧：aa  55":            "[INFO] 状态 正常，帧：aa  55",
+		"[INFO] 完成✅ 下一步":                     "[INFO] 完成 下一步",
+	}
+	for in, want := range cases {
+		if got := StripDecoration(in); got != want {
+			t.Errorf("去除装饰符号结果错误：输入%q，预期%q，实际%q", in, want, got)
+		}
+	}
+}
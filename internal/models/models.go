@@ -1,7 +1,13 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -10,12 +16,20 @@ const (
 	// 校验方式
 	CheckTypeSum = "sum"
 	// MQTT消息类型
-	MQTTMsgTypeData  = "data"  // 检测数据上报
-	MQTTMsgTypeState = "state" // 设备状态上报
+	MQTTMsgTypeData    = "data"    // 检测数据上报
+	MQTTMsgTypeState   = "state"   // 设备状态上报
+	MQTTMsgTypeSummary = "summary" // 每日汇总上报
+	// MQTT下行命令
+	MQTTCmdSetOperator = "set_operator" // 修改当前操作员/班次
 	// 设备运行状态
-	DeviceStateOnline  = "online"
-	DeviceStateOffline = "offline"
-	DeviceStateError   = "error"
+	DeviceStateOnline    = "online"
+	DeviceStateOffline   = "offline"
+	DeviceStateError     = "error"
+	DeviceStateLocalOnly = "local_only" // 服务端拒绝认证，停止重连仅本地运行
+	// 设备状态告警原因
+	StateReasonSampleGap  = "sample_gap"     // 工作时段内长时间无样本
+	StateReasonAuthFailed = "auth_failed"    // MQTT服务端拒绝认证（用户名/密码错误或未授权）
+	StateReasonSilence    = "serial_silence" // 串口已打开但长时间未收到任何字节
 	// 检测数据状态（医用分级）
 	DataStateNormal   = "normal"   // 正常（值在医学合理范围）
 	DataStateAbnormal = "abnormal" // 异常（值超出范围）
@@ -23,8 +37,23 @@ const (
 	// 医学合理范围（OPM-1560B检测项参考）
 	PHMin, PHMax                     = 4.5, 8.0     // 酸碱度
 	SpecificGravMin, SpecificGravMax = 1.005, 1.030 // 比重
+	// 物理可能范围（超出即为BCD解码错误/数据损坏，而非临床异常）
+	PHPlausibleMin, PHPlausibleMax = 0.0, 14.0 // 酸碱度
+	SGPlausibleMin, SGPlausibleMax = 0.9, 1.2  // 比重
 )
 
+// StateChangeFunc 连接状态变化回调（old/new取值online/offline，reason为变化原因，如serial_read_error）
+// 供外部告警（Webhook/脚本）订阅串口与MQTT的连通性变化，无需解析MQTT消息
+type StateChangeFunc func(old, new, reason string)
+
+// ConnState 连接状态布尔值转设备状态字符串（online/offline）
+func ConnState(connected bool) string {
+	if connected {
+		return DeviceStateOnline
+	}
+	return DeviceStateOffline
+}
+
 // SerialFrame OPM-1560B串口原始帧模型（贴合硬件帧格式：AA+数据段+校验位+55）
 type SerialFrame struct {
 	Start    []byte `json:"start"`     // 帧头（0xAA）
@@ -37,33 +66,221 @@ type SerialFrame struct {
 
 // OPM1560BDeviceData OPM-1560B核心检测数据模型（贴合设备12项标配检测项，硬件数据段一一映射）
 type OPM1560BDeviceData struct {
-	DeviceID     string  `json:"device_id"`     // 设备出厂SN
-	DeviceModel  string  `json:"device_model"`  // 固定OPM-1560B
-	TestTime     string  `json:"test_time"`     // 检测时间（RFC3339，UTC）
-	PH           float64 `json:"ph"`            // 酸碱度（BCD码解析后浮点数）
-	Protein      string  `json:"protein"`       // 尿蛋白（-/+/±/++/+++/++++）
-	Glucose      string  `json:"glucose"`       // 葡萄糖（同尿蛋白编码）
-	Ketone       string  `json:"ketone"`        // 酮体（同尿蛋白编码）
-	OccultBlood  string  `json:"occult_blood"`  // 隐血（同尿蛋白编码）
-	Leukocyte    string  `json:"leukocyte"`     // 白细胞（同尿蛋白编码）
-	Erythrocyte  string  `json:"erythrocyte"`   // 红细胞（同尿蛋白编码）
-	Urobilinogen string  `json:"urobilinogen"`  // 尿胆原（同尿蛋白编码）
-	Bilirubin    string  `json:"bilirubin"`     // 胆红素（同尿蛋白编码）
-	Nitrite      string  `json:"nitrite"`       // 亚硝酸盐（-/+/invalid）
-	SpecificGrav float64 `json:"specific_grav"` // 比重（BCD码解析后浮点数）
-	VC           string  `json:"vc"`            // 维生素C（同尿蛋白编码）
-	DataState    string  `json:"data_state"`    // 数据状态：normal/abnormal/invalid
-	RawFrameHex  string  `json:"raw_frame_hex"` // 原始帧16进制字符串（调试/溯源）
+	DeviceID     string  `json:"device_id"`               // 设备出厂SN
+	DeviceModel  string  `json:"device_model"`            // 固定OPM-1560B
+	TestTime     string  `json:"test_time"`               // 检测时间（RFC3339，UTC）
+	PH           float64 `json:"ph"`                      // 酸碱度（BCD码解析后浮点数）
+	Protein      string  `json:"protein"`                 // 尿蛋白（-/+/±/++/+++/++++）
+	Glucose      string  `json:"glucose"`                 // 葡萄糖（同尿蛋白编码）
+	Ketone       string  `json:"ketone"`                  // 酮体（同尿蛋白编码）
+	OccultBlood  string  `json:"occult_blood"`            // 隐血（同尿蛋白编码）
+	Leukocyte    string  `json:"leukocyte"`               // 白细胞（同尿蛋白编码）
+	Erythrocyte  string  `json:"erythrocyte"`             // 红细胞（同尿蛋白编码）
+	Urobilinogen string  `json:"urobilinogen"`            // 尿胆原（同尿蛋白编码）
+	Bilirubin    string  `json:"bilirubin"`               // 胆红素（同尿蛋白编码）
+	Nitrite      string  `json:"nitrite"`                 // 亚硝酸盐（-/+/invalid）
+	SpecificGrav float64 `json:"specific_grav"`           // 比重（BCD码解析后浮点数）
+	VC           string  `json:"vc"`                      // 维生素C（同尿蛋白编码）
+	DataState    string  `json:"data_state"`              // 数据状态：normal/abnormal/invalid
+	RawFrameHex  string  `json:"raw_frame_hex,omitempty"` // 原始帧16进制字符串（调试/溯源，raw_encoding=hex）
+	// 原始帧base64字符串（raw_encoding=base64时替代raw_frame_hex，报文更紧凑）
+	RawFrameBase64 string `json:"raw_frame_base64,omitempty"`
+	// 各检测项对应的原始字节16进制（键同JSON字段名，如ph→0520），开启include_field_hex时输出
+	FieldHex map[string]string `json:"field_hex,omitempty"`
+	// 质量评分（0-100），开启quality_score时输出，评分规则见QualityScore
+	Quality *int `json:"quality,omitempty"`
+	// 等级项数值代理（键同JSON字段名，如protein→30，单位随阶梯配置），开启emit_numeric_proxy时输出；原等级值不变
+	NumericProxy map[string]float64 `json:"numeric_proxy,omitempty"`
+	// 检测项元数据（解码码表，键同JSON字段名），不进入汇总消息，分项消息按项附带
+	ItemMeta map[string]ItemMeta `json:"-"`
+}
+
+// ItemMeta 检测项元数据（名称/单位/参考范围/LOINC编码），来自解码码表
+type ItemMeta struct {
+	Name      string `yaml:"name" json:"name,omitempty"`           // 检测项名称
+	Unit      string `yaml:"unit" json:"unit,omitempty"`           // 单位（等级项为空）
+	Reference string `yaml:"reference" json:"reference,omitempty"` // 参考范围
+	LOINC     string `yaml:"loinc" json:"loinc,omitempty"`         // LOINC编码
 }
 
 // MQTTMessage 标准化MQTT上报模型（物联网平台通用格式，避免平台适配成本）
 type MQTTMessage struct {
-	DeviceID    string      `json:"device_id"`    // 设备SN
-	DeviceModel string      `json:"device_model"` // OPM-1560B
-	MsgType     string      `json:"msg_type"`     // data/state
-	Content     interface{} `json:"content"`      // 检测数据/设备状态
-	ReportTime  string      `json:"report_time"`  // 上报时间（RFC3339，UTC）
-	Version     string      `json:"version"`      // 消息版本，固定v1.0
+	DeviceID    string      `json:"device_id"`             // 设备SN
+	DeviceModel string      `json:"device_model"`          // OPM-1560B
+	MsgType     string      `json:"msg_type"`              // data/state
+	Content     interface{} `json:"content"`               // 检测数据/设备状态
+	ReportTime  string      `json:"report_time"`           // 上报时间（RFC3339，UTC）
+	Version     string      `json:"version"`               // 消息版本，固定v1.0
+	OperatorID  string      `json:"operator_id,omitempty"` // 当前操作员ID（未配置则不上报）
+	ShiftID     string      `json:"shift_id,omitempty"`    // 当前班次ID（未配置则不上报）
+	Environment string      `json:"environment,omitempty"` // 部署环境（dev/staging/prod，未配置则不上报）
+
+	Tags map[string]string `json:"-"` // 网关静态标签（病区/楼宇/资产编号），序列化时平铺到信封顶层
+}
+
+// EnvelopeKeys 消息信封保留字段名（静态标签不得与之重名）
+func EnvelopeKeys() []string {
+	var keys []string
+	t := reflect.TypeOf(MQTTMessage{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+// FrameFlags 帧提取/解析过程标记（串口层与解析器填写，质量评分扣分依据）
+type FrameFlags uint8
+
+const (
+	FrameChecksumUnverified FrameFlags = 1 << iota // 未做和校验（校验方式非sum），数据完整性无法确认
+	FrameRepaired                                  // 帧经过修补：静默超时后补全缺失的帧尾（serial.salvage_on_gap）
+)
+
+// Frame 串口层提取的完整帧（串口层→解析器），Flags记录提取过程中的修补
+type Frame struct {
+	Raw   []byte     // 原始帧字节（含帧头/校验位/帧尾）
+	Flags FrameFlags // 提取过程标记
+}
+
+// 质量评分扣分项（满分100，扣至0为止）
+const (
+	GradeInvalid                     = "invalid" // 编码超出码表的检测项结果
+	QualityPenaltyChecksumUnverified = 30        // 帧未经和校验，无法排除传输错误
+	QualityPenaltyRepaired           = 20        // 帧经过修补（补全帧尾），边界由推断得到
+	QualityPenaltyInvalidItem        = 15        // 每个无法解码的检测项（编码超出码表，疑似数据段损坏）
+)
+
+// QualityScore 启发式质量评分（0-100），只衡量数据可信度，不涉及临床正常/异常（PH/比重超出参考范围不扣分）：
+//   - 和校验：帧未经和校验扣30分
+//   - 修补：帧尾缺失后补全提交扣20分
+//   - 无效项：每个编码超出码表的检测项扣15分
+//
+// 检测时间由网关收帧时打标，不参与评分
+func (d *OPM1560BDeviceData) QualityScore(flags FrameFlags) int {
+	score := 100
+	if flags&FrameChecksumUnverified != 0 {
+		score -= QualityPenaltyChecksumUnverified
+	}
+	if flags&FrameRepaired != 0 {
+		score -= QualityPenaltyRepaired
+	}
+	for _, v := range []string{d.Protein, d.Glucose, d.Ketone, d.OccultBlood, d.Leukocyte,
+		d.Erythrocyte, d.Urobilinogen, d.Bilirubin, d.Nitrite, d.VC} {
+		if v == GradeInvalid {
+			score -= QualityPenaltyInvalidItem
+		}
+	}
+	if score < 0 {
+		score = 0
+	}
+	return score
+}
+
+// CheckPlausible 物理可能性校验：PH/比重超出物理可能范围标记为invalid（优先于abnormal）
+func (d *OPM1560BDeviceData) CheckPlausible() {
+	if d.PH < PHPlausibleMin || d.PH > PHPlausibleMax ||
+		d.SpecificGrav < SGPlausibleMin || d.SpecificGrav > SGPlausibleMax {
+		d.DataState = DataStateInvalid
+	}
+}
+
+// ItemValue 单个检测项消息（分项主题：前缀/device_id/data/<检测项>）
+type ItemValue struct {
+	DeviceID  string      `json:"device_id"`  // 设备SN
+	Item      string      `json:"item"`       // 检测项（同检测数据JSON字段名，如ph）
+	Value     interface{} `json:"value"`      // 检测值（数值项为浮点数，等级项为字符串）
+	TestTime  string      `json:"test_time"`  // 检测时间（RFC3339，UTC）
+	DataState string      `json:"data_state"` // 整体数据状态：normal/abnormal/invalid
+	ItemMeta              // 检测项元数据（名称/单位/参考范围/LOINC，码表未配置的字段不输出）
+}
+
+// Items 按硬件数据段顺序拆分为单项检测值（分项主题发布用）
+func (d *OPM1560BDeviceData) Items() []ItemValue {
+	values := []struct {
+		item  string
+		value interface{}
+	}{
+		{"ph", d.PH},
+		{"protein", d.Protein},
+		{"glucose", d.Glucose},
+		{"ketone", d.Ketone},
+		{"occult_blood", d.OccultBlood},
+		{"leukocyte", d.Leukocyte},
+		{"erythrocyte", d.Erythrocyte},
+		{"urobilinogen", d.Urobilinogen},
+		{"bilirubin", d.Bilirubin},
+		{"nitrite", d.Nitrite},
+		{"specific_grav", d.SpecificGrav},
+		{"vc", d.VC},
+	}
+	items := make([]ItemValue, 0, len(values))
+	for _, v := range values {
+		items = append(items, ItemValue{
+			DeviceID:  d.DeviceID,
+			Item:      v.item,
+			Value:     v.value,
+			TestTime:  d.TestTime,
+			DataState: d.DataState,
+			ItemMeta:  d.ItemMeta[v.item],
+		})
+	}
+	return items
+}
+
+// DeviceStateAlert 设备状态告警内容（state消息content，携带告警原因及明细）
+type DeviceStateAlert struct {
+	State  string `json:"state"`             // 设备状态：error
+	Reason string `json:"reason"`            // 告警原因：sample_gap等
+	GapSec int64  `json:"gap_sec,omitempty"` // 中断时长，单位秒（sample_gap无样本/serial_silence无数据）
+}
+
+// LedgerEntry 哈希链条目（主题：前缀/device_id/ledger），平台按序校验 Hash=LedgerHash(PrevHash, PayloadHash)
+type LedgerEntry struct {
+	Seq         uint64 `json:"seq"`          // 链序号（从1递增，断号即有消息丢失）
+	MsgID       string `json:"msg_id"`       // 消息ID（消息体sha256前16位，平台按此关联收到的消息）
+	DeviceID    string `json:"device_id"`    // 消息所属设备SN
+	Topic       string `json:"topic"`        // 消息发布主题
+	PrevHash    string `json:"prev_hash"`    // 前一条链哈希（首条为空）
+	PayloadHash string `json:"payload_hash"` // 本条消息体sha256（16进制）
+	Hash        string `json:"hash"`         // 本条链哈希
+	MsgType     string `json:"msg_type"`     // 对应消息类型：data/state
+	ReportTime  string `json:"report_time"`  // 对应消息上报时间
+}
+
+// LedgerHash 计算链哈希：sha256(前一条链哈希+本条消息体哈希)，16进制
+func LedgerHash(prevHash, payloadHash string) string {
+	sum := sha256.Sum256([]byte(prevHash + payloadHash))
+	return hex.EncodeToString(sum[:])
+}
+
+// DailySummaryContent 每日汇总内容（summary消息content，主题：前缀/device_id/summary）
+type DailySummaryContent struct {
+	PeriodStart string `json:"period_start"` // 统计周期起始（RFC3339，配置时区）
+	PeriodEnd   string `json:"period_end"`   // 统计周期结束（RFC3339，配置时区）
+	Samples     int    `json:"samples"`      // 样本数
+	Abnormal    int    `json:"abnormal"`     // 异常结果数
+	Invalid     int    `json:"invalid"`      // 无效结果数
+	DowntimeSec int64  `json:"downtime_sec"` // 设备串口离线时长，单位秒
+
+	Serial *LinkQualityContent `json:"serial,omitempty"` // 串口连接质量（开启连接质量统计时输出）
+	MQTT   *LinkQualityContent `json:"mqtt,omitempty"`   // MQTT连接质量（开启连接质量统计时输出）
+}
+
+// LinkQualityContent 连接质量（滚动窗口内的可用率/断开次数/平均无故障时间）
+type LinkQualityContent struct {
+	AvailabilityPct float64 `json:"availability_pct"`   // 可用率，百分比
+	Failures        int     `json:"failures"`           // 断开次数
+	MTBFSec         int64   `json:"mtbf_sec,omitempty"` // 平均无故障时间，单位秒（无断开时不输出）
+}
+
+// MQTTCommand 平台下行命令模型（主题：前缀/device_id/cmd）
+type MQTTCommand struct {
+	Cmd        string `json:"cmd"`         // 命令类型：set_operator
+	OperatorID string `json:"operator_id"` // 新操作员ID（set_operator）
+	ShiftID    string `json:"shift_id"`    // 新班次ID（set_operator）
 }
 
 // NewSerialFrame 新建串口原始帧实例（封装帧解析逻辑，避免重复代码）
@@ -88,15 +305,60 @@ func NewOPM1560BDeviceData(deviceID, model string) *OPM1560BDeviceData {
 	}
 }
 
-// CheckDataValid 校验检测数据医学有效性（核心：标记abnormal状态，贴合医用需求）
-func (d *OPM1560BDeviceData) CheckDataValid() {
-	// PH值超出合理范围
-	if d.PH < PHMin || d.PH > PHMax {
-		d.DataState = DataStateAbnormal
+// ReferenceRange 检测项参考范围：数值项（PH/比重）按Min/Max判定，等级项按Allowed允许值判定
+type ReferenceRange struct {
+	Min     *float64 `yaml:"min,omitempty"     json:"min,omitempty"`     // 数值项下限
+	Max     *float64 `yaml:"max,omitempty"     json:"max,omitempty"`     // 数值项上限
+	Allowed []string `yaml:"allowed,omitempty" json:"allowed,omitempty"` // 等级项允许值（如 -、±），其余视为异常
+}
+
+// DefaultReferenceRanges 内置参考范围（仅PH/比重，等级项默认不判定）
+func DefaultReferenceRanges() map[string]ReferenceRange {
+	bound := func(v float64) *float64 { return &v }
+	return map[string]ReferenceRange{
+		"ph":            {Min: bound(PHMin), Max: bound(PHMax)},
+		"specific_grav": {Min: bound(SpecificGravMin), Max: bound(SpecificGravMax)},
 	}
-	// 比重超出合理范围
-	if d.SpecificGrav < SpecificGravMin || d.SpecificGrav > SpecificGravMax {
-		d.DataState = DataStateAbnormal
+}
+
+// inRange 检测值是否在参考范围内
+func (r ReferenceRange) inRange(value interface{}) bool {
+	switch v := value.(type) {
+	case float64:
+		return (r.Min == nil || v >= *r.Min) && (r.Max == nil || v <= *r.Max)
+	case string:
+		if len(r.Allowed) == 0 || v == GradeInvalid {
+			return true // 无法解码的项由质量评分处理，不计为临床异常
+		}
+		for _, a := range r.Allowed {
+			if v == a {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// CheckDataValid 校验检测数据医学有效性（核心：标记abnormal状态，贴合医用需求），使用内置参考范围
+func (d *OPM1560BDeviceData) CheckDataValid() {
+	d.CheckDataValidRanges(nil)
+}
+
+// CheckDataValidRanges 按参考范围校验检测数据，任一项超出范围即标记abnormal；
+// ranges中未配置的检测项回落到内置参考范围
+func (d *OPM1560BDeviceData) CheckDataValidRanges(ranges map[string]ReferenceRange) {
+	defaults := DefaultReferenceRanges()
+	for _, item := range d.Items() {
+		r, ok := ranges[item.Item]
+		if !ok {
+			if r, ok = defaults[item.Item]; !ok {
+				continue
+			}
+		}
+		if !r.inRange(item.Value) {
+			d.DataState = DataStateAbnormal
+		}
 	}
 }
 
@@ -113,8 +375,40 @@ func NewMQTTMessage(deviceID, model, msgType string, content interface{}) *MQTTM
 }
 
 // ToJSON MQTT消息转JSON字节数组（MQTT发布专用，处理序列化错误）
+// 输出字节稳定：结构体按字段声明顺序、map按键名排序（encoding/json保证），
+// 同一逻辑结果多次序列化字节一致，可直接用于签名/HMAC与golden比对
+// 静态标签按键名排序追加在信封字段之后
 func (m *MQTTMessage) ToJSON() ([]byte, error) {
-	return json.Marshal(m)
+	out, err := json.Marshal(m)
+	if err != nil || len(m.Tags) == 0 {
+		return out, err
+	}
+	keys := make([]string, 0, len(m.Tags))
+	for k := range m.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out = out[:len(out)-1] // 去掉结尾的 }
+	for _, k := range keys {
+		kv, _ := json.Marshal(map[string]string{k: m.Tags[k]})
+		out = append(out, ',')
+		out = append(out, kv[1:len(kv)-1]...)
+	}
+	return append(out, '}'), nil
+}
+
+// 原始帧编码方式
+const (
+	RawEncodingHex    = "hex"    // 大写16进制（默认，兼容既有平台）
+	RawEncodingBase64 = "base64" // 标准base64
+)
+
+// RawStr 工具方法：按编码方式输出原始字节（hex为大写16进制，base64为标准base64）
+func RawStr(b []byte, enc string) string {
+	if enc == RawEncodingBase64 {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return strings.ToUpper(hex.EncodeToString(b))
 }
 
 // HexStr 工具方法：字节数组转16进制字符串（日志/调试用）
@@ -122,3 +416,43 @@ func HexStr(b []byte) string {
 	hex, _ := json.Marshal(b)
 	return string(hex[1 : len(hex)-1])
 }
+
+// GradeLevels 等级项全部等级（内置码表），数值代理阶梯须逐级覆盖
+var GradeLevels = []string{"-", "±", "+", "++", "+++", "++++"}
+
+// NitriteLevels 亚硝酸盐等级（仅阴/阳性）
+var NitriteLevels = []string{"-", "+"}
+
+// LevelsFor 检测项应覆盖的等级列表
+func LevelsFor(item string) []string {
+	if item == "nitrite" {
+		return NitriteLevels
+	}
+	return GradeLevels
+}
+
+// DefaultNumericProxy 内置数值代理阶梯（mg/dL，取各等级常见试纸标称浓度）
+func DefaultNumericProxy() map[string]map[string]float64 {
+	return map[string]map[string]float64{
+		"protein": {"-": 0, "±": 15, "+": 30, "++": 100, "+++": 300, "++++": 1000},
+		"glucose": {"-": 0, "±": 100, "+": 250, "++": 500, "+++": 1000, "++++": 2000},
+	}
+}
+
+// ApplyNumericProxy 按阶梯为等级项填充数值代理；未配置阶梯的检测项及无法解码的结果不输出
+func (d *OPM1560BDeviceData) ApplyNumericProxy(ladders map[string]map[string]float64) {
+	for _, item := range d.Items() {
+		grade, ok := item.Value.(string)
+		if !ok {
+			continue
+		}
+		v, ok := ladders[item.Item][grade]
+		if !ok {
+			continue
+		}
+		if d.NumericProxy == nil {
+			d.NumericProxy = make(map[string]float64)
+		}
+		d.NumericProxy[item.Item] = v
+	}
+}
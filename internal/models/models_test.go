@@ -0,0 +1,256 @@
+package models
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+// newFixedMessage 构建固定时间的检测数据消息（排除时间字段对比对的干扰）
+func newFixedMessage() *MQTTMessage {
+	data := NewOPM1560BDeviceData("SN1234567890", "OPM-1560B")
+	data.TestTime = "2026-02-03T10:15:30Z"
+	data.PH = 5.2
+	data.Protein = "+"
+	data.SpecificGrav = 1.010
+
+	msg := NewMQTTMessage("SN1234567890", "OPM-1560B", MQTTMsgTypeData, map[string]interface{}{
+		"result": data,
+		"items":  map[string]string{"ph": "5.20", "glu": "-", "sg": "1.010", "pro": "+"},
+		"flags":  map[string]bool{"z": true, "a": false},
+	})
+	msg.ReportTime = "2026-02-03T10:15:31Z"
+	return msg
+}
+
+// TestToJSON_StableKeyOrder 测试：同一逻辑结果多次序列化字节完全一致（含map内容）
+func TestToJSON_StableKeyOrder(t *testing.T) {
+	first, err := newFixedMessage().ToJSON()
+	if err != nil {
+		t.Fatalf("序列化失败：%v", err)
+	}
+	for i := 0; i < 50; i++ {
+		got, err := newFixedMessage().ToJSON()
+		if err != nil {
+			t.Fatalf("序列化失败：%v", err)
+		}
+		if !bytes.Equal(first, got) {
+			t.Fatalf("第%d次序列化结果不一致：\n%s\n%s", i, first, got)
+		}
+	}
+
+	// map键按名称排序输出
+	if !bytes.Contains(first, []byte(`"items":{"glu":"-","ph":"5.20","pro":"+","sg":"1.010"}`)) {
+		t.Errorf("map键未按名称排序：%s", first)
+	}
+	t.Logf("序列化结果稳定：%s", first)
+}
+
+// newCleanResult 构造各项均有效、数值在合理范围内的检测结果
+func newCleanResult() *OPM1560BDeviceData {
+	d := NewOPM1560BDeviceData("SN1234567890", "OPM-1560B")
+	d.PH, d.SpecificGrav = 6.0, 1.015
+	for _, p := range []*string{&d.Protein, &d.Glucose, &d.Ketone, &d.OccultBlood, &d.Leukocyte,
+		&d.Erythrocyte, &d.Urobilinogen, &d.Bilirubin, &d.Nitrite, &d.VC} {
+		*p = "-"
+	}
+	return d
+}
+
+// TestQualityScore_CleanVsDegraded 测试：干净结果满分，临床异常值不扣分，含无法解码项/修补/未校验的结果按规则扣分
+func TestQualityScore_CleanVsDegraded(t *testing.T) {
+	clean := newCleanResult()
+	if got := clean.QualityScore(0); got != 100 {
+		t.Fatalf("干净结果评分错误，预期100，实际%d", got)
+	}
+
+	// 超出参考范围属于临床异常，不影响数据质量
+	clean.PH, clean.SpecificGrav = 8.5, 1.040
+	if got := clean.QualityScore(0); got != 100 {
+		t.Fatalf("临床异常值不应扣分，实际%d", got)
+	}
+	if got := clean.QualityScore(FrameRepaired | FrameChecksumUnverified); got != 100-QualityPenaltyRepaired-QualityPenaltyChecksumUnverified {
+		t.Fatalf("修补且未校验帧评分错误，实际%d", got)
+	}
+
+	degraded := newCleanResult()
+	degraded.Glucose, degraded.VC = GradeInvalid, GradeInvalid
+	if want, got := 100-2*QualityPenaltyInvalidItem, degraded.QualityScore(0); got != want {
+		t.Fatalf("降级结果评分错误，预期%d，实际%d", want, got)
+	}
+
+	// 扣分下限为0
+	for _, p := range []*string{&degraded.Protein, &degraded.Ketone, &degraded.OccultBlood, &degraded.Leukocyte,
+		&degraded.Erythrocyte, &degraded.Urobilinogen, &degraded.Bilirubin, &degraded.Nitrite} {
+		*p = GradeInvalid
+	}
+	if got := degraded.QualityScore(FrameRepaired); got != 0 {
+		t.Fatalf("评分应不低于0，实际%d", got)
+	}
+}
+
+// TestCheckPlausible_ImpossiblePH 测试：物理上不可能的PH标记为invalid，而非临床异常abnormal
+func TestCheckPlausible_ImpossiblePH(t *testing.T) {
+	d := newCleanResult()
+	d.PH = 99.9
+	d.CheckDataValid()
+	if d.DataState != DataStateAbnormal {
+		t.Fatalf("前提错误：临床范围校验应为abnormal，实际%s", d.DataState)
+	}
+	d.CheckPlausible()
+	if d.DataState != DataStateInvalid {
+		t.Fatalf("不可能的PH应标记invalid，实际%s", d.DataState)
+	}
+
+	// 临床异常但物理可能的值保持abnormal
+	d = newCleanResult()
+	d.PH = 9.0
+	d.CheckDataValid()
+	d.CheckPlausible()
+	if d.DataState != DataStateAbnormal {
+		t.Fatalf("PH=9.0应为abnormal，实际%s", d.DataState)
+	}
+}
+
+// TestRawStr_RoundTrip 测试：hex/base64两种原始帧编码均可还原为原始字节，未知编码按hex输出
+func TestRawStr_RoundTrip(t *testing.T) {
+	frame := []byte{0xAA, 0x05, 0x20, 0x01, 0x00, 0x10, 0x10, 0x00, 0x46, 0x55}
+
+	hexStr := RawStr(frame, RawEncodingHex)
+	if hexStr != "AA052001001010004655" {
+		t.Fatalf("hex编码错误：%s", hexStr)
+	}
+	if got, err := hex.DecodeString(hexStr); err != nil || !bytes.Equal(got, frame) {
+		t.Fatalf("hex编码无法还原：%s，%v", hexStr, err)
+	}
+
+	b64 := RawStr(frame, RawEncodingBase64)
+	if got, err := base64.StdEncoding.DecodeString(b64); err != nil || !bytes.Equal(got, frame) {
+		t.Fatalf("base64编码无法还原：%s，%v", b64, err)
+	}
+
+	if RawStr(frame, "") != hexStr {
+		t.Errorf("未指定编码时应默认hex")
+	}
+}
+
+// TestCheckDataValidRanges_Configured 测试：配置的参考范围覆盖内置范围，等级项按允许值判定，未配置项回落内置范围
+func TestCheckDataValidRanges_Configured(t *testing.T) {
+	bound := func(v float64) *float64 { return &v }
+	ranges := map[string]ReferenceRange{
+		"ph":      {Min: bound(6.0), Max: bound(7.5)},
+		"protein": {Allowed: []string{"-", "±"}},
+	}
+
+	// PH 5.5在内置范围内，但低于配置下限6.0
+	d := newCleanResult()
+	d.PH = 5.5
+	d.CheckDataValidRanges(ranges)
+	if d.DataState != DataStateAbnormal {
+		t.Fatalf("PH低于配置下限应为abnormal，实际%s", d.DataState)
+	}
+
+	// 尿蛋白 ± 在允许值内，+ 不在
+	d = newCleanResult()
+	d.Protein = "±"
+	d.CheckDataValidRanges(ranges)
+	if d.DataState != DataStateNormal {
+		t.Fatalf("尿蛋白±在允许值内应为normal，实际%s", d.DataState)
+	}
+	d.Protein = "+"
+	d.CheckDataValidRanges(ranges)
+	if d.DataState != DataStateAbnormal {
+		t.Fatalf("尿蛋白+不在允许值内应为abnormal，实际%s", d.DataState)
+	}
+
+	// 比重未配置，回落内置范围1.005-1.030
+	d = newCleanResult()
+	d.SpecificGrav = 1.040
+	d.CheckDataValidRanges(ranges)
+	if d.DataState != DataStateAbnormal {
+		t.Fatalf("比重超出内置范围应为abnormal，实际%s", d.DataState)
+	}
+}
+
+// TestApplyNumericProxy 测试：蛋白/葡萄糖按内置阶梯输出数值代理，原等级值不变，无阶梯项不输出
+func TestApplyNumericProxy(t *testing.T) {
+	d := &OPM1560BDeviceData{Protein: "++", Glucose: "+", Ketone: "+++", Nitrite: "-"}
+	d.ApplyNumericProxy(DefaultNumericProxy())
+	if d.NumericProxy["protein"] != 100 || d.NumericProxy["glucose"] != 250 {
+		t.Fatalf("数值代理错误：%v", d.NumericProxy)
+	}
+	if _, ok := d.NumericProxy["ketone"]; ok {
+		t.Fatalf("未配置阶梯的酮体不应输出数值代理：%v", d.NumericProxy)
+	}
+	if d.Protein != "++" || d.Glucose != "+" {
+		t.Fatalf("原等级值被修改：protein=%s glucose=%s", d.Protein, d.Glucose)
+	}
+
+	d = &OPM1560BDeviceData{Protein: GradeInvalid, Glucose: "-"}
+	d.ApplyNumericProxy(DefaultNumericProxy())
+	if _, ok := d.NumericProxy["protein"]; ok || d.NumericProxy["glucose"] != 0 {
+		t.Fatalf("无法解码项不应输出、阴性应为0：%v", d.NumericProxy)
+	}
+}
+
+// TestValidateMessageJSON 测试：网关实际发出的各类消息通过内置schema，缺字段/类型错误/取值越界被拒绝
+func TestValidateMessageJSON(t *testing.T) {
+	data := NewOPM1560BDeviceData("SN1234567890", "OPM-1560B")
+	data.PH, data.SpecificGrav = 6.5, 1.015
+	score := 100
+	data.Quality = &score
+	valid := []*MQTTMessage{
+		NewMQTTMessage("SN1234567890", "OPM-1560B", MQTTMsgTypeData, data),
+		NewMQTTMessage("SN1234567890", "OPM-1560B", MQTTMsgTypeState, DeviceStateOnline),
+		NewMQTTMessage("SN1234567890", "OPM-1560B", MQTTMsgTypeState,
+			DeviceStateAlert{State: DeviceStateError, Reason: StateReasonSampleGap, GapSec: 600}),
+		NewMQTTMessage("SN1234567890", "OPM-1560B", MQTTMsgTypeSummary, DailySummaryContent{
+			PeriodStart: "2026-02-03T00:00:00+08:00", PeriodEnd: "2026-02-04T00:00:00+08:00", Samples: 3,
+		}),
+	}
+	for _, msg := range valid {
+		msg.Tags = map[string]string{"ward": "3F"}
+		payload, _ := msg.ToJSON()
+		if err := ValidateMessageJSON(payload); err != nil {
+			t.Errorf("合法消息未通过校验：%v | %s", err, payload)
+		}
+	}
+
+	broken := map[string]*MQTTMessage{
+		"content为null": NewMQTTMessage("SN1234567890", "OPM-1560B", MQTTMsgTypeData, nil),
+		"ph类型错误":       NewMQTTMessage("SN1234567890", "OPM-1560B", MQTTMsgTypeData, map[string]interface{}{"ph": "6.5"}),
+		"未知状态":         NewMQTTMessage("SN1234567890", "OPM-1560B", MQTTMsgTypeState, "rebooting"),
+		"未知消息类型":       NewMQTTMessage("SN1234567890", "OPM-1560B", "debug", "x"),
+		"缺少device_id":  NewMQTTMessage("", "OPM-1560B", MQTTMsgTypeState, DeviceStateOnline),
+	}
+	for name, msg := range broken {
+		payload, _ := msg.ToJSON()
+		if err := ValidateMessageJSON(payload); err == nil {
+			t.Errorf("%s：应未通过校验：%s", name, payload)
+		}
+	}
+
+	data.DataState = "unknown"
+	score = 120
+	payload, _ := NewMQTTMessage("SN1234567890", "OPM-1560B", MQTTMsgTypeData, data).ToJSON()
+	if err := ValidateMessageJSON(payload); err == nil {
+		t.Errorf("data_state/quality越界应未通过校验：%s", payload)
+	}
+}
+
+// TestParseSchema_RejectsUnsupportedKeywords 测试：schema使用子集以外的关键字或format时解析失败，不静默忽略约束
+func TestParseSchema_RejectsUnsupportedKeywords(t *testing.T) {
+	if _, err := parseSchema(messageSchemaJSON); err != nil {
+		t.Fatalf("内置schema应可解析：%v", err)
+	}
+	for _, raw := range []string{
+		`{"type":"object","properties":{"ph":{"type":"number","multipleOf":0.01}}}`,
+		`{"$defs":{"data":{"anyOf":[{"type":"string","pattern":"^[+-]$"}]}}}`,
+		`{"type":"string","format":"email"}`,
+	} {
+		if _, err := parseSchema([]byte(raw)); err == nil {
+			t.Errorf("不支持的关键字未被拒绝：%s", raw)
+		}
+	}
+}
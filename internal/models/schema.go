@@ -0,0 +1,253 @@
+package models
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 出站校验只覆盖网关自身消息的形状：模块缓存中无可用的JSON Schema校验库，这里实现固定的关键字子集——
+// type、required、properties、additionalProperties、enum、anyOf、minLength、minimum、maximum、
+// format（仅date-time）、$defs（按msg_type取content定义）及注释类的$schema/$comment/title/description。
+// schema中出现子集以外的关键字时解析即失败，不会静默忽略约束；需要完整JSON Schema时应换用校验库
+
+// messageSchemaJSON 内置出站消息schema
+//
+//go:embed message.schema.json
+var messageSchemaJSON []byte
+
+// jsonSchema 出站校验支持的JSON Schema关键字
+type jsonSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	Enum                 []interface{}          `json:"enum"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	MinLength            *int                   `json:"minLength"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	Format               string                 `json:"format"`
+	Defs                 map[string]*jsonSchema `json:"$defs"`
+}
+
+// schemaKeywords 支持的关键字（含仅作说明、不参与校验的注释类关键字）
+var schemaKeywords = map[string]bool{
+	"type": true, "required": true, "properties": true, "additionalProperties": true, "enum": true,
+	"anyOf": true, "minLength": true, "minimum": true, "maximum": true, "format": true, "$defs": true,
+	"$schema": true, "$comment": true, "title": true, "description": true,
+}
+
+// schemaTypes type关键字（单个类型或类型数组）
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = schemaTypes{one}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+// messageSchema 解析后的内置schema（内置文件格式错误属于编码缺陷，启动即panic）
+var messageSchema = func() *jsonSchema {
+	s, err := parseSchema(messageSchemaJSON)
+	if err != nil {
+		panic(fmt.Sprintf("内置消息schema格式错误：%v", err))
+	}
+	return s
+}()
+
+// parseSchema 解析schema，出现不支持的关键字或format时返回错误
+func parseSchema(raw []byte) (*jsonSchema, error) {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	if err := checkKeywords("$", doc); err != nil {
+		return nil, err
+	}
+	var s jsonSchema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// checkKeywords 递归检查schema节点只使用支持的关键字（properties/$defs下为名称映射，逐个检查其子schema）
+func checkKeywords(path string, node interface{}) error {
+	obj, ok := node.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s：schema须为对象", path)
+	}
+	for k, v := range obj {
+		if !schemaKeywords[k] {
+			return fmt.Errorf("%s：不支持的关键字%s", path, k)
+		}
+		switch k {
+		case "properties", "$defs":
+			children, ok := v.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s.%s：须为对象", path, k)
+			}
+			for name, child := range children {
+				if err := checkKeywords(path+"."+k+"."+name, child); err != nil {
+					return err
+				}
+			}
+		case "additionalProperties":
+			if err := checkKeywords(path+"."+k, v); err != nil {
+				return err
+			}
+		case "anyOf":
+			subs, ok := v.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s.anyOf：须为数组", path)
+			}
+			for i, sub := range subs {
+				if err := checkKeywords(fmt.Sprintf("%s.anyOf[%d]", path, i), sub); err != nil {
+					return err
+				}
+			}
+		case "format":
+			if v != "date-time" {
+				return fmt.Errorf("%s：不支持的format：%v", path, v)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateMessageJSON 按内置schema校验序列化后的MQTT消息（content按msg_type取对应定义），
+// 返回首个不符合项（路径+原因），nil表示校验通过
+func ValidateMessageJSON(payload []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return fmt.Errorf("消息不是合法JSON：%w", err)
+	}
+	if err := messageSchema.validate("$", doc); err != nil {
+		return err
+	}
+	env := doc.(map[string]interface{})
+	msgType, _ := env["msg_type"].(string)
+	def, ok := messageSchema.Defs[msgType]
+	if !ok {
+		return fmt.Errorf("$.msg_type：无对应content定义：%s", msgType)
+	}
+	return def.validate("$.content", env["content"])
+}
+
+// validate 按schema校验值，path为错误定位路径
+func (s *jsonSchema) validate(path string, v interface{}) error {
+	if len(s.AnyOf) > 0 {
+		var errs []string
+		for _, sub := range s.AnyOf {
+			err := sub.validate(path, v)
+			if err == nil {
+				errs = nil
+				break
+			}
+			errs = append(errs, err.Error())
+		}
+		if errs != nil {
+			return fmt.Errorf("%s：不符合任一候选定义（%s）", path, strings.Join(errs, "；"))
+		}
+	}
+	if len(s.Type) > 0 && !s.Type.match(v) {
+		return fmt.Errorf("%s：类型应为%s，实际%s", path, strings.Join(s.Type, "/"), jsonTypeOf(v))
+	}
+	if len(s.Enum) > 0 && !s.inEnum(v) {
+		return fmt.Errorf("%s：取值%v不在允许值%v中", path, v, s.Enum)
+	}
+
+	switch val := v.(type) {
+	case string:
+		if s.MinLength != nil && len([]rune(val)) < *s.MinLength {
+			return fmt.Errorf("%s：长度不足%d", path, *s.MinLength)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, val); err != nil {
+				return fmt.Errorf("%s：非RFC3339时间：%s", path, val)
+			}
+		}
+	case float64:
+		if s.Minimum != nil && val < *s.Minimum {
+			return fmt.Errorf("%s：%v小于下限%v", path, val, *s.Minimum)
+		}
+		if s.Maximum != nil && val > *s.Maximum {
+			return fmt.Errorf("%s：%v大于上限%v", path, val, *s.Maximum)
+		}
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := val[key]; !ok {
+				return fmt.Errorf("%s：缺少必填字段%s", path, key)
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys) // 错误定位稳定
+		for _, k := range keys {
+			sub, ok := s.Properties[k]
+			if !ok {
+				sub = s.AdditionalProperties
+			}
+			if sub == nil {
+				continue // 未声明字段（如平铺的静态标签）不校验
+			}
+			if err := sub.validate(path+"."+k, val[k]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// match 值是否符合type中任一类型
+func (t schemaTypes) match(v interface{}) bool {
+	actual := jsonTypeOf(v)
+	for _, want := range t {
+		if want == actual || (want == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// inEnum 值是否为enum允许值之一
+func (s *jsonSchema) inEnum(v interface{}) bool {
+	for _, e := range s.Enum {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonTypeOf JSON值类型名（整数值的number归为integer）
+func jsonTypeOf(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
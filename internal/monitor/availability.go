@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"opm-mqtt-gateway/internal/models"
+)
+
+// linkEvent 连接状态变化事件
+type linkEvent struct {
+	at time.Time // 变化时间
+	up bool      // 变化后是否在线
+}
+
+// LinkQuality 连接质量统计：按滚动窗口内的上线/断开事件计算可用率与平均无故障时间（MTBF）
+type LinkQuality struct {
+	mu      sync.Mutex
+	window  time.Duration    // 滚动统计窗口
+	startAt time.Time        // 开始统计时间（运行不足一个窗口时以此为窗口起点）
+	baseUp  bool             // 窗口起点时的连接状态（淘汰过期事件时更新）
+	events  []linkEvent      // 窗口内的状态变化（按时间顺序）
+	now     func() time.Time // 时钟（测试可替换）
+}
+
+// NewLinkQuality 新建连接质量统计（up为当前连接状态）
+func NewLinkQuality(window time.Duration, up bool) *LinkQuality {
+	q := &LinkQuality{window: window, baseUp: up, now: time.Now}
+	q.startAt = q.now()
+	return q
+}
+
+// SetUp 记录连接状态（与当前状态相同时忽略）
+func (q *LinkQuality) SetUp(up bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if up == q.current() {
+		return
+	}
+	q.events = append(q.events, linkEvent{at: q.now(), up: up})
+}
+
+// Stats 计算窗口内的连接质量：可用率（百分比，保留两位小数）、断开次数、MTBF（窗口内在线时长/断开次数，无断开时为0）
+func (q *LinkQuality) Stats() *models.LinkQualityContent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	from := now.Add(-q.window)
+	if from.Before(q.startAt) {
+		from = q.startAt
+	}
+	q.prune(from)
+
+	var upTime time.Duration
+	failures := 0
+	up, since := q.baseUp, from
+	for _, e := range q.events {
+		if up {
+			upTime += e.at.Sub(since)
+		}
+		if up && !e.up {
+			failures++
+		}
+		up, since = e.up, e.at
+	}
+	if up {
+		upTime += now.Sub(since)
+	}
+
+	total := now.Sub(from)
+	content := &models.LinkQualityContent{AvailabilityPct: 100, Failures: failures}
+	if total > 0 {
+		content.AvailabilityPct = float64(upTime*10000/total) / 100
+	}
+	if failures > 0 {
+		content.MTBFSec = int64(upTime / time.Duration(failures) / time.Second)
+	}
+	return content
+}
+
+// prune 淘汰窗口起点之前的事件，并将其状态并入baseUp（调用方需持有q.mu）
+func (q *LinkQuality) prune(from time.Time) {
+	i := 0
+	for i < len(q.events) && !q.events[i].at.After(from) {
+		q.baseUp = q.events[i].up
+		i++
+	}
+	q.events = q.events[i:]
+}
+
+// current 当前连接状态（调用方需持有q.mu）
+func (q *LinkQuality) current() bool {
+	if n := len(q.events); n > 0 {
+		return q.events[n-1].up
+	}
+	return q.baseUp
+}
@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLinkQuality_Availability 测试：按模拟上线/断开事件计算窗口内可用率、断开次数与MTBF，过期事件移出窗口
+func TestLinkQuality_Availability(t *testing.T) {
+	now := time.Date(2026, 2, 3, 0, 0, 0, 0, time.UTC)
+	q := &LinkQuality{window: 24 * time.Hour, baseUp: true, startAt: now, now: func() time.Time { return now }}
+
+	// 0:00上线 → 2:00断开 → 3:00恢复 → 10:00断开 → 11:00恢复 → 12:00统计
+	steps := []struct {
+		at time.Duration
+		up bool
+	}{
+		{2 * time.Hour, false}, {3 * time.Hour, true}, {3 * time.Hour, true}, // 重复上线忽略
+		{10 * time.Hour, false}, {11 * time.Hour, true},
+	}
+	start := now
+	for _, s := range steps {
+		now = start.Add(s.at)
+		q.SetUp(s.up)
+	}
+	now = start.Add(12 * time.Hour)
+
+	s := q.Stats()
+	if s.Failures != 2 {
+		t.Fatalf("断开次数错误，预期2，实际%d", s.Failures)
+	}
+	// 12小时内离线2小时：可用率83.33%，在线10小时/2次断开 → MTBF 5小时
+	if s.AvailabilityPct != 83.33 {
+		t.Errorf("可用率错误，预期83.33，实际%v", s.AvailabilityPct)
+	}
+	if s.MTBFSec != 5*3600 {
+		t.Errorf("MTBF错误，预期18000秒，实际%d", s.MTBFSec)
+	}
+
+	// 次日12:00：窗口为前一日12:00起的24小时，此前的断开已移出窗口
+	now = start.Add(36 * time.Hour)
+	s = q.Stats()
+	if s.Failures != 0 || s.AvailabilityPct != 100 || s.MTBFSec != 0 {
+		t.Errorf("过期事件未移出窗口：%+v", s)
+	}
+
+	// 当前离线中：进行中的离线计入窗口
+	q.SetUp(false)
+	now = now.Add(6 * time.Hour)
+	s = q.Stats()
+	if s.Failures != 1 || s.AvailabilityPct != 75 {
+		t.Errorf("进行中的离线未计入：%+v", s)
+	}
+}
@@ -0,0 +1,93 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+)
+
+// GapMonitor 样本中断监测（工作时段内超过预期间隔无样本则告警，临床上意味着分析仪可能停机）
+type GapMonitor struct {
+	mu          sync.Mutex
+	expected    time.Duration    // 最大无样本间隔，0为关闭
+	activeStart int              // 工作时段起始（当天分钟数）
+	activeEnd   int              // 工作时段结束（当天分钟数），与起始相同表示全天
+	lastSample  time.Time        // 最近一次样本时间（启动时间兜底）
+	alerted     bool             // 本次中断是否已告警（下一样本到达后复位）
+	now         func() time.Time // 时钟（测试可替换）
+}
+
+// NewGapMonitor 新建样本中断监测（activeStart/activeEnd为当天分钟数，相同表示全天）
+func NewGapMonitor(expected time.Duration, activeStart, activeEnd int) *GapMonitor {
+	g := &GapMonitor{
+		expected:    expected,
+		activeStart: activeStart,
+		activeEnd:   activeEnd,
+		now:         time.Now,
+	}
+	g.lastSample = g.now()
+	return g
+}
+
+// Sample 记录样本到达（复位中断计时与告警状态）
+func (g *GapMonitor) Sample() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.lastSample = g.now()
+	g.alerted = false
+}
+
+// LastSample 最近一次样本时间（启动时间兜底）
+func (g *GapMonitor) LastSample() time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.lastSample
+}
+
+// Check 检查是否发生样本中断，返回无样本时长及是否需要告警（同一次中断只告警一次）
+// 中断计时从工作时段开始计起，避免夜间无样本在上班时立即误报
+func (g *GapMonitor) Check() (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.expected <= 0 || g.alerted {
+		return 0, false
+	}
+	now := g.now()
+	since, active := g.activeSince(now)
+	if !active {
+		return 0, false
+	}
+
+	from := g.lastSample
+	if from.Before(since) {
+		from = since
+	}
+	if now.Sub(from) < g.expected {
+		return 0, false
+	}
+	g.alerted = true
+	return now.Sub(g.lastSample), true
+}
+
+// activeSince 判断当前是否处于工作时段，返回本时段起始时间（全天模式返回零值）
+func (g *GapMonitor) activeSince(now time.Time) (time.Time, bool) {
+	if g.activeStart == g.activeEnd {
+		return time.Time{}, true
+	}
+	minute := now.Hour()*60 + now.Minute()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	start := midnight.Add(time.Duration(g.activeStart) * time.Minute)
+
+	if g.activeStart < g.activeEnd {
+		return start, minute >= g.activeStart && minute < g.activeEnd
+	}
+	// 跨零点时段（如22:00-06:00）
+	switch {
+	case minute >= g.activeStart:
+		return start, true
+	case minute < g.activeEnd:
+		return start.AddDate(0, 0, -1), true
+	default:
+		return time.Time{}, false
+	}
+}
@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestGapMonitor 基于模拟时钟新建样本中断监测（工作时段08:00-18:00，间隔30分钟）
+func newTestGapMonitor(now *time.Time) *GapMonitor {
+	g := NewGapMonitor(30*time.Minute, 8*60, 18*60)
+	g.now = func() time.Time { return *now }
+	g.lastSample = *now
+	return g
+}
+
+// TestGapMonitor_AlertInsideActiveHours 测试：工作时段内超过间隔无样本告警一次，新样本到达后复位
+func TestGapMonitor_AlertInsideActiveHours(t *testing.T) {
+	now := time.Date(2026, 2, 3, 9, 0, 0, 0, time.Local)
+	g := newTestGapMonitor(&now)
+
+	now = now.Add(20 * time.Minute)
+	if _, alert := g.Check(); alert {
+		t.Fatal("未超过间隔即告警")
+	}
+
+	now = now.Add(15 * time.Minute)
+	gap, alert := g.Check()
+	if !alert {
+		t.Fatal("超过间隔未告警")
+	}
+	if gap != 35*time.Minute {
+		t.Errorf("中断时长错误，预期35m，实际%v", gap)
+	}
+	if _, alert := g.Check(); alert {
+		t.Error("同一次中断重复告警")
+	}
+
+	// 新样本到达后复位，再次中断可重新告警
+	g.Sample()
+	now = now.Add(31 * time.Minute)
+	if _, alert := g.Check(); !alert {
+		t.Error("复位后再次中断未告警")
+	}
+}
+
+// TestGapMonitor_OutsideActiveHours 测试：非工作时段不告警，上班后从时段开始计时
+func TestGapMonitor_OutsideActiveHours(t *testing.T) {
+	now := time.Date(2026, 2, 3, 17, 50, 0, 0, time.Local)
+	g := newTestGapMonitor(&now)
+
+	// 下班后长时间无样本
+	now = time.Date(2026, 2, 3, 23, 0, 0, 0, time.Local)
+	if _, alert := g.Check(); alert {
+		t.Fatal("非工作时段告警")
+	}
+
+	// 次日上班10分钟，从08:00起计时未超过间隔
+	now = time.Date(2026, 2, 4, 8, 10, 0, 0, time.Local)
+	if _, alert := g.Check(); alert {
+		t.Fatal("上班后未超过间隔即告警（夜间无样本误报）")
+	}
+
+	now = time.Date(2026, 2, 4, 8, 31, 0, 0, time.Local)
+	if _, alert := g.Check(); !alert {
+		t.Error("上班后超过间隔未告警")
+	}
+}
+
+// TestGapMonitor_OvernightWindow 测试：跨零点工作时段判定
+func TestGapMonitor_OvernightWindow(t *testing.T) {
+	g := NewGapMonitor(time.Minute, 22*60, 6*60)
+	cases := []struct {
+		hour   int
+		active bool
+	}{{23, true}, {2, true}, {6, false}, {12, false}, {22, true}}
+	for _, c := range cases {
+		_, active := g.activeSince(time.Date(2026, 2, 3, c.hour, 0, 0, 0, time.Local))
+		if active != c.active {
+			t.Errorf("%02d:00 工作时段判定错误，预期%v，实际%v", c.hour, c.active, active)
+		}
+	}
+}
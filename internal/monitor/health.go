@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"opm-mqtt-gateway/internal/models"
+)
+
+// Nagios/NRPE退出码
+const (
+	CheckOK       = 0
+	CheckWarning  = 1
+	CheckCritical = 2
+	CheckUnknown  = 3
+)
+
+// HealthState 运行状态快照（运行中的网关定期写入状态文件，-check子命令读取）
+type HealthState struct {
+	UpdatedAt    time.Time `json:"updated_at"`          // 快照时间
+	Serial       string    `json:"serial"`              // 串口状态：online/offline
+	MQTT         string    `json:"mqtt"`                // MQTT状态：online/offline/local_only
+	LastSampleAt time.Time `json:"last_sample_at"`      // 最近一次样本时间（启动时间兜底）
+	SpoolPending int       `json:"spool_pending"`       // 离线暂存中未送达的消息数（各MQTT连接合计）
+	SpoolEvicted uint64    `json:"spool_evicted_total"` // 离线暂存超过上限累计淘汰的消息数（各MQTT连接合计）
+}
+
+// WriteHealthState 写入状态文件（先写临时文件再改名，-check读取时不会读到半个文件）
+func WriteHealthState(path string, st HealthState) error {
+	raw, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("序列化状态失败：%w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建状态目录失败：%w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return fmt.Errorf("写入状态文件失败：%w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadHealthState 读取状态文件
+func ReadHealthState(path string) (*HealthState, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var st HealthState
+	if err := json.Unmarshal(raw, &st); err != nil {
+		return nil, fmt.Errorf("解析状态文件失败：%w", err)
+	}
+	return &st, nil
+}
+
+// NagiosCheck 根据状态快照生成Nagios格式输出及退出码：
+// 状态文件读取失败为UNKNOWN；快照超过staleAfter未更新（网关未运行）或串口/MQTT不在线为CRITICAL；
+// 最近样本距今超过maxSampleAge（>0时生效）为WARNING；其余为OK
+func NagiosCheck(st *HealthState, readErr error, now time.Time, staleAfter, maxSampleAge time.Duration) (string, int) {
+	if readErr != nil {
+		return fmt.Sprintf("UNKNOWN: cannot read state file: %v", readErr), CheckUnknown
+	}
+	age := now.Sub(st.UpdatedAt).Truncate(time.Second)
+	if age > staleAfter {
+		return fmt.Sprintf("CRITICAL: gateway not running, state file %v old", age), CheckCritical
+	}
+	sampleAge := now.Sub(st.LastSampleAt).Truncate(time.Second)
+	detail := fmt.Sprintf("serial=%s, mqtt=%s, last_sample_age=%v | last_sample_age=%ds",
+		st.Serial, st.MQTT, sampleAge, int64(sampleAge/time.Second))
+	if st.Serial != models.DeviceStateOnline || st.MQTT != models.DeviceStateOnline {
+		return "CRITICAL: " + detail, CheckCritical
+	}
+	if maxSampleAge > 0 && sampleAge > maxSampleAge {
+		return "WARNING: " + detail, CheckWarning
+	}
+	return "OK: " + detail, CheckOK
+}
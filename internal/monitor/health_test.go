@@ -0,0 +1,62 @@
+package monitor
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"opm-mqtt-gateway/internal/models"
+)
+
+// TestNagiosCheck_States 测试：健康/样本过久/连接断开/网关未运行/无状态文件的输出前缀与退出码
+func TestNagiosCheck_States(t *testing.T) {
+	now := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	healthy := HealthState{
+		UpdatedAt:    now.Add(-5 * time.Second),
+		Serial:       models.DeviceStateOnline,
+		MQTT:         models.DeviceStateOnline,
+		LastSampleAt: now.Add(-2 * time.Minute),
+	}
+
+	// 状态文件读写往返
+	path := filepath.Join(t.TempDir(), "health.json")
+	if err := WriteHealthState(path, healthy); err != nil {
+		t.Fatalf("写入状态文件失败：%v", err)
+	}
+	st, err := ReadHealthState(path)
+	if err != nil {
+		t.Fatalf("读取状态文件失败：%v", err)
+	}
+
+	mqttDown := healthy
+	mqttDown.MQTT = models.DeviceStateOffline
+	stale := healthy
+	stale.UpdatedAt = now.Add(-10 * time.Minute)
+
+	cases := []struct {
+		name   string
+		st     *HealthState
+		err    error
+		prefix string
+		code   int
+	}{
+		{"健康", st, nil, "OK: ", CheckOK},
+		{"MQTT断开", &mqttDown, nil, "CRITICAL: ", CheckCritical},
+		{"网关未运行", &stale, nil, "CRITICAL: gateway not running", CheckCritical},
+		{"无状态文件", nil, errors.New("no such file"), "UNKNOWN: ", CheckUnknown},
+	}
+	for _, c := range cases {
+		line, code := NagiosCheck(c.st, c.err, now, 30*time.Second, 0)
+		if !strings.HasPrefix(line, c.prefix) || code != c.code {
+			t.Errorf("%s：输出%q（退出码%d），预期前缀%q（退出码%d）", c.name, line, code, c.prefix, c.code)
+		}
+	}
+
+	// 样本过久：WARNING，且附带perfdata
+	line, code := NagiosCheck(st, nil, now, 30*time.Second, time.Minute)
+	if code != CheckWarning || !strings.HasPrefix(line, "WARNING: ") || !strings.Contains(line, "| last_sample_age=120s") {
+		t.Errorf("样本过久输出错误：%q（退出码%d）", line, code)
+	}
+}
@@ -0,0 +1,35 @@
+package monitor
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// PipelineStats 数据链路累计计数（心跳日志输出，并发安全）
+type PipelineStats struct {
+	Frames      atomic.Uint64 // 收到的帧数
+	Published   atomic.Uint64 // 发布成功数
+	ParseErrors atomic.Uint64 // 解析失败数
+	Dropped     atomic.Uint64 // 丢弃数（MQTT未连接/重复触发/发布失败）
+}
+
+// String 计数摘要（心跳日志使用）
+func (s *PipelineStats) String() string {
+	return fmt.Sprintf("收帧%d，发布%d，解析失败%d，丢弃%d",
+		s.Frames.Load(), s.Published.Load(), s.ParseErrors.Load(), s.Dropped.Load())
+}
+
+// RunHeartbeat 按固定周期调用beat（独立定时器，与数据处理互不影响），stop关闭后退出
+func RunHeartbeat(interval time.Duration, stop <-chan struct{}, beat func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			beat()
+		}
+	}
+}
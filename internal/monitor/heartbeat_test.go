@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRunHeartbeat_FiresUnderDataFlow 测试：持续数据流下心跳仍按周期触发，停止后退出
+func TestRunHeartbeat_FiresUnderDataFlow(t *testing.T) {
+	var stats PipelineStats
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	// 模拟持续数据流
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				stats.Frames.Add(1)
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	defer close(done)
+
+	var beats atomic.Int32
+	exited := make(chan struct{})
+	go func() {
+		RunHeartbeat(20*time.Millisecond, stop, func() { beats.Add(1) })
+		close(exited)
+	}()
+
+	time.Sleep(110 * time.Millisecond)
+	close(stop)
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatalf("stop关闭后心跳协程未退出")
+	}
+	if n := beats.Load(); n < 3 {
+		t.Fatalf("数据流持续时心跳应按周期触发，110ms内仅触发%d次", n)
+	}
+	if !strings.Contains(stats.String(), "收帧") || stats.Frames.Load() == 0 {
+		t.Errorf("计数摘要错误：%s", stats.String())
+	}
+}
@@ -0,0 +1,114 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"opm-mqtt-gateway/internal/models"
+)
+
+// DailySummary 每日汇总统计（样本数/异常数/无效数/设备离线时长），到达每日汇总时间后输出并清零；
+// 输出的汇总保留至确认发布成功（Published），发布失败时下次检查重新返回
+type DailySummary struct {
+	mu        sync.Mutex
+	loc       *time.Location              // 汇总时间所在时区
+	atMin     int                         // 每日汇总时间（当天分钟数）
+	nextAt    time.Time                   // 下一次汇总时间
+	periodAt  time.Time                   // 本统计周期起始时间
+	samples   int                         // 样本数
+	abnormal  int                         // 异常结果数
+	invalid   int                         // 无效结果数
+	downSince time.Time                   // 当前离线起始时间（在线为零值）
+	downtime  time.Duration               // 本周期累计离线时长（不含进行中的离线）
+	pending   *models.DailySummaryContent // 已到期、尚未确认发布的汇总
+	now       func() time.Time            // 时钟（测试可替换）
+}
+
+// NewDailySummary 新建每日汇总（atMin为当天分钟数，loc为nil时使用本地时区）
+func NewDailySummary(atMin int, loc *time.Location) *DailySummary {
+	if loc == nil {
+		loc = time.Local
+	}
+	d := &DailySummary{loc: loc, atMin: atMin, now: time.Now}
+	d.reset(d.now())
+	return d
+}
+
+// Record 记录一条检测结果（按数据状态分类计数）
+func (d *DailySummary) Record(dataState string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.samples++
+	switch dataState {
+	case models.DataStateAbnormal:
+		d.abnormal++
+	case models.DataStateInvalid:
+		d.invalid++
+	}
+}
+
+// SetOnline 记录设备连接状态变化（离线期间计入停机时长）
+func (d *DailySummary) SetOnline(online bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	switch {
+	case !online && d.downSince.IsZero():
+		d.downSince = now
+	case online && !d.downSince.IsZero():
+		d.downtime += now.Sub(d.downSince)
+		d.downSince = time.Time{}
+	}
+}
+
+// Due 到达汇总时间则返回本周期汇总并清零计数（进行中的离线截断到汇总时刻，剩余计入下一周期）；
+// 上一次返回的汇总未确认发布时原样返回
+func (d *DailySummary) Due() (*models.DailySummaryContent, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.pending != nil {
+		return d.pending, true
+	}
+	now := d.now()
+	if now.Before(d.nextAt) {
+		return nil, false
+	}
+	downtime := d.downtime
+	if !d.downSince.IsZero() {
+		downtime += now.Sub(d.downSince)
+		d.downSince = now
+	}
+	summary := &models.DailySummaryContent{
+		PeriodStart: d.periodAt.In(d.loc).Format(time.RFC3339),
+		PeriodEnd:   now.In(d.loc).Format(time.RFC3339),
+		Samples:     d.samples,
+		Abnormal:    d.abnormal,
+		Invalid:     d.invalid,
+		DowntimeSec: int64(downtime / time.Second),
+	}
+	d.reset(now)
+	d.pending = summary
+	return summary, true
+}
+
+// Published 确认汇总已发布（之后Due等待下一次汇总时间）
+func (d *DailySummary) Published() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending = nil
+}
+
+// reset 清零计数并计算下一次汇总时间（调用方需持有d.mu或处于构造阶段）
+func (d *DailySummary) reset(now time.Time) {
+	d.periodAt = now
+	d.samples, d.abnormal, d.invalid = 0, 0, 0
+	d.downtime = 0
+
+	local := now.In(d.loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), d.atMin/60, d.atMin%60, 0, 0, d.loc)
+	if !next.After(local) {
+		next = next.AddDate(0, 0, 1)
+	}
+	d.nextAt = next
+}
@@ -0,0 +1,67 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"opm-mqtt-gateway/internal/models"
+)
+
+// TestDailySummary_CrossScheduledTime 测试：跨过每日汇总时间后输出当日统计并清零，时区按配置计算
+func TestDailySummary_CrossScheduledTime(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	now := time.Date(2026, 2, 3, 22, 0, 0, 0, loc)
+	d := &DailySummary{loc: loc, atMin: 23*60 + 30, now: func() time.Time { return now }}
+	d.reset(now)
+
+	d.Record(models.DataStateNormal)
+	d.Record(models.DataStateAbnormal)
+	d.Record(models.DataStateInvalid)
+	now = now.Add(10 * time.Minute)
+	d.SetOnline(false) // 22:10串口离线
+	now = now.Add(20 * time.Minute)
+	d.SetOnline(true) // 22:30恢复，离线20分钟
+	now = now.Add(50 * time.Minute)
+	d.SetOnline(false) // 23:20再次离线，跨过汇总时间
+
+	if _, due := d.Due(); due {
+		t.Fatalf("23:20未到汇总时间23:30，不应输出汇总")
+	}
+
+	now = time.Date(2026, 2, 3, 23, 30, 0, 0, loc)
+	s, due := d.Due()
+	if !due {
+		t.Fatalf("到达汇总时间应输出汇总")
+	}
+	if s.Samples != 3 || s.Abnormal != 1 || s.Invalid != 1 {
+		t.Errorf("样本计数错误：%+v", s)
+	}
+	if s.DowntimeSec != 30*60 {
+		t.Errorf("离线时长错误，预期1800秒，实际%d", s.DowntimeSec)
+	}
+	if s.PeriodEnd != "2026-02-03T23:30:00+08:00" {
+		t.Errorf("周期结束时间未按配置时区输出：%s", s.PeriodEnd)
+	}
+
+	// 未确认发布前重复返回同一汇总（发布失败重试）
+	d.Record(models.DataStateNormal)
+	if again, due := d.Due(); !due || again != s {
+		t.Fatalf("未确认发布的汇总应原样重新返回")
+	}
+	d.Published()
+	if _, due := d.Due(); due {
+		t.Fatalf("确认发布后不应再输出汇总")
+	}
+
+	// 汇总后清零（汇总时刻之后的样本计入下一周期），进行中的离线计入下一周期
+	now = now.Add(10 * time.Minute)
+	d.SetOnline(true)
+	now = time.Date(2026, 2, 4, 23, 30, 0, 0, loc)
+	s, due = d.Due()
+	if !due {
+		t.Fatalf("次日汇总时间应输出汇总")
+	}
+	if s.Samples != 1 || s.DowntimeSec != 10*60 {
+		t.Errorf("次日汇总应已清零（仅含汇总后1个样本）且含跨周期离线10分钟：%+v", s)
+	}
+}
@@ -0,0 +1,96 @@
+package mqtt
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 正常发布
+	BreakerOpen     = "open"      // 熔断中，跳过发布
+	BreakerHalfOpen = "half_open" // 冷却结束，放行一条探测消息
+)
+
+// breaker 发布熔断器：服务端降级时连续失败达到阈值即熔断，冷却后半开探测，探测成功恢复
+type breaker struct {
+	mu        sync.Mutex
+	threshold int           // 触发熔断的连续失败次数（0为关闭）
+	cooldown  time.Duration // 熔断冷却时间
+	failures  int           // 当前连续失败次数
+	state     string        // 当前状态
+	openedAt  time.Time     // 最近一次熔断时间
+	probing   bool          // 半开状态下探测消息是否已放行
+	now       func() time.Time
+}
+
+// newBreaker 新建熔断器（threshold为0时不熔断）
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+		now:       time.Now,
+	}
+}
+
+// Allow 是否放行本次发布
+func (b *breaker) Allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		log.Printf("[INFO] [mqtt] 熔断冷却结束，半开探测")
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false // 探测结果未返回前不再放行
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record 记录发布结果（err为nil表示成功）
+func (b *breaker) Record(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil {
+		if b.state != BreakerClosed {
+			log.Printf("[INFO] [mqtt] 探测发布成功，熔断恢复")
+		}
+		b.failures = 0
+		b.state = BreakerClosed
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+		log.Printf("[WARN] [mqtt] 连续%d次发布失败，熔断%v（最近错误：%v）", b.failures, b.cooldown, err)
+	}
+}
+
+// State 获取熔断器当前状态
+func (b *breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
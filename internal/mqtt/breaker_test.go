@@ -0,0 +1,68 @@
+package mqtt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestBreaker_TripAndReset 测试：连续失败触发熔断，冷却后半开探测，探测成功恢复
+func TestBreaker_TripAndReset(t *testing.T) {
+	b := newBreaker(3, 30*time.Second)
+	now := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	errPub := errors.New("broker timeout")
+
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("第%d次失败前不应熔断", i+1)
+		}
+		b.Record(errPub)
+	}
+	if b.State() != BreakerOpen || b.Allow() {
+		t.Fatalf("连续3次失败应熔断，当前状态%s", b.State())
+	}
+
+	// 冷却结束：只放行一条探测消息
+	now = now.Add(31 * time.Second)
+	if !b.Allow() {
+		t.Fatalf("冷却结束应放行探测消息")
+	}
+	if b.State() != BreakerHalfOpen || b.Allow() {
+		t.Fatalf("半开状态探测结果返回前不应再放行，当前状态%s", b.State())
+	}
+
+	// 探测失败：重新熔断
+	b.Record(errPub)
+	if b.State() != BreakerOpen {
+		t.Fatalf("探测失败应重新熔断，当前状态%s", b.State())
+	}
+
+	// 再次冷却后探测成功：恢复
+	now = now.Add(31 * time.Second)
+	if !b.Allow() {
+		t.Fatalf("冷却结束应放行探测消息")
+	}
+	b.Record(nil)
+	if b.State() != BreakerClosed || !b.Allow() {
+		t.Fatalf("探测成功应恢复，当前状态%s", b.State())
+	}
+}
+
+// TestBreaker_Disabled 测试：阈值为0时不熔断
+func TestBreaker_Disabled(t *testing.T) {
+	b := newBreaker(0, time.Second)
+	for i := 0; i < 10; i++ {
+		b.Record(errors.New("broker timeout"))
+	}
+	if !b.Allow() || b.State() != BreakerClosed {
+		t.Fatalf("阈值为0时不应熔断，当前状态%s", b.State())
+	}
+}
+
+// failuresNow 当前连续失败次数（测试用）
+func (b *breaker) failuresNow() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures
+}
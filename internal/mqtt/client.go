@@ -2,43 +2,120 @@ package mqtt
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"opm-mqtt-gateway/internal/config"
 	"opm-mqtt-gateway/internal/models"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
 )
 
 // Client MQTT客户端实例（贴合医用数据要求，基于paho.mqtt v1.5.1实现）
 type Client struct {
-	client      MQTT.Client        // paho原生客户端
-	cfg         *config.Config     // 全局配置
-	ctx         context.Context    // 协程管理上下文
-	cancel      context.CancelFunc // 协程取消函数
-	mu          sync.Mutex         // 操作互斥锁（并发安全）
-	isConnected bool               // MQTT连接状态
-	topicData   string             // 检测数据发布主题（设备SN唯一）
-	topicState  string             // 设备状态发布主题（遗嘱+主动上报）
+	client      MQTT.Client            // paho原生客户端
+	cfg         *config.Config         // 设备配置（单设备为全局配置）
+	ctx         context.Context        // 协程管理上下文
+	cancel      context.CancelFunc     // 协程取消函数
+	mu          sync.Mutex             // 操作互斥锁（并发安全）
+	isConnected bool                   // MQTT连接状态
+	topicState  string                 // 遗嘱设备状态主题（遗嘱+该设备主动上报）
+	devices     []config.DeviceConfig  // 本连接承载的设备（shared模式为全部设备），状态上报/下行命令按设备区分
+	operators   map[string]operator    // 各设备当前操作员/班次（随消息上报，可由该设备下行命令修改），key为device_id
+	stateMu     sync.Mutex             // 状态上报去重锁（连接回调协程使用，独立于mu）
+	lastState   string                 // 最近一次上报的设备状态
+	lastStateAt time.Time              // 最近一次上报设备状态的时间
+	now         func() time.Time       // 时钟（测试可替换）
+	onState     models.StateChangeFunc // 连接状态变化回调（外部告警）
+	breaker     *breaker               // 发布熔断器（服务端降级时跳过发布）
+	localOnly   bool                   // 认证失败降级为本地模式（停止重连与发布）
+	ledgers     map[string]*ledger     // 各设备发布消息哈希链（审计，key为device_id，未开启为nil）
+	loopAt      atomic.Int64           // 重连协程最近一次推进时间（UnixNano，看门狗据此判定卡死）
+	loopGen     atomic.Uint64          // 重连协程代数（看门狗重启后旧协程据此退出）
+	// 离线暂存队列（未配置spool_dir时为nil），flushing标记补发协程运行中
+	spool    *spool
+	flushing atomic.Bool
 }
 
+// operator 设备当前操作员/班次
+type operator struct {
+	id    string
+	shift string
+}
+
+// errAuthFailed 服务端拒绝认证（重试相同凭据无意义）
+var errAuthFailed = errors.New("MQTT服务端拒绝认证")
+
+// errLoopReplaced 重连协程已被看门狗替换（旧协程停止重连并退出）
+var errLoopReplaced = errors.New("重连协程已被替换")
+
 // NewClient 新建MQTT客户端实例（初始化遗嘱+QoS1+重连协程）
 func NewClient() (*Client, error) {
-	cfg := config.GlobalConfig
+	return NewClientFor(config.GlobalConfig)
+}
+
+// NewClientFor 按指定设备配置新建MQTT客户端（多设备per_device模式每台一个；shared模式以第一台配置新建，
+// 状态上报/下行命令/哈希链按设备区分，遗嘱每条连接仅一个，归属will_topic）
+func NewClientFor(cfg *config.Config) (*Client, error) {
 	// 1. 初始化上下文
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// 2. 生成设备唯一发布主题
-	topicData := fmt.Sprintf("%s/%s/data", cfg.MQTT.TopicPrefix, cfg.Device.DeviceID)
+	// 2. 遗嘱主题及本连接承载的设备
 	topicState := cfg.MQTT.WillTopic
+	devices := cfg.ConnDevices()
+	if len(devices) > 1 {
+		log.Printf("[WARN] [mqtt] shared模式%d台设备共用一条连接，遗嘱仅覆盖主题%s，其余设备异常断开时平台无遗嘱通知", len(devices), topicState)
+	}
+	var m *Client // 回调中引用，连接前完成赋值
+
+	// 审计哈希链（按设备独立成链，链头持久化，重启后续链；shared模式链头文件按设备追加.device_id，与per_device模式一致）
+	var chains map[string]*ledger
+	if cfg.MQTT.LedgerEnabled {
+		chains = make(map[string]*ledger, len(devices))
+		for _, d := range devices {
+			path := cfg.MQTT.LedgerHeadPath
+			if len(devices) > 1 {
+				path += "." + d.DeviceID
+			}
+			chain, err := newLedger(path)
+			if err != nil {
+				cancel()
+				return nil, fmt.Errorf("设备[%s]初始化哈希链失败：%w", d.DeviceID, err)
+			}
+			chains[d.DeviceID] = chain
+		}
+	}
+
+	// 离线暂存队列（断开期间检测数据落盘，重连后按序补发）
+	var queue *spool
+	if cfg.MQTT.SpoolDir != "" {
+		var err error
+		if queue, err = newSpool(cfg.MQTT.SpoolDir, cfg.MQTT.SpoolMaxMessages, int64(cfg.MQTT.SpoolMaxMB)<<20); err != nil {
+			cancel()
+			return nil, fmt.Errorf("初始化离线暂存队列失败：%w", err)
+		}
+	}
 
 	// 3. paho.mqtt v1.5.1标准配置（核心：医用数据优化）
 	opts := MQTT.NewClientOptions()
 	opts.AddBroker(cfg.MQTT.Broker)
+	if isTLSBroker(cfg.MQTT.Broker) {
+		tlsCfg, err := newTLSConfig(cfg.MQTT)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("初始化TLS失败：%w", err)
+		}
+		if tlsCfg.InsecureSkipVerify {
+			log.Printf("[WARN] [mqtt] 已关闭服务端证书校验（tls_insecure_skip_verify），仅限联调使用")
+		}
+		opts.SetTLSConfig(tlsCfg)
+	}
 	opts.SetClientID(cfg.MQTT.ClientID)
 	opts.SetUsername(cfg.MQTT.Username)
 	opts.SetPassword(cfg.MQTT.Password)
@@ -46,6 +123,7 @@ func NewClient() (*Client, error) {
 	opts.SetKeepAlive(time.Duration(cfg.MQTT.KeepAlive) * time.Second)
 	opts.SetAutoReconnect(false) // 关闭原生重连，自定义指数退避（工业现场更友好）
 	opts.SetMaxReconnectInterval(time.Duration(cfg.MQTT.ReconnectInt*10) * time.Second)
+	opts.SetConnectTimeout(config.MQTTConnectTimeout) // 单次连接等待上限（看门狗卡死判定须大于该值）
 
 	// 4. 设置遗嘱消息（核心：设备异常离线时，平台自动接收offline）
 	opts.SetWill(topicState, cfg.MQTT.WillMsg, uint8(cfg.MQTT.WillQoS), cfg.MQTT.WillRetain)
@@ -53,66 +131,144 @@ func NewClient() (*Client, error) {
 	// 5. 连接成功回调：主动上报online状态（平台实时感知设备上线）
 	opts.SetOnConnectHandler(func(c MQTT.Client) {
 		log.Printf("[INFO] [mqtt] 连接成功，服务端：%s，客户端ID：%s", cfg.MQTT.Broker, cfg.MQTT.ClientID)
-		_ = rptOnlineState(c, topicState, cfg)
+		_ = m.rptOnlineState(c)
+		// CleanSession下每次连接都需重新订阅各设备下行命令
+		for _, d := range m.devices {
+			topicCmd := m.topicFor(d.DeviceID, "cmd")
+			if token := c.Subscribe(topicCmd, byte(cfg.MQTT.QoS), m.commandHandler(d.DeviceID)); token.Wait() && token.Error() != nil {
+				log.Printf("[ERROR] [mqtt] 订阅下行命令失败，主题：%s，错误：%v", topicCmd, token.Error())
+			}
+		}
 	})
 
-	// 6. 连接丢失回调：记录错误，触发重连协程
+	// 6. 连接丢失回调：记录错误，标记断开以触发重连协程
 	opts.SetConnectionLostHandler(func(c MQTT.Client, err error) {
-		log.Printf("[ERROR] [mqtt] 连接丢失：%v", err)
+		m.onConnectionLost(c, err)
 	})
 
 	// 7. 新建paho客户端
 	client := MQTT.NewClient(opts)
 
 	// 8. 新建自定义客户端实例
-	m := &Client{
+	operators := make(map[string]operator, len(devices))
+	for _, d := range devices {
+		operators[d.DeviceID] = operator{id: cfg.App.OperatorID, shift: cfg.App.ShiftID}
+	}
+	m = &Client{
 		client:      client,
 		cfg:         cfg,
 		ctx:         ctx,
 		cancel:      cancel,
-		topicData:   topicData,
 		topicState:  topicState,
+		devices:     devices,
+		operators:   operators,
+		now:         time.Now,
+		breaker:     newBreaker(cfg.MQTT.BreakerThreshold, time.Duration(cfg.MQTT.BreakerCooldownSec)*time.Second),
+		ledgers:     chains,
 		isConnected: false,
 	}
+	m.spool = queue
 
 	// 9. 连接MQTT服务端（带基础重试）
-	if err := m.connectWithRetry(); err != nil {
-		return nil, fmt.Errorf("连接失败：%w", err)
+	if err := m.connectWithRetry(m.loopGen.Load()); err != nil {
+		if !(cfg.MQTT.AuthFailLocalOnly && errors.Is(err, errAuthFailed)) {
+			return nil, fmt.Errorf("连接失败：%w", err)
+		}
+		m.enterLocalOnly(err)
+		return m, nil
 	}
+	m.setConnected(true, "mqtt_connected")
 
 	// 10. 启动指数退避重连协程（7*24运行，网络波动自动恢复）
-	go m.reconnectLoop()
+	m.startReconnectLoop()
+	if cfg.MQTT.ReconnectWatchdogMult > 0 {
+		go m.watchReconnectLoop(time.Duration(cfg.MQTT.ReconnectWatchdogMult*cfg.MQTT.ReconnectInt) * time.Second)
+	}
 
 	return m, nil
 }
 
-// connectWithRetry MQTT连接（带基础重试，避免网络偶发失败）
-func (m *Client) connectWithRetry() error {
+// connectWithRetry MQTT连接（带基础重试，避免网络偶发失败），gen为调用方重连协程代数：
+// 每次尝试与重试等待都记录心跳，代数已变化（被看门狗替换）时返回errLoopReplaced
+// 连接等待与重试间隔期间不持有m.mu，避免阻塞Publish/IsConnected等调用
+func (m *Client) connectWithRetry(gen uint64) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	client := m.client
+	m.mu.Unlock()
 
 	retryCnt := 3
 	retryInt := time.Duration(m.cfg.MQTT.ReconnectInt) * time.Second
 	for i := 1; i <= retryCnt; i++ {
-		if token := m.client.Connect(); token.Wait() && token.Error() != nil {
+		if !m.beat(gen) {
+			return errLoopReplaced
+		}
+		if token := client.Connect(); token.Wait() && token.Error() != nil {
+			if isAuthError(token.Error()) {
+				return fmt.Errorf("%w：%v", errAuthFailed, token.Error()) // 凭据错误，重试无意义
+			}
 			log.Printf("[ERROR] [mqtt] 重试%d/%d：%v", i, retryCnt, token.Error())
-			time.Sleep(retryInt)
+			m.pause(gen, retryInt)
 			continue
 		}
-		m.isConnected = true
-		return nil
+		return nil // 连接状态由调用方setConnected更新并触发回调
 	}
 	return fmt.Errorf("重试%d次后失败", retryCnt)
 }
 
+// startReconnectLoop 启动新一代重连协程，不等待旧协程：旧协程即使卡死在连接等待中也被直接放弃，
+// 解除阻塞后在下一次心跳时发现代数变化退出（paho的Connect在连接进行中时直接返回错误，新旧协程不会重复建立连接）
+func (m *Client) startReconnectLoop() {
+	gen := m.loopGen.Add(1)
+	m.loopAt.Store(m.now().UnixNano())
+	go m.reconnectLoop(gen)
+}
+
+// beat 重连协程心跳：本协程仍为当前代时记录推进时间并返回true，已被替换返回false
+func (m *Client) beat(gen uint64) bool {
+	if m.loopGen.Load() != gen {
+		return false
+	}
+	m.loopAt.Store(m.now().UnixNano())
+	return true
+}
+
+// pause 重连协程等待d：每个重连基础间隔记录一次心跳（长退避不被看门狗误判为卡死），被替换或上下文取消时提前返回
+func (m *Client) pause(gen uint64, d time.Duration) {
+	step := time.Duration(m.cfg.MQTT.ReconnectInt) * time.Second
+	if step <= 0 {
+		step = d
+	}
+	for d > 0 {
+		s := min(step, d)
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(s):
+		}
+		d -= s
+		if !m.beat(gen) {
+			return
+		}
+	}
+}
+
+// LoopLastIteration 重连协程最近一次推进时间（健康指标）
+func (m *Client) LoopLastIteration() time.Time {
+	return time.Unix(0, m.loopAt.Load())
+}
+
 // reconnectLoop 核心：指数退避重连（工业现场网络波动适配）
 // 规则：基础间隔2s → 4s → 8s → 最大20s，重连成功后重置为2s
-func (m *Client) reconnectLoop() {
+func (m *Client) reconnectLoop(gen uint64) {
 	baseInt := time.Duration(m.cfg.MQTT.ReconnectInt) * time.Second
 	maxInt := baseInt * 10
 	curInt := baseInt
 
 	for {
+		if !m.beat(gen) {
+			log.Printf("[INFO] [mqtt] 重连协程已被看门狗替换，旧协程退出")
+			return
+		}
 		select {
 		case <-m.ctx.Done():
 			log.Printf("[INFO] [mqtt] 重连协程正常退出")
@@ -124,45 +280,125 @@ func (m *Client) reconnectLoop() {
 
 			if !connected {
 				log.Printf("[WARN] [mqtt] 开始重连，当前间隔：%v", curInt)
-				if err := m.connectWithRetry(); err != nil {
+				if err := m.connectWithRetry(gen); err != nil {
+					if errors.Is(err, errLoopReplaced) {
+						log.Printf("[INFO] [mqtt] 重连协程已被看门狗替换，旧协程退出")
+						return
+					}
+					if m.cfg.MQTT.AuthFailLocalOnly && errors.Is(err, errAuthFailed) {
+						m.enterLocalOnly(err)
+						return
+					}
 					curInt = min(curInt*2, maxInt) // 指数退避
-					time.Sleep(curInt)
+					m.pause(gen, curInt)
 					continue
 				}
-				// 重连成功，重置间隔，更新状态
+				// 重连成功，重置间隔，更新状态（已被替换的旧协程连接成功后同样更新状态再退出）
 				curInt = baseInt
-				m.mu.Lock()
-				m.isConnected = true
-				m.mu.Unlock()
+				m.setConnected(true, "mqtt_reconnected")
+				if !m.beat(gen) {
+					log.Printf("[INFO] [mqtt] 重连协程已被看门狗替换，旧协程退出")
+					return
+				}
 			}
-			time.Sleep(baseInt) // 连接正常时，间隔检查状态
+			// 连接正常（含刚重连成功）时按序补发离线暂存消息
+			if m.spool != nil && m.spool.Len() > 0 {
+				go m.flushSpool()
+			}
+			m.pause(gen, baseInt) // 连接正常时，间隔检查状态
 		}
 	}
 }
 
-// rptOnlineState 连接成功后，主动上报设备online状态（平台感知）
-func rptOnlineState(client MQTT.Client, topic string, cfg *config.Config) error {
-	// 构建状态MQTT消息
-	stateMsg := models.NewMQTTMessage(
-		cfg.Device.DeviceID,
-		cfg.Device.Model,
-		models.MQTTMsgTypeState,
-		models.DeviceStateOnline,
-	)
-	jsonMsg, err := stateMsg.ToJSON()
-	if err != nil {
-		return fmt.Errorf("序列化失败：%w", err)
+// watchReconnectLoop 重连看门狗：断开期间重连协程超过stall未推进，判定卡死并重启重连协程
+func (m *Client) watchReconnectLoop(stall time.Duration) {
+	ticker := time.NewTicker(stall / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.checkReconnectLoop(stall)
+		}
 	}
+}
 
-	// 发布状态消息
-	token := client.Publish(topic, uint8(cfg.MQTT.WillQoS), cfg.MQTT.WillRetain, jsonMsg)
-	token.Wait()
-	if token.Error() != nil {
-		return fmt.Errorf("发布失败：%w", token.Error())
+// checkReconnectLoop 检查重连协程是否卡死，卡死则重启（返回是否重启）
+// 重连协程每次连接尝试与退避等待均记录心跳，配置校验保证stall大于单次连接等待上限，正常重连不会被误判
+func (m *Client) checkReconnectLoop(stall time.Duration) bool {
+	m.mu.Lock()
+	idle := !m.isConnected && !m.localOnly
+	m.mu.Unlock()
+	if !idle {
+		return false
 	}
+	last := m.LoopLastIteration()
+	if m.now().Sub(last) < stall {
+		return false
+	}
+	log.Printf("[ERROR] [mqtt] 重连协程自%s起未推进（超过%v），判定卡死，重启重连协程", last.Format(time.RFC3339), stall)
+	m.startReconnectLoop()
+	return true
+}
 
-	log.Printf("[INFO] [mqtt] 已上报设备在线状态，主题：%s，消息：%s", topic, string(jsonMsg))
-	return nil
+// rptOnlineState 连接成功后，为本连接承载的每台设备主动上报online状态（平台感知）
+// 频繁重连时相同状态在min_state_interval_sec内只上报一次，避免刷屏state主题
+func (m *Client) rptOnlineState(client MQTT.Client) error {
+	cfg := m.cfg
+	if !m.allowState(models.DeviceStateOnline) {
+		log.Printf("[INFO] [mqtt] 距上次上报online不足%ds，跳过本次状态上报", cfg.MQTT.MinStateIntervalSec)
+		return nil
+	}
+
+	var errs []error
+	for _, d := range m.devices {
+		// 构建状态MQTT消息
+		stateMsg := models.NewMQTTMessage(
+			d.DeviceID,
+			d.Model,
+			models.MQTTMsgTypeState,
+			models.DeviceStateOnline,
+		)
+		jsonMsg, err := stateMsg.ToJSON()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("设备[%s]序列化失败：%w", d.DeviceID, err))
+			continue
+		}
+
+		// 发布状态消息
+		topic := m.stateTopic(d.DeviceID)
+		token := client.Publish(topic, uint8(cfg.MQTT.WillQoS), cfg.MQTT.WillRetain, jsonMsg)
+		token.Wait()
+		if token.Error() != nil {
+			errs = append(errs, fmt.Errorf("设备[%s]发布失败：%w", d.DeviceID, token.Error()))
+			continue
+		}
+		log.Printf("[INFO] [mqtt] 已上报设备在线状态，主题：%s，消息：%s", topic, string(jsonMsg))
+	}
+	return errors.Join(errs...)
+}
+
+// stateTopic 设备状态主题：遗嘱所属设备使用遗嘱主题（可由will_topic自定义），其余设备为 前缀/device_id/state
+func (m *Client) stateTopic(deviceID string) string {
+	if deviceID == m.cfg.Device.DeviceID {
+		return m.topicState
+	}
+	return m.topicFor(deviceID, "state")
+}
+
+// allowState 判断状态是否允许上报（状态变化立即上报；相同状态需间隔min_state_interval_sec）
+func (m *Client) allowState(state string) bool {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	now := m.now()
+	minInt := time.Duration(m.cfg.MQTT.MinStateIntervalSec) * time.Second
+	if state == m.lastState && now.Sub(m.lastStateAt) < minInt {
+		return false
+	}
+	m.lastState, m.lastStateAt = state, now
+	return true
 }
 
 // Publish 核心发布方法（v1.5.1专属，无SetCallback，异步非阻塞，适配OPM-1560B）
@@ -176,81 +412,499 @@ func (c *Client) Publish(mqttMsg *models.MQTTMessage) error {
 		log.Printf("[ERROR] [mqtt] 设备[%s]发布失败：%v", c.cfg.Device.DeviceID, err)
 		return err
 	}
-	if !c.isConnected || c.client.IsConnectionOpen() {
+	// 离线暂存：未连接（或队列中仍有待补发消息，保证顺序）时检测数据/汇总落盘；状态消息时效性强，不暂存
+	spoolable := c.spool != nil && mqttMsg.MsgType != models.MQTTMsgTypeState
+	if spoolable && (c.localOnly || !c.isConnected || !c.client.IsConnectionOpen() || c.spool.Len() > 0) {
+		return c.spoolMessage(mqttMsg)
+	}
+	if c.localOnly {
+		return errors.New("MQTT认证失败，已降级为本地模式")
+	}
+	if !c.isConnected || !c.client.IsConnectionOpen() {
 		err := errors.New("MQTT客户端未建立有效连接")
 		log.Printf("[ERROR] [mqtt] 设备[%s]发布失败：%v", c.cfg.Device.DeviceID, err)
 		return err
 	}
 
 	// 2. 标准化消息序列化（复用models层ToJSON方法，保证格式统一）
-	payload, err := mqttMsg.ToJSON()
+	payload, err := c.encode(mqttMsg)
 	if err != nil {
-		log.Printf("[ERROR] [mqtt] 设备[%s]消息序列化失败：%v", c.cfg.Device.DeviceID, err)
 		return err
 	}
 
-	// 3. 按消息类型生成标准化主题（data/state分离，适配物联网平台解析）
-	var topic string
-	switch mqttMsg.MsgType {
-	case models.MQTTMsgTypeData:
-		topic = c.cfg.MQTT.TopicPrefix + "/" + c.cfg.Device.DeviceID + "/data" // 检测数据主题
-	case models.MQTTMsgTypeState:
-		topic = c.cfg.MQTT.TopicPrefix + "/" + c.cfg.Device.DeviceID + "/state" // 设备状态主题
-	default:
-		err := errors.New("无效的MQTT消息类型，仅支持data/state")
+	// 3. 按消息类型生成标准化主题（data/state分离，适配物联网平台解析；共用连接时按消息设备SN区分）
+	topic, err := c.msgTopic(mqttMsg)
+	if err != nil {
 		log.Printf("[ERROR] [mqtt] 设备[%s]发布失败：%v", c.cfg.Device.DeviceID, err)
 		return err
 	}
 
+	// 熔断中：服务端降级，跳过发布避免无效重试刷屏；开启离线暂存时检测数据/汇总落盘，恢复后补发
+	// （放行后每条发布都须Record结果，否则半开探测无法释放）
+	if !c.breaker.Allow() {
+		if spoolable {
+			return c.spoolMessage(mqttMsg)
+		}
+		return errors.New("MQTT发布熔断中，跳过发布")
+	}
+
+	// 分项主题：检测数据按项拆分发布（only模式不再发布汇总消息）；
+	// 一条消息的分项与汇总发布合并为一次熔断结果，任一分项提交失败时返回错误
+	var items []itemToken
+	var itemErr error
+	if mode := c.cfg.MQTT.PerItemTopics; mode != "" && mqttMsg.MsgType == models.MQTTMsgTypeData {
+		if data, ok := mqttMsg.Content.(*models.OPM1560BDeviceData); ok {
+			items, itemErr = c.publishItems(data, mqttMsg.ReportTime)
+			if mode == config.PerItemOnly {
+				if itemErr != nil {
+					c.breaker.Record(itemErr)
+					return itemErr
+				}
+				go func() { c.breaker.Record(c.awaitItems(items)) }()
+				return nil
+			}
+		}
+	}
+
 	// 4. 发布消息（固化QoS1，满足医用数据至少一次送达要求）
 	// retained=false：非保留消息，贴合实时检测数据特性
 	tk := c.client.Publish(topic, byte(c.cfg.MQTT.QoS), false, payload)
 
-	// 5. 兜底nil token：即使前置校验，网络瞬断仍可能返回nil，直接报错
+	// 5. 兜底nil token：即使前置校验，网络瞬断仍可能返回nil；计入熔断，开启离线暂存时落盘待补发
 	if tk == nil {
 		err := errors.New("Publish调用返回nil Token，客户端连接异常")
 		log.Printf("[ERROR] [mqtt] 设备[%s]发布失败：%v | 主题：%s", c.cfg.Device.DeviceID, err, topic)
+		c.breaker.Record(err)
+		if spoolable {
+			// 分项已提交发布，仅暂存本条消息
+			return c.spoolEntry(spoolEntry{Topic: topic, DeviceID: mqttMsg.DeviceID, MsgType: mqttMsg.MsgType, ReportTime: mqttMsg.ReportTime, Payload: payload})
+		}
 		return err
 	}
 
+	// 审计哈希链：已提交发布的消息追加链条目
+	if c.ledgers != nil {
+		c.publishLedger(spoolEntry{Topic: topic, DeviceID: mqttMsg.DeviceID, MsgType: mqttMsg.MsgType, ReportTime: mqttMsg.ReportTime, Payload: payload})
+	}
+
 	// 闭包携带设备ID/主题/QoS，保证日志信息完整，不阻塞串口数据采集协程
 	go func(deviceID, topic string, qos byte) {
-		// 等待发布结果（同步，仅在协程内阻塞，不影响主流程）
-		if err := tk.Wait(); err == false {
+		// 等待发布结果（同步，仅在协程内阻塞，不影响主流程），发布错误以tk.Error()为准
+		tk.Wait()
+		err := tk.Error()
+		if err != nil {
 			log.Printf("[ERROR] [mqtt] 设备[%s]MQTT消息发布失败 | 主题：%s | QoS：%d | 错误：%v", deviceID, topic, qos, err)
 		} else {
 			log.Printf("[INFO] [mqtt] 设备[%s]MQTT消息发布成功 | 主题：%s | QoS：%d | 消息长度：%d字节", deviceID, topic, qos, len(payload))
 		}
-	}(c.cfg.Device.DeviceID, topic, byte(c.cfg.MQTT.QoS))
+		if ierr := c.awaitItems(items); err == nil {
+			err = ierr
+		}
+		if err == nil {
+			err = itemErr
+		}
+		c.breaker.Record(err)
+	}(c.deviceOf(mqttMsg.DeviceID), topic, byte(c.cfg.MQTT.QoS))
+
+	return itemErr
+}
+
+// encode 附加信封并序列化消息；开启validate_output时按内置schema校验，不符合的消息丢弃（调用方需持有c.mu）
+func (c *Client) encode(mqttMsg *models.MQTTMessage) ([]byte, error) {
+	c.stampEnvelope(mqttMsg)
+	payload, err := mqttMsg.ToJSON()
+	if err != nil {
+		log.Printf("[ERROR] [mqtt] 设备[%s]消息序列化失败：%v", c.cfg.Device.DeviceID, err)
+		return nil, err
+	}
+	if c.cfg.MQTT.ValidateOutput {
+		if err := models.ValidateMessageJSON(payload); err != nil {
+			log.Printf("[ERROR] [mqtt] 设备[%s]消息未通过schema校验，已丢弃：%v | 消息：%s", c.deviceOf(mqttMsg.DeviceID), err, payload)
+			return nil, fmt.Errorf("消息未通过schema校验：%w", err)
+		}
+	}
+	return payload, nil
+}
+
+// msgTopic 按消息类型生成标准化主题
+func (c *Client) msgTopic(mqttMsg *models.MQTTMessage) (string, error) {
+	switch mqttMsg.MsgType {
+	case models.MQTTMsgTypeData:
+		return c.topicFor(mqttMsg.DeviceID, "data"), nil // 检测数据主题
+	case models.MQTTMsgTypeState:
+		return c.topicFor(mqttMsg.DeviceID, "state"), nil // 设备状态主题
+	case models.MQTTMsgTypeSummary:
+		return c.topicFor(mqttMsg.DeviceID, "summary"), nil // 每日汇总主题
+	}
+	return "", errors.New("无效的MQTT消息类型，仅支持data/state/summary")
+}
+
+// deviceOf 消息所属设备SN（消息未携带时为本连接设备）
+func (c *Client) deviceOf(deviceID string) string {
+	if deviceID == "" {
+		return c.cfg.Device.DeviceID
+	}
+	return deviceID
+}
+
+// topicFor 设备主题：前缀/device_id/后缀
+func (c *Client) topicFor(deviceID, suffix string) string {
+	return c.cfg.MQTT.TopicPrefix + "/" + c.deviceOf(deviceID) + "/" + suffix
+}
+
+// itemEntries 检测数据分项消息（主题：前缀/device_id/data/<检测项>），reportTime为所属信封上报时间（哈希链条目使用）
+func (c *Client) itemEntries(data *models.OPM1560BDeviceData, reportTime string) []spoolEntry {
+	items := data.Items()
+	out := make([]spoolEntry, 0, len(items))
+	for _, item := range items {
+		payload, err := json.Marshal(item)
+		if err != nil {
+			log.Printf("[ERROR] [mqtt] 设备[%s]分项%s序列化失败：%v", c.cfg.Device.DeviceID, item.Item, err)
+			continue
+		}
+		out = append(out, spoolEntry{
+			Topic:      c.topicFor(data.DeviceID, "data/"+item.Item),
+			Retained:   c.cfg.MQTT.PerItemRetain,
+			DeviceID:   data.DeviceID,
+			MsgType:    models.MQTTMsgTypeData,
+			ReportTime: reportTime,
+			Payload:    payload,
+		})
+	}
+	return out
+}
+
+// itemToken 已提交的分项发布（主题及其Token）
+type itemToken struct {
+	topic string
+	tk    MQTT.Token
+}
+
+// publishItems 分项发布检测数据，开启哈希链时每条分项消息追加链条目（调用方需持有c.mu）；
+// 返回已提交的分项，有分项提交失败（nil Token）时同时返回错误，其余分项照常发布
+func (c *Client) publishItems(data *models.OPM1560BDeviceData, reportTime string) ([]itemToken, error) {
+	qos := byte(c.cfg.MQTT.QoS)
+	var items []itemToken
+	failed := 0
+	for _, e := range c.itemEntries(data, reportTime) {
+		tk := c.client.Publish(e.Topic, qos, e.Retained, []byte(e.Payload))
+		if tk == nil {
+			log.Printf("[ERROR] [mqtt] 设备[%s]分项发布失败：返回nil Token | 主题：%s", c.cfg.Device.DeviceID, e.Topic)
+			failed++
+			continue
+		}
+		if c.ledgers != nil {
+			c.publishLedger(e)
+		}
+		items = append(items, itemToken{topic: e.Topic, tk: tk})
+	}
+	if failed > 0 {
+		return items, fmt.Errorf("%d条分项发布失败：Publish调用返回nil Token", failed)
+	}
+	return items, nil
+}
+
+// awaitItems 等待分项发布结果并记录失败日志，返回首个错误（在发布协程外调用，不持有c.mu）
+func (c *Client) awaitItems(items []itemToken) error {
+	var first error
+	for _, it := range items {
+		if it.tk.Wait(); it.tk.Error() != nil {
+			log.Printf("[ERROR] [mqtt] 设备[%s]分项发布失败 | 主题：%s | 错误：%v", c.cfg.Device.DeviceID, it.topic, it.tk.Error())
+			if first == nil {
+				first = it.tk.Error()
+			}
+		}
+	}
+	return first
+}
+
+// spoolMessage 消息写入离线暂存队列（分项模式同时暂存分项消息，调用方需持有c.mu）
+func (c *Client) spoolMessage(mqttMsg *models.MQTTMessage) error {
+	topic, err := c.msgTopic(mqttMsg)
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode(mqttMsg)
+	if err != nil {
+		return err
+	}
+
+	var entries []spoolEntry
+	itemsOnly := false
+	if mode := c.cfg.MQTT.PerItemTopics; mode != "" && mqttMsg.MsgType == models.MQTTMsgTypeData {
+		if data, ok := mqttMsg.Content.(*models.OPM1560BDeviceData); ok {
+			entries = c.itemEntries(data, mqttMsg.ReportTime)
+			itemsOnly = mode == config.PerItemOnly
+		}
+	}
+	if !itemsOnly {
+		entries = append(entries, spoolEntry{Topic: topic, DeviceID: mqttMsg.DeviceID, MsgType: mqttMsg.MsgType, ReportTime: mqttMsg.ReportTime, Payload: payload})
+	}
+	for _, e := range entries {
+		if err := c.spool.Push(e); err != nil {
+			log.Printf("[ERROR] [mqtt] 设备[%s]离线暂存失败：%v", c.deviceOf(mqttMsg.DeviceID), err)
+			return err
+		}
+	}
+	log.Printf("[WARN] [mqtt] 设备[%s]MQTT未连接、熔断中或有待补发消息，已离线暂存（队列%d条） | 主题：%s",
+		c.deviceOf(mqttMsg.DeviceID), c.spool.Len(), topic)
+	return nil
+}
 
+// spoolEntry 单条已序列化消息写入离线暂存队列（调用方需持有c.mu）
+func (c *Client) spoolEntry(e spoolEntry) error {
+	if err := c.spool.Push(e); err != nil {
+		log.Printf("[ERROR] [mqtt] 设备[%s]离线暂存失败：%v", c.deviceOf(e.DeviceID), err)
+		return err
+	}
+	log.Printf("[WARN] [mqtt] 设备[%s]发布失败，已离线暂存（队列%d条） | 主题：%s", c.deviceOf(e.DeviceID), c.spool.Len(), e.Topic)
 	return nil
 }
 
+// flushSpool 按入队顺序补发离线暂存消息：逐条等待发布确认后删除，连接断开、熔断中或发布失败时停止，留待下次补发
+func (c *Client) flushSpool() {
+	if !c.flushing.CompareAndSwap(false, true) {
+		return // 已有补发协程运行
+	}
+	defer c.flushing.Store(false)
+
+	sent := 0
+	for c.ctx.Err() == nil {
+		e, seq, ok := c.spool.Peek()
+		if !ok {
+			break
+		}
+		c.mu.Lock()
+		var tk MQTT.Token
+		allowed := false
+		if !c.localOnly && c.isConnected && c.client.IsConnectionOpen() && c.breaker.Allow() {
+			allowed = true
+			tk = c.client.Publish(e.Topic, byte(c.cfg.MQTT.QoS), e.Retained, []byte(e.Payload))
+		}
+		c.mu.Unlock()
+		if tk == nil {
+			if allowed {
+				c.breaker.Record(errors.New("Publish调用返回nil Token"))
+			}
+			break // 已断开或熔断中，下次检查时继续
+		}
+		tk.Wait()
+		err := tk.Error()
+		c.breaker.Record(err)
+		if err != nil {
+			log.Printf("[ERROR] [mqtt] 离线暂存消息补发失败 | 主题：%s | 错误：%v", e.Topic, err)
+			break
+		}
+		if c.ledgers != nil && e.MsgType != "" {
+			c.mu.Lock()
+			c.publishLedger(e)
+			c.mu.Unlock()
+		}
+		c.spool.Remove(seq)
+		sent++
+	}
+	if sent > 0 {
+		log.Printf("[INFO] [mqtt] 已补发离线暂存消息%d条，剩余%d条", sent, c.spool.Len())
+	}
+}
+
+// Spooling 是否开启离线暂存（开启时未连接也可提交发布，消息落盘待补发）
+func (c *Client) Spooling() bool {
+	return c.spool != nil
+}
+
+// publishLedger 追加并发布消息所属设备的哈希链条目（主题：前缀/device_id/ledger，调用方需持有c.mu）；
+// 链头在发布协程内落盘，不占用发布锁
+func (c *Client) publishLedger(e spoolEntry) {
+	deviceID := c.deviceOf(e.DeviceID)
+	chain := c.ledgers[deviceID]
+	if chain == nil {
+		log.Printf("[ERROR] [mqtt] 设备[%s]不属于本连接，未追加哈希链条目 | 主题：%s", deviceID, e.Topic)
+		return
+	}
+	entry := chain.Append(deviceID, e.Topic, e.MsgType, e.ReportTime, e.Payload)
+	var tk MQTT.Token
+	if raw, err := json.Marshal(entry); err != nil {
+		log.Printf("[ERROR] [mqtt] 设备[%s]哈希链条目序列化失败：%v", deviceID, err)
+	} else if tk = c.client.Publish(c.topicFor(deviceID, "ledger"), byte(c.cfg.MQTT.QoS), false, raw); tk == nil {
+		log.Printf("[ERROR] [mqtt] 设备[%s]哈希链发布失败：返回nil Token", deviceID)
+	}
+	go func(seq uint64) {
+		if err := chain.Persist(); err != nil {
+			log.Printf("[ERROR] [mqtt] 设备[%s]哈希链头落盘失败：%v", deviceID, err)
+		}
+		if tk == nil {
+			return
+		}
+		if tk.Wait(); tk.Error() != nil {
+			log.Printf("[ERROR] [mqtt] 设备[%s]哈希链条目%d发布失败：%v", deviceID, seq, tk.Error())
+		}
+	}(entry.Seq)
+}
+
+// BreakerState 获取发布熔断器状态（closed/open/half_open）
+func (c *Client) BreakerState() string {
+	return c.breaker.State()
+}
+
+// stampEnvelope 为消息附加部署环境、静态标签与所属设备当前操作员/班次（调用方需持有c.mu）
+func (c *Client) stampEnvelope(mqttMsg *models.MQTTMessage) {
+	op := c.operators[c.deviceOf(mqttMsg.DeviceID)]
+	mqttMsg.Environment = c.cfg.App.Environment
+	mqttMsg.Tags = c.cfg.App.Tags
+	mqttMsg.OperatorID = op.id
+	mqttMsg.ShiftID = op.shift
+}
+
+// commandHandler 设备下行命令回调（paho消息处理协程中执行，命令仅作用于该设备）
+func (c *Client) commandHandler(deviceID string) MQTT.MessageHandler {
+	return func(_ MQTT.Client, msg MQTT.Message) {
+		if err := c.handleCommand(deviceID, msg.Payload()); err != nil {
+			log.Printf("[ERROR] [mqtt] 设备[%s]处理下行命令失败：%v，主题：%s，消息：%s", deviceID, err, msg.Topic(), string(msg.Payload()))
+		}
+	}
+}
+
+// handleCommand 解析并执行设备下行命令（set_operator：修改该设备当前操作员/班次，空值表示清除）
+func (c *Client) handleCommand(deviceID string, payload []byte) error {
+	var cmd models.MQTTCommand
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		return fmt.Errorf("命令解析失败：%w", err)
+	}
+
+	switch cmd.Cmd {
+	case models.MQTTCmdSetOperator:
+		c.mu.Lock()
+		c.operators[deviceID] = operator{id: cmd.OperatorID, shift: cmd.ShiftID}
+		c.mu.Unlock()
+		log.Printf("[INFO] [mqtt] 设备[%s]操作员已更新，操作员：%s，班次：%s", deviceID, cmd.OperatorID, cmd.ShiftID)
+		return nil
+	default:
+		return fmt.Errorf("未知命令：%s", cmd.Cmd)
+	}
+}
+
 // Close 优雅关闭MQTT客户端：主动上报offline+断开连接+取消协程
+// Publish自行加锁，此处仅在锁内读取连接状态，不可持锁调用
 func (m *Client) Close() {
+	defer m.setConnected(false, "mqtt_closed") // 释放锁后更新状态并触发回调
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if m.client != nil && m.isConnected {
-		// 1. 主动上报offline状态（程序正常退出，平台精准感知）
-		offlineMsg := models.NewMQTTMessage(
-			m.cfg.Device.DeviceID,
-			m.cfg.Device.Model,
-			models.MQTTMsgTypeState,
-			models.DeviceStateOffline,
-		)
-		if err := m.Publish(offlineMsg); err != nil {
-			log.Printf("[WARN] [mqtt] 发布离线状态失败：%v", err)
+	connected := m.client != nil && m.isConnected
+	m.mu.Unlock()
+
+	if connected {
+		// 1. 为本连接承载的每台设备主动上报offline状态（程序正常退出，平台精准感知）
+		for _, d := range m.devices {
+			offlineMsg := models.NewMQTTMessage(
+				d.DeviceID,
+				d.Model,
+				models.MQTTMsgTypeState,
+				models.DeviceStateOffline,
+			)
+			if err := m.Publish(offlineMsg); err != nil {
+				log.Printf("[WARN] [mqtt] 设备[%s]发布离线状态失败：%v", d.DeviceID, err)
+			}
 		}
 
 		// 2. 断开MQTT连接（paho标准方法，250ms等待消息发送完成）
 		m.client.Disconnect(250)
-		m.isConnected = false
 		log.Printf("[INFO] [mqtt] 客户端已关闭，服务端：%s", m.cfg.MQTT.Broker)
 	}
 
 	// 3. 取消协程
 	m.cancel()
+
+	// 4. 各设备链头落盘（发布协程可能尚未写入最新链头）
+	for deviceID, chain := range m.ledgers {
+		if err := chain.Persist(); err != nil {
+			log.Printf("[ERROR] [mqtt] 设备[%s]哈希链头落盘失败：%v", deviceID, err)
+		}
+	}
+
+	// 5. 报告未送达的离线暂存消息（重启后接续补发）
+	m.reportSpoolRemaining()
+}
+
+// reportSpoolRemaining 退出时记录离线暂存中未送达的消息数；开启warn_on_spool_remaining时以WARN输出
+func (m *Client) reportSpoolRemaining() {
+	if m.spool == nil {
+		return
+	}
+	n := m.spool.Len()
+	if n > 0 && m.cfg.App.WarnOnSpoolRemaining {
+		log.Printf("[WARN] [mqtt] 退出时离线暂存仍有%d条检测数据未送达平台（目录：%s），重启后补发", n, m.spool.dir)
+		return
+	}
+	log.Printf("[INFO] [mqtt] 退出时离线暂存剩余%d条未送达消息", n)
+}
+
+// SpoolEvicted 离线暂存因超过上限淘汰的未送达消息数（未开启暂存为0）
+func (m *Client) SpoolEvicted() uint64 {
+	if m.spool == nil {
+		return 0
+	}
+	return m.spool.Dropped()
+}
+
+// SpoolPending 离线暂存中待补发的消息数（未开启暂存为0）
+func (m *Client) SpoolPending() int {
+	if m.spool == nil {
+		return 0
+	}
+	return m.spool.Len()
+}
+
+// onConnectionLost 连接丢失回调：标记断开（重连协程据此发起重连）
+func (m *Client) onConnectionLost(_ MQTT.Client, err error) {
+	log.Printf("[ERROR] [mqtt] 连接丢失：%v", err)
+	m.setConnected(false, "mqtt_connection_lost")
+}
+
+// OnStateChange 注册连接状态变化回调（MQTT连接/丢失/重连/关闭时触发）
+func (m *Client) OnStateChange(fn models.StateChangeFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onState = fn
+}
+
+// setConnected 更新连接状态，状态发生变化时在锁外触发回调
+func (m *Client) setConnected(connected bool, reason string) {
+	m.mu.Lock()
+	old := m.isConnected
+	m.isConnected = connected
+	fn := m.onState
+	m.mu.Unlock()
+
+	if old != connected && fn != nil {
+		fn(models.ConnState(old), models.ConnState(connected), reason)
+	}
+}
+
+// enterLocalOnly 服务端拒绝认证：停止重连，降级为本地模式（串口采集/本地落盘照常），触发auth_failed回调
+func (m *Client) enterLocalOnly(err error) {
+	m.mu.Lock()
+	old := m.isConnected
+	m.isConnected = false
+	m.localOnly = true
+	fn := m.onState
+	m.mu.Unlock()
+
+	log.Printf("[ERROR] [mqtt] %v，停止重连，进入本地模式（修正mqtt.username/password后重启网关）", err)
+	if fn != nil {
+		fn(models.ConnState(old), models.DeviceStateLocalOnly, models.StateReasonAuthFailed)
+	}
+}
+
+// LocalOnly 是否已因认证失败降级为本地模式
+func (m *Client) LocalOnly() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.localOnly
+}
+
+// isAuthError 是否为服务端拒绝认证的CONNACK错误（返回码4/5）
+func isAuthError(err error) bool {
+	return errors.Is(err, packets.ErrorRefusedBadUsernameOrPassword) || errors.Is(err, packets.ErrorRefusedNotAuthorised)
 }
 
 // IsConnected 获取MQTT连接状态（供上游判断是否可发布数据）
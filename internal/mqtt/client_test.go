@@ -0,0 +1,790 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"opm-mqtt-gateway/internal/config"
+	"opm-mqtt-gateway/internal/models"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// fakeToken 模拟paho Token（立即完成，可指定错误）
+type fakeToken struct {
+	err error
+}
+
+func (t *fakeToken) Wait() bool                     { return true }
+func (t *fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (t *fakeToken) Done() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+func (t *fakeToken) Error() error { return t.err }
+
+// gateToken 模拟阻塞的paho Token（gate关闭前Wait不返回，模拟服务端无响应的长时间连接）
+type gateToken struct {
+	gate chan struct{}
+}
+
+func (t *gateToken) Wait() bool { <-t.gate; return true }
+func (t *gateToken) WaitTimeout(d time.Duration) bool {
+	select {
+	case <-t.gate:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+func (t *gateToken) Done() <-chan struct{} { return t.gate }
+func (t *gateToken) Error() error          { return nil }
+
+// fakePublish 模拟客户端记录的一次发布
+type fakePublish struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+}
+
+// fakeClient 模拟paho Client（记录发布内容，不连接服务端）
+type fakeClient struct {
+	mu          sync.Mutex
+	open        bool
+	published   []fakePublish
+	connectErr  error         // Connect返回的错误（模拟CONNACK拒绝）
+	publishErr  error         // Publish返回Token的错误（模拟发布失败）
+	connects    int           // Connect调用次数
+	connectGate chan struct{} // 非nil时Connect阻塞至gate关闭
+	nilToken    bool          // Publish返回nil Token（模拟网络瞬断）
+}
+
+func (f *fakeClient) IsConnected() bool      { return f.open }
+func (f *fakeClient) IsConnectionOpen() bool { return f.open }
+func (f *fakeClient) Connect() MQTT.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connects++
+	if f.connectGate != nil {
+		return &gateToken{gate: f.connectGate}
+	}
+	return &fakeToken{err: f.connectErr}
+}
+func (f *fakeClient) Disconnect(uint) {}
+func (f *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var b []byte
+	switch p := payload.(type) {
+	case []byte:
+		b = p
+	case string:
+		b = []byte(p)
+	}
+	if f.nilToken {
+		return nil
+	}
+	f.published = append(f.published, fakePublish{topic: topic, qos: qos, retained: retained, payload: b})
+	return &fakeToken{err: f.publishErr}
+}
+func (f *fakeClient) Subscribe(string, byte, MQTT.MessageHandler) MQTT.Token { return &fakeToken{} }
+func (f *fakeClient) SubscribeMultiple(map[string]byte, MQTT.MessageHandler) MQTT.Token {
+	return &fakeToken{}
+}
+func (f *fakeClient) Unsubscribe(...string) MQTT.Token        { return &fakeToken{} }
+func (f *fakeClient) AddRoute(string, MQTT.MessageHandler)    {}
+func (f *fakeClient) OptionsReader() MQTT.ClientOptionsReader { return MQTT.ClientOptionsReader{} }
+
+// publishedTo 统计发布到指定主题的消息
+func (f *fakeClient) publishedTo(topic string) []fakePublish {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []fakePublish
+	for _, p := range f.published {
+		if p.topic == topic {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// newTestClient 基于模拟配置新建客户端（不连接服务端，仅测试消息组装/命令处理）
+func newTestClient() *Client {
+	cfg := &config.Config{
+		App: config.AppConfig{
+			OperatorID: "OP001",
+			ShiftID:    "DAY",
+		},
+		Device: config.DeviceConfig{
+			DeviceID: "SN1234567890", // 测试设备SN
+			Model:    "OPM-1560B",
+		},
+		MQTT: config.MQTTConfig{
+			TopicPrefix:         "opm1560b",
+			QoS:                 1,
+			WillQoS:             1,
+			WillRetain:          true,
+			MinStateIntervalSec: 10,
+		},
+	}
+	return &Client{
+		cfg:        cfg,
+		topicState: "opm1560b/SN1234567890/state",
+		devices:    cfg.ConnDevices(),
+		operators:  map[string]operator{cfg.Device.DeviceID: {id: cfg.App.OperatorID, shift: cfg.App.ShiftID}},
+		now:        time.Now,
+		breaker:    newBreaker(0, 0),
+	}
+}
+
+// TestStampOperator_CommandUpdate 测试：操作员ID随消息上报，且可通过下行命令修改
+func TestStampOperator_CommandUpdate(t *testing.T) {
+	c := newTestClient()
+
+	msg := models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, "x")
+	c.stampEnvelope(msg)
+	payload, _ := msg.ToJSON()
+	if !strings.Contains(string(payload), `"operator_id":"OP001"`) || !strings.Contains(string(payload), `"shift_id":"DAY"`) {
+		t.Fatalf("消息未携带配置的操作员/班次：%s", payload)
+	}
+
+	// 下行命令修改操作员
+	if err := c.handleCommand("SN1234567890", []byte(`{"cmd":"set_operator","operator_id":"OP002","shift_id":"NIGHT"}`)); err != nil {
+		t.Fatalf("处理set_operator命令失败：%v", err)
+	}
+	msg = models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, "x")
+	c.stampEnvelope(msg)
+	payload, _ = msg.ToJSON()
+	if !strings.Contains(string(payload), `"operator_id":"OP002"`) || !strings.Contains(string(payload), `"shift_id":"NIGHT"`) {
+		t.Errorf("命令修改后消息操作员/班次错误：%s", payload)
+	}
+	t.Logf("操作员命令修改成功，消息：%s", payload)
+}
+
+// TestHandleCommand_Unknown 测试：未知命令/非法JSON返回错误，不修改操作员
+func TestHandleCommand_Unknown(t *testing.T) {
+	c := newTestClient()
+	if err := c.handleCommand("SN1234567890", []byte(`{"cmd":"reboot"}`)); err == nil {
+		t.Error("未知命令未返回错误")
+	}
+	if err := c.handleCommand("SN1234567890", []byte(`not json`)); err == nil {
+		t.Error("非法JSON未返回错误")
+	}
+	if op := c.operators["SN1234567890"]; op.id != "OP001" {
+		t.Errorf("操作员被意外修改：%s", op.id)
+	}
+}
+
+// TestRptOnlineState_SuppressFlapping 测试：间隔内多次重连只上报一次online，超过间隔后再次上报
+func TestRptOnlineState_SuppressFlapping(t *testing.T) {
+	c := newTestClient()
+	fc := &fakeClient{open: true}
+	now := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	// 10s间隔内连续重连5次
+	for i := 0; i < 5; i++ {
+		if err := c.rptOnlineState(fc); err != nil {
+			t.Fatalf("上报online失败：%v", err)
+		}
+		now = now.Add(time.Second)
+	}
+	if n := len(fc.publishedTo(c.topicState)); n != 1 {
+		t.Fatalf("间隔内online上报次数错误，预期1，实际%d", n)
+	}
+
+	// 超过间隔后再次重连，应重新上报
+	now = now.Add(10 * time.Second)
+	if err := c.rptOnlineState(fc); err != nil {
+		t.Fatalf("上报online失败：%v", err)
+	}
+	states := fc.publishedTo(c.topicState)
+	if len(states) != 2 {
+		t.Fatalf("超过间隔后online上报次数错误，预期2，实际%d", len(states))
+	}
+	if !states[0].retained || !strings.Contains(string(states[0].payload), models.DeviceStateOnline) {
+		t.Errorf("online状态消息错误：%+v", states[0])
+	}
+}
+
+// TestSharedConnection_PerDevice 测试：shared模式每台设备各自上报online、下行命令仅修改所属设备操作员
+func TestSharedConnection_PerDevice(t *testing.T) {
+	c := newTestClient()
+	c.devices = []config.DeviceConfig{c.cfg.Device, {DeviceID: "SN0000000002", Model: "OPM-1560B"}}
+	c.operators["SN0000000002"] = operator{id: "OP001", shift: "DAY"}
+	fc := &fakeClient{open: true}
+
+	if err := c.rptOnlineState(fc); err != nil {
+		t.Fatalf("上报online失败：%v", err)
+	}
+	if len(fc.publishedTo(c.topicState)) != 1 || len(fc.publishedTo("opm1560b/SN0000000002/state")) != 1 {
+		t.Fatalf("每台设备应各上报一次online：%+v", fc.published)
+	}
+	if p := fc.publishedTo("opm1560b/SN0000000002/state")[0]; !strings.Contains(string(p.payload), `"device_id":"SN0000000002"`) {
+		t.Errorf("第二台设备online消息设备ID错误：%s", p.payload)
+	}
+
+	if err := c.handleCommand("SN0000000002", []byte(`{"cmd":"set_operator","operator_id":"OP002","shift_id":"NIGHT"}`)); err != nil {
+		t.Fatalf("处理set_operator命令失败：%v", err)
+	}
+	for id, want := range map[string]string{"SN1234567890": "OP001", "SN0000000002": "OP002"} {
+		msg := models.NewMQTTMessage(id, "OPM-1560B", models.MQTTMsgTypeData, "x")
+		c.stampEnvelope(msg)
+		if msg.OperatorID != want {
+			t.Errorf("设备[%s]操作员错误：预期%s，实际%s", id, want, msg.OperatorID)
+		}
+	}
+}
+
+// TestAllowState_ChangeAlwaysPublished 测试：状态变化不受间隔限制
+func TestAllowState_ChangeAlwaysPublished(t *testing.T) {
+	c := newTestClient()
+	now := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	if !c.allowState(models.DeviceStateOnline) {
+		t.Fatal("首次online未允许上报")
+	}
+	if !c.allowState(models.DeviceStateError) {
+		t.Error("状态变化（online→error）被错误抑制")
+	}
+	if c.allowState(models.DeviceStateError) {
+		t.Error("间隔内重复error未被抑制")
+	}
+}
+
+// TestOnStateChange_ConnectionLost 测试：连接丢失触发online→offline回调，并标记断开以触发重连
+func TestOnStateChange_ConnectionLost(t *testing.T) {
+	c := newTestClient()
+	c.isConnected = true
+
+	var got []string
+	c.OnStateChange(func(old, new, reason string) {
+		got = append(got, old+"->"+new+":"+reason)
+	})
+
+	c.onConnectionLost(&fakeClient{}, errors.New("EOF"))
+	if c.IsConnected() {
+		t.Fatal("连接丢失后仍标记为已连接")
+	}
+	c.setConnected(true, "mqtt_reconnected")
+
+	want := []string{"online->offline:mqtt_connection_lost", "offline->online:mqtt_reconnected"}
+	if len(got) != len(want) {
+		t.Fatalf("回调次数错误，预期%v，实际%v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("第%d次回调错误，预期%s，实际%s", i+1, want[i], got[i])
+		}
+	}
+}
+
+// TestPublishItems_Topics 测试：检测数据按项发布到 data/<检测项> 子主题
+func TestPublishItems_Topics(t *testing.T) {
+	c := newTestClient()
+	c.cfg.MQTT.PerItemTopics = config.PerItemAlso
+	c.cfg.MQTT.PerItemRetain = true
+	fc := &fakeClient{open: true}
+	c.client = fc
+
+	data := &models.OPM1560BDeviceData{
+		DeviceID:  "SN1234567890",
+		PH:        6.5,
+		Glucose:   "-",
+		TestTime:  "2026-01-01T00:00:00Z",
+		DataState: models.DataStateNormal,
+	}
+	if _, err := c.publishItems(data, "2026-01-01T00:00:00Z"); err != nil {
+		t.Fatalf("分项发布失败：%v", err)
+	}
+
+	if n := len(fc.published); n != 12 {
+		t.Fatalf("分项消息数量错误，期望12，实际%d", n)
+	}
+	ph := fc.publishedTo("opm1560b/SN1234567890/data/ph")
+	if len(ph) != 1 {
+		t.Fatalf("ph分项主题应发布1条，实际%d", len(ph))
+	}
+	if !ph[0].retained || ph[0].qos != 1 {
+		t.Fatalf("分项消息QoS/保留标志错误：qos=%d retained=%v", ph[0].qos, ph[0].retained)
+	}
+	var item models.ItemValue
+	if err := json.Unmarshal(ph[0].payload, &item); err != nil {
+		t.Fatalf("分项消息反序列化失败：%v", err)
+	}
+	if item.Item != "ph" || item.Value != 6.5 || item.DeviceID != "SN1234567890" {
+		t.Fatalf("ph分项内容错误：%+v", item)
+	}
+
+	// 共用连接：其他设备的检测数据发布到该设备自己的主题
+	data.DeviceID = "SN-B"
+	if _, err := c.publishItems(data, "2026-01-01T00:00:00Z"); err != nil {
+		t.Fatalf("分项发布失败：%v", err)
+	}
+	if n := len(fc.publishedTo("opm1560b/SN-B/data/ph")); n != 1 {
+		t.Fatalf("共用连接时分项主题应按数据设备SN区分，实际发布%d条", n)
+	}
+}
+
+// TestPublish_ConnectionGuard 测试：连接正常时Publish放行并发布到data主题，底层连接已断开时拒绝发布
+func TestPublish_ConnectionGuard(t *testing.T) {
+	c := newTestClient()
+	fc := &fakeClient{open: true}
+	c.client = fc
+	c.isConnected = true
+
+	msg := models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, "x")
+	if err := c.Publish(msg); err != nil {
+		t.Fatalf("连接正常时发布失败：%v", err)
+	}
+	if n := len(fc.publishedTo("opm1560b/SN1234567890/data")); n != 1 {
+		t.Fatalf("data主题发布数量错误，期望1，实际%d", n)
+	}
+
+	fc.open = false
+	if err := c.Publish(msg); err == nil {
+		t.Fatalf("底层连接已断开时应拒绝发布")
+	}
+}
+
+// TestPublish_SpoolWhileDownFlushOnReconnect 测试：断开期间检测数据落盘，有待补发消息时新消息继续排队，重连后按序补发
+func TestPublish_SpoolWhileDownFlushOnReconnect(t *testing.T) {
+	c := newTestClient()
+	c.cfg.MQTT.ReconnectInt = 1
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	defer c.cancel()
+	fc := &fakeClient{open: true}
+	c.client = fc
+	var err error
+	if c.spool, err = newSpool(t.TempDir(), 100, 0); err != nil {
+		t.Fatalf("新建暂存队列失败：%v", err)
+	}
+	publish := func(content string) {
+		t.Helper()
+		if err := c.Publish(models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, content)); err != nil {
+			t.Fatalf("开启离线暂存时发布不应失败：%v", err)
+		}
+	}
+
+	// 断开期间：消息落盘，不发布
+	publish("s1")
+	publish("s2")
+	// 连接已恢复但队列未补发完：新消息排在队尾，保证顺序
+	c.isConnected = true
+	publish("s3")
+	if n := len(fc.publishedTo("opm1560b/SN1234567890/data")); n != 0 || c.spool.Len() != 3 {
+		t.Fatalf("暂存期间不应直接发布：已发布%d条，队列%d条", n, c.spool.Len())
+	}
+
+	// 重连协程恢复连接后补发
+	c.isConnected = false
+	go c.reconnectLoop(c.loopGen.Load())
+	deadline := time.Now().Add(2 * time.Second)
+	for c.spool.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	got := fc.publishedTo("opm1560b/SN1234567890/data")
+	if len(got) != 3 {
+		t.Fatalf("重连后补发数量错误：期望3，实际%d（队列剩余%d）", len(got), c.spool.Len())
+	}
+	for i, want := range []string{`"content":"s1"`, `"content":"s2"`, `"content":"s3"`} {
+		if !strings.Contains(string(got[i].payload), want) {
+			t.Fatalf("第%d条补发顺序错误：%s", i+1, got[i].payload)
+		}
+	}
+}
+
+// logCapture 并发安全的日志捕获（发布结果在异步协程中记录）
+type logCapture struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (l *logCapture) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+func (l *logCapture) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
+
+// TestPublish_TokenErrorLogged 测试：Token返回发布错误时记录失败日志
+func TestPublish_TokenErrorLogged(t *testing.T) {
+	logs := &logCapture{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	c := newTestClient()
+	c.client = &fakeClient{open: true, publishErr: errors.New("broker rejected")}
+	c.isConnected = true
+	if err := c.Publish(models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, "x")); err != nil {
+		t.Fatalf("提交发布失败：%v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(logs.String(), "broker rejected") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	out := logs.String()
+	if !strings.Contains(out, "MQTT消息发布失败") || !strings.Contains(out, "broker rejected") {
+		t.Fatalf("发布错误未记录失败日志：%s", out)
+	}
+}
+
+// TestStampEnvelope_Environment 测试：部署环境标识随消息上报
+func TestStampEnvelope_Environment(t *testing.T) {
+	c := newTestClient()
+	c.cfg.App.Environment = "prod"
+
+	msg := models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, "x")
+	c.stampEnvelope(msg)
+	payload, _ := msg.ToJSON()
+	if !strings.Contains(string(payload), `"environment":"prod"`) {
+		t.Fatalf("消息未携带环境标识：%s", payload)
+	}
+}
+
+// TestReconnect_AuthFailedLocalOnly 测试：服务端拒绝认证时停止重连，降级为本地模式并触发auth_failed回调
+func TestReconnect_AuthFailedLocalOnly(t *testing.T) {
+	c := newTestClient()
+	c.cfg.MQTT.AuthFailLocalOnly = true
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	defer c.cancel()
+	fc := &fakeClient{connectErr: fmt.Errorf("%w : connack rc=4", packets.ErrorRefusedBadUsernameOrPassword)}
+	c.client = fc
+
+	var reasons []string
+	c.OnStateChange(func(old, new, reason string) {
+		reasons = append(reasons, new+"/"+reason)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		c.reconnectLoop(c.loopGen.Load())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("认证失败后重连协程未退出")
+	}
+
+	if fc.connects != 1 {
+		t.Errorf("认证失败不应重试，Connect调用%d次", fc.connects)
+	}
+	if !c.LocalOnly() {
+		t.Fatalf("认证失败后应进入本地模式")
+	}
+	if len(reasons) != 1 || reasons[0] != models.DeviceStateLocalOnly+"/"+models.StateReasonAuthFailed {
+		t.Errorf("状态回调错误：%v", reasons)
+	}
+	if err := c.Publish(models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, "x")); err == nil {
+		t.Errorf("本地模式下发布应直接返回错误")
+	}
+}
+
+// TestStampEnvelope_Tags 测试：静态标签平铺到发布消息顶层
+func TestStampEnvelope_Tags(t *testing.T) {
+	c := newTestClient()
+	c.cfg.App.Tags = map[string]string{"ward": "3F", "asset": "A-001"}
+
+	msg := models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, "x")
+	c.stampEnvelope(msg)
+	payload, err := msg.ToJSON()
+	if err != nil {
+		t.Fatalf("序列化失败：%v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(payload, &got); err != nil {
+		t.Fatalf("带标签消息不是合法JSON：%v，%s", err, payload)
+	}
+	if got["ward"] != "3F" || got["asset"] != "A-001" || got["device_id"] != "SN1234567890" {
+		t.Fatalf("静态标签未平铺到消息顶层：%s", payload)
+	}
+}
+
+// TestConnectWithRetry_NoLockDuringWait 测试：连接等待期间不持有互斥锁，IsConnected/Publish不被阻塞（配合-race运行）
+func TestConnectWithRetry_NoLockDuringWait(t *testing.T) {
+	c := newTestClient()
+	fc := &fakeClient{connectGate: make(chan struct{})}
+	c.client = fc
+
+	done := make(chan error)
+	go func() { done <- c.connectWithRetry(c.loopGen.Load()) }()
+
+	// 连接阻塞期间并发查询状态/发布，须在超时前全部返回
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = c.IsConnected()
+				_ = c.Publish(models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, "x"))
+			}
+		}()
+	}
+	contended := make(chan struct{})
+	go func() { wg.Wait(); close(contended) }()
+	select {
+	case <-contended:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("连接等待期间IsConnected/Publish被阻塞，疑似持锁等待")
+	}
+
+	close(fc.connectGate)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("连接应成功：%v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("连接放行后connectWithRetry未返回")
+	}
+}
+
+// TestCheckReconnectLoop_RestartStalled 测试：断开期间重连协程长时间未推进时看门狗重启协程，连接正常时不干预
+func TestCheckReconnectLoop_RestartStalled(t *testing.T) {
+	c := newTestClient()
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.cancel() // 重启出的新协程立即退出，避免真实重连
+	c.client = &fakeClient{}
+	now := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	c.loopAt.Store(now.Add(-time.Minute).UnixNano())
+
+	c.isConnected = true
+	if c.checkReconnectLoop(10 * time.Second) {
+		t.Fatalf("连接正常时不应重启重连协程")
+	}
+
+	c.isConnected = false
+	gen := c.loopGen.Load()
+	if !c.checkReconnectLoop(10 * time.Second) {
+		t.Fatalf("重连协程卡死应被重启")
+	}
+	if c.loopGen.Load() != gen+1 || !c.LoopLastIteration().Equal(now) {
+		t.Fatalf("重启后代数/推进时间未更新：gen=%d，last=%v", c.loopGen.Load(), c.LoopLastIteration())
+	}
+	if c.checkReconnectLoop(10 * time.Second) {
+		t.Fatalf("刚重启的协程不应再次判定卡死")
+	}
+}
+
+// TestCheckReconnectLoop_AbandonsHungLoop 测试：旧协程卡死在连接等待时看门狗不等待、立即启动新一代协程，
+// 旧协程解除阻塞后发现代数变化退出
+func TestCheckReconnectLoop_AbandonsHungLoop(t *testing.T) {
+	logs := &logCapture{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	c := newTestClient()
+	c.cfg.MQTT.ReconnectInt = 1
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	defer c.cancel()
+	fc := &fakeClient{connectGate: make(chan struct{})}
+	c.client = fc
+	connects := func() int {
+		fc.mu.Lock()
+		defer fc.mu.Unlock()
+		return fc.connects
+	}
+
+	c.startReconnectLoop()
+	deadline := time.Now().Add(2 * time.Second)
+	for connects() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	gen := c.loopGen.Load()
+	restarted := make(chan bool)
+	go func() { restarted <- c.checkReconnectLoop(time.Millisecond) }()
+	select {
+	case ok := <-restarted:
+		if !ok || c.loopGen.Load() != gen+1 {
+			t.Fatalf("旧协程卡死时应启动新一代协程：restarted=%v gen=%d", ok, c.loopGen.Load())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("看门狗等待卡死的旧协程，未能重启")
+	}
+
+	close(fc.connectGate)
+	deadline = time.Now().Add(3 * time.Second)
+	for !strings.Contains(logs.String(), "旧协程退出") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !strings.Contains(logs.String(), "旧协程退出") {
+		t.Fatalf("旧协程解除阻塞后未退出：%s", logs.String())
+	}
+	if !c.IsConnected() {
+		t.Errorf("连接成功后应判定在线")
+	}
+}
+
+// TestClose_NoDeadlock 测试：已连接时Close发布离线状态不发生自锁
+func TestClose_NoDeadlock(t *testing.T) {
+	c := newTestClient()
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.client = &fakeClient{open: true}
+	c.isConnected = true
+
+	done := make(chan struct{})
+	go func() {
+		c.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Close发生死锁")
+	}
+	if c.IsConnected() {
+		t.Errorf("Close后连接状态应为断开")
+	}
+}
+
+// TestClose_WarnsSpoolRemaining 测试：退出时离线暂存仍有消息，开启warn_on_spool_remaining后输出WARN及剩余条数
+func TestClose_WarnsSpoolRemaining(t *testing.T) {
+	logs := &logCapture{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	c := newTestClient()
+	c.cfg.App.WarnOnSpoolRemaining = true
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.client = &fakeClient{}
+	var err error
+	if c.spool, err = newSpool(t.TempDir(), 100, 0); err != nil {
+		t.Fatalf("新建暂存队列失败：%v", err)
+	}
+	for _, content := range []string{"a", "b"} {
+		if err := c.Publish(models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, content)); err != nil {
+			t.Fatalf("离线暂存失败：%v", err)
+		}
+	}
+
+	c.Close()
+	if out := logs.String(); !strings.Contains(out, "[WARN] [mqtt] 退出时离线暂存仍有2条") {
+		t.Fatalf("退出时未告警未送达消息：%s", out)
+	}
+	if n := c.SpoolPending(); n != 2 {
+		t.Errorf("未送达消息数错误，预期2，实际%d", n)
+	}
+}
+
+// TestPublish_ValidateOutputDropsBroken 测试：开启出站校验时内容损坏的消息不发布，合法消息照常发布
+func TestPublish_ValidateOutputDropsBroken(t *testing.T) {
+	c := newTestClient()
+	c.cfg.MQTT.ValidateOutput = true
+	fc := &fakeClient{open: true}
+	c.client = fc
+	c.isConnected = true
+
+	broken := models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData,
+		map[string]interface{}{"ph": "not-a-number", "data_state": "normal"})
+	if err := c.Publish(broken); err == nil {
+		t.Fatalf("内容损坏的消息应未通过校验")
+	}
+	if n := len(fc.publishedTo("opm1560b/SN1234567890/data")); n != 0 {
+		t.Fatalf("未通过校验的消息不应发布，实际发布%d条", n)
+	}
+
+	data := models.NewOPM1560BDeviceData("SN1234567890", "OPM-1560B")
+	data.PH, data.SpecificGrav = 6.5, 1.015
+	if err := c.Publish(models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, data)); err != nil {
+		t.Fatalf("合法消息发布失败：%v", err)
+	}
+	if n := len(fc.publishedTo("opm1560b/SN1234567890/data")); n != 1 {
+		t.Fatalf("合法消息应发布1条，实际%d条", n)
+	}
+}
+
+// TestPublish_BreakerOpenSpools 测试：开启离线暂存时，熔断中或返回nil Token的检测数据落盘而非丢弃，且半开探测被释放
+func TestPublish_BreakerOpenSpools(t *testing.T) {
+	c := newTestClient()
+	c.isConnected = true
+	fc := &fakeClient{open: true}
+	c.client = fc
+	var err error
+	if c.spool, err = newSpool(t.TempDir(), 100, 0); err != nil {
+		t.Fatalf("新建暂存队列失败：%v", err)
+	}
+	now := time.Now()
+	c.breaker = newBreaker(1, time.Minute)
+	c.breaker.now = func() time.Time { return now }
+	c.breaker.Record(errors.New("boom"))
+
+	// 熔断中：落盘，不发布
+	if err := c.Publish(models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, "d1")); err != nil {
+		t.Fatalf("熔断中开启离线暂存时发布不应失败：%v", err)
+	}
+	if n := len(fc.publishedTo("opm1560b/SN1234567890/data")); n != 0 || c.spool.Len() != 1 {
+		t.Fatalf("熔断中应落盘而非发布：已发布%d条，队列%d条", n, c.spool.Len())
+	}
+
+	// 冷却结束半开探测，Publish返回nil Token：落盘并记录失败，探测不得卡住
+	_, seq, _ := c.spool.Peek()
+	c.spool.Remove(seq)
+	now = now.Add(2 * time.Minute)
+	fc.nilToken = true
+	if err := c.Publish(models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, "d2")); err != nil {
+		t.Fatalf("nil Token时开启离线暂存不应失败：%v", err)
+	}
+	if c.spool.Len() != 1 {
+		t.Fatalf("nil Token的消息应落盘，队列%d条", c.spool.Len())
+	}
+	if got := c.breaker.State(); got != BreakerOpen {
+		t.Fatalf("探测失败应重新熔断，实际%s", got)
+	}
+	now = now.Add(2 * time.Minute)
+	if !c.breaker.Allow() {
+		t.Fatal("探测结果已记录，冷却后应再次放行探测")
+	}
+}
+
+// TestPublish_PerItemOnlyFailure 测试：only模式分项提交失败时Publish返回错误，且整条消息只计一次熔断结果
+func TestPublish_PerItemOnlyFailure(t *testing.T) {
+	c := newTestClient()
+	c.cfg.MQTT.PerItemTopics = config.PerItemOnly
+	c.isConnected = true
+	fc := &fakeClient{open: true, nilToken: true}
+	c.client = fc
+	c.breaker = newBreaker(2, time.Minute)
+
+	data := models.NewOPM1560BDeviceData("SN1234567890", "OPM-1560B")
+	if err := c.Publish(models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, data)); err == nil {
+		t.Fatal("分项发布失败时应返回错误")
+	}
+	if got := c.breaker.State(); got != BreakerClosed {
+		t.Fatalf("一条消息只应计一次失败（阈值2），熔断器状态：%s", got)
+	}
+
+	// 分项全部成功：异步记录一次成功
+	fc.nilToken = false
+	if err := c.Publish(models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, data)); err != nil {
+		t.Fatalf("分项发布成功时不应返回错误：%v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for c.breaker.failuresNow() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := c.breaker.failuresNow(); n != 0 {
+		t.Fatalf("分项发布成功后连续失败数应清零，实际%d", n)
+	}
+}
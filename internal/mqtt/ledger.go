@@ -0,0 +1,99 @@
+package mqtt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"opm-mqtt-gateway/internal/models"
+)
+
+// ledgerHead 链头持久化内容（重启后从此处续链）
+type ledgerHead struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// ledger 发布消息哈希链：每条消息生成 sha256(前一条链哈希+消息哈希)，平台据此校验消息无丢失/篡改
+// 链头在发布锁外落盘（Persist），不阻塞发布流程
+type ledger struct {
+	mu     sync.Mutex
+	saveMu sync.Mutex // 串行化链头落盘，保证最后一次写入的是最新链头
+	path   string     // 链头持久化文件（为空则仅内存，重启后重新起链）
+	head   ledgerHead
+}
+
+// newLedger 新建哈希链（链头文件存在则续链）
+func newLedger(path string) (*ledger, error) {
+	l := &ledger{path: path}
+	if path == "" {
+		return l, nil
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取链头文件失败：%w", err)
+	}
+	if err := json.Unmarshal(raw, &l.head); err != nil {
+		return nil, fmt.Errorf("解析链头文件失败：%w", err)
+	}
+	return l, nil
+}
+
+// Append 追加一条已发布消息，返回链条目（仅更新内存链头，由调用方在锁外调用Persist落盘）
+func (l *ledger) Append(deviceID, topic, msgType, reportTime string, payload []byte) *models.LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sum := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(sum[:])
+	entry := &models.LedgerEntry{
+		Seq:         l.head.Seq + 1,
+		MsgID:       payloadHash[:16],
+		DeviceID:    deviceID,
+		Topic:       topic,
+		PrevHash:    l.head.Hash,
+		PayloadHash: payloadHash,
+		MsgType:     msgType,
+		ReportTime:  reportTime,
+	}
+	entry.Hash = models.LedgerHash(entry.PrevHash, entry.PayloadHash)
+	l.head = ledgerHead{Seq: entry.Seq, Hash: entry.Hash}
+	return entry
+}
+
+// Persist 持久化当前链头（并发调用时最后一次写入的总是最新链头）
+func (l *ledger) Persist() error {
+	l.saveMu.Lock()
+	defer l.saveMu.Unlock()
+	l.mu.Lock()
+	head := l.head
+	l.mu.Unlock()
+	return l.save(head)
+}
+
+// save 持久化链头（先写临时文件再改名，避免断电写坏）
+func (l *ledger) save(head ledgerHead) error {
+	if l.path == "" {
+		return nil
+	}
+	raw, err := json.Marshal(head)
+	if err != nil {
+		return fmt.Errorf("序列化链头失败：%w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("创建链头目录失败：%w", err)
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return fmt.Errorf("写入链头文件失败：%w", err)
+	}
+	return os.Rename(tmp, l.path)
+}
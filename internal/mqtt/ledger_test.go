@@ -0,0 +1,145 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"opm-mqtt-gateway/internal/config"
+	"opm-mqtt-gateway/internal/models"
+)
+
+// TestLedger_ChainLinks 测试：哈希链逐条链接，且重启后从持久化链头续链
+func TestLedger_ChainLinks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.head")
+	l, err := newLedger(path)
+	if err != nil {
+		t.Fatalf("新建哈希链失败：%v", err)
+	}
+
+	var entries []*models.LedgerEntry
+	for _, payload := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		entries = append(entries, l.Append("SN1234567890", "opm1560b/SN1234567890/data", models.MQTTMsgTypeData, "2026-02-03T10:00:00Z", []byte(payload)))
+	}
+	if err := l.Persist(); err != nil {
+		t.Fatalf("链头落盘失败：%v", err)
+	}
+
+	// 重启：重新加载链头后继续追加
+	l2, err := newLedger(path)
+	if err != nil {
+		t.Fatalf("重新加载哈希链失败：%v", err)
+	}
+	entries = append(entries, l2.Append("SN1234567890", "opm1560b/SN1234567890/state", models.MQTTMsgTypeState, "2026-02-03T10:00:01Z", []byte(`"online"`)))
+
+	prev := ""
+	for i, e := range entries {
+		if e.Seq != uint64(i+1) {
+			t.Fatalf("第%d条序号错误：%d", i+1, e.Seq)
+		}
+		if e.PrevHash != prev {
+			t.Fatalf("第%d条前序哈希未链接上一条：%s != %s", i+1, e.PrevHash, prev)
+		}
+		if e.Hash != models.LedgerHash(e.PrevHash, e.PayloadHash) {
+			t.Fatalf("第%d条链哈希校验失败", i+1)
+		}
+		prev = e.Hash
+	}
+}
+
+// TestPublish_LedgerEntry 测试：开启哈希链时发布消息同时发布链条目
+func TestPublish_LedgerEntry(t *testing.T) {
+	c := newTestClient()
+	chain, _ := newLedger("")
+	c.ledgers = map[string]*ledger{"SN1234567890": chain}
+	fc := &fakeClient{open: true}
+	c.client = fc
+
+	c.publishLedger(spoolEntry{Topic: "opm1560b/SN1234567890/data", MsgType: models.MQTTMsgTypeData, Payload: []byte(`{"n":1}`)})
+	got := fc.publishedTo("opm1560b/SN1234567890/ledger")
+	if len(got) != 1 {
+		t.Fatalf("链条目发布数量错误，预期1，实际%d", len(got))
+	}
+	var e models.LedgerEntry
+	if err := json.Unmarshal(got[0].payload, &e); err != nil {
+		t.Fatalf("链条目反序列化失败：%v", err)
+	}
+	sum := sha256.Sum256([]byte(`{"n":1}`))
+	if e.Seq != 1 || e.PrevHash != "" || e.MsgType != models.MQTTMsgTypeData ||
+		e.MsgID != hex.EncodeToString(sum[:])[:16] || e.DeviceID != "SN1234567890" || e.Topic != "opm1560b/SN1234567890/data" {
+		t.Errorf("链条目内容错误：%+v", e)
+	}
+}
+
+// TestFlushSpool_LedgerCarriesDevice 测试：shared模式离线暂存补发后，链条目追加到原消息设备的哈希链及其ledger主题
+func TestFlushSpool_LedgerCarriesDevice(t *testing.T) {
+	c := newTestClient()
+	own, _ := newLedger("")
+	other, _ := newLedger("")
+	c.ledgers = map[string]*ledger{"SN1234567890": own, "SN0000000002": other}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	defer c.cancel()
+	var err error
+	if c.spool, err = newSpool(t.TempDir(), 0, 0); err != nil {
+		t.Fatalf("新建暂存队列失败：%v", err)
+	}
+	fc := &fakeClient{}
+	c.client = fc
+	if err := c.Publish(models.NewMQTTMessage("SN0000000002", "OPM-1560B", models.MQTTMsgTypeData, "x")); err != nil {
+		t.Fatalf("未连接时应落盘暂存：%v", err)
+	}
+
+	fc.open = true
+	c.isConnected = true
+	c.flushSpool()
+
+	if n := len(fc.publishedTo("opm1560b/SN1234567890/ledger")); n != 0 {
+		t.Fatalf("其他设备的消息不应追加到本设备哈希链主题，实际%d条", n)
+	}
+	entries := fc.publishedTo("opm1560b/SN0000000002/ledger")
+	if len(entries) != 1 {
+		t.Fatalf("补发后应向原消息设备ledger主题追加1条链条目，实际%d", len(entries))
+	}
+	var e models.LedgerEntry
+	if err := json.Unmarshal(entries[0].payload, &e); err != nil {
+		t.Fatalf("链条目反序列化失败：%v", err)
+	}
+	if e.Seq != 1 || e.DeviceID != "SN0000000002" || e.Topic != "opm1560b/SN0000000002/data" || e.MsgID == "" {
+		t.Errorf("补发链条目未携带原消息设备/主题/消息ID：%+v", e)
+	}
+}
+
+// TestPublish_LedgerPerItemOnly 测试：仅分项模式下每条分项消息追加链条目，链条目哈希对应分项消息体
+func TestPublish_LedgerPerItemOnly(t *testing.T) {
+	c := newTestClient()
+	c.cfg.MQTT.PerItemTopics = config.PerItemOnly
+	chain, _ := newLedger("")
+	c.ledgers = map[string]*ledger{"SN1234567890": chain}
+	fc := &fakeClient{open: true}
+	c.client = fc
+	c.isConnected = true
+
+	data := models.NewOPM1560BDeviceData("SN1234567890", "OPM-1560B")
+	if err := c.Publish(models.NewMQTTMessage("SN1234567890", "OPM-1560B", models.MQTTMsgTypeData, data)); err != nil {
+		t.Fatalf("发布失败：%v", err)
+	}
+	if n := len(fc.publishedTo("opm1560b/SN1234567890/data")); n != 0 {
+		t.Fatalf("仅分项模式不应发布汇总消息，实际%d条", n)
+	}
+	entries := fc.publishedTo("opm1560b/SN1234567890/ledger")
+	if len(entries) != 12 {
+		t.Fatalf("每条分项消息应追加链条目，预期12，实际%d", len(entries))
+	}
+	ph := fc.publishedTo("opm1560b/SN1234567890/data/ph")
+	var e models.LedgerEntry
+	if err := json.Unmarshal(entries[0].payload, &e); err != nil {
+		t.Fatalf("链条目反序列化失败：%v", err)
+	}
+	sum := sha256.Sum256(ph[0].payload)
+	if e.Seq != 1 || e.MsgType != models.MQTTMsgTypeData || e.PayloadHash != hex.EncodeToString(sum[:]) {
+		t.Errorf("首条链条目应对应ph分项消息：%+v", e)
+	}
+}
@@ -0,0 +1,175 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// spoolExt 暂存文件扩展名（文件名为20位补零的递增序号，字典序即入队顺序）
+const spoolExt = ".json"
+
+// spoolEntry 一条暂存的待发消息（已序列化，补发时原样发布）
+type spoolEntry struct {
+	Topic      string          `json:"topic"`
+	Retained   bool            `json:"retained"`
+	DeviceID   string          `json:"device_id,omitempty"`   // 消息所属设备SN（补发时哈希链条目使用）
+	MsgType    string          `json:"msg_type,omitempty"`    // 消息类型（补发成功后追加哈希链条目）
+	ReportTime string          `json:"report_time,omitempty"` // 信封上报时间（哈希链条目使用）
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// spool 离线暂存队列：MQTT断开期间待发消息逐条落盘，重连后按入队顺序补发；超过条数或字节上限丢弃最旧消息
+type spool struct {
+	mu       sync.Mutex
+	dir      string
+	max      int              // 最大消息数（0不限）
+	maxBytes int64            // 暂存文件总字节上限（0不限）
+	seqs     []uint64         // 队列中的文件序号（升序）
+	sizes    map[uint64]int64 // 各暂存文件字节数
+	bytes    int64            // 队列中暂存文件总字节数
+	next     uint64           // 下一条消息序号
+	dropped  uint64           // 因超过上限丢弃（淘汰）的消息数
+}
+
+// newSpool 新建暂存队列（目录中已有暂存文件则接续，重启后仍可补发；写入中断残留的临时文件直接清理）
+func newSpool(dir string, max int, maxBytes int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建暂存目录失败：%w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取暂存目录失败：%w", err)
+	}
+	s := &spool{dir: dir, max: max, maxBytes: maxBytes, sizes: make(map[uint64]int64), next: 1}
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasSuffix(name, spoolExt+".tmp") {
+			_ = os.Remove(filepath.Join(dir, name)) // 改名前断电：消息未入队，清理残留
+			continue
+		}
+		if e.IsDir() || !strings.HasSuffix(name, spoolExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		s.seqs = append(s.seqs, seq)
+		s.sizes[seq] = info.Size()
+		s.bytes += info.Size()
+	}
+	sort.Slice(s.seqs, func(i, j int) bool { return s.seqs[i] < s.seqs[j] })
+	if n := len(s.seqs); n > 0 {
+		s.next = s.seqs[n-1] + 1
+		log.Printf("[INFO] [mqtt] 暂存目录%s中有%d条待补发消息", dir, n)
+	}
+	return s, nil
+}
+
+// path 序号对应的暂存文件路径
+func (s *spool) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolExt))
+}
+
+// Push 消息入队（先写临时文件再改名，避免断电写坏；超过条数或字节上限丢弃最旧消息，至少保留本条）
+func (s *spool) Push(e spoolEntry) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("序列化暂存消息失败：%w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seq := s.next
+	tmp := s.path(seq) + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return fmt.Errorf("写入暂存文件失败：%w", err)
+	}
+	if err := os.Rename(tmp, s.path(seq)); err != nil {
+		return fmt.Errorf("写入暂存文件失败：%w", err)
+	}
+	s.next++
+	s.seqs = append(s.seqs, seq)
+	s.sizes[seq] = int64(len(raw))
+	s.bytes += int64(len(raw))
+
+	for len(s.seqs) > 1 && (s.max > 0 && len(s.seqs) > s.max || s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		oldest := s.seqs[0]
+		s.drop(oldest)
+		s.dropped++
+		log.Printf("[WARN] [mqtt] 暂存队列已满（上限%d条/%d字节），淘汰最旧的未送达消息%d（累计淘汰%d条）", s.max, s.maxBytes, oldest, s.dropped)
+	}
+	return nil
+}
+
+// drop 队首消息出队并删除暂存文件（调用方需持有s.mu）
+func (s *spool) drop(seq uint64) {
+	s.seqs = s.seqs[1:]
+	s.bytes -= s.sizes[seq]
+	delete(s.sizes, seq)
+	if err := os.Remove(s.path(seq)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[ERROR] [mqtt] 删除暂存文件失败：%v", err)
+	}
+}
+
+// Peek 队首消息（不出队）；暂存文件损坏时删除并跳过
+func (s *spool) Peek() (spoolEntry, uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.seqs) > 0 {
+		seq := s.seqs[0]
+		var e spoolEntry
+		raw, err := os.ReadFile(s.path(seq))
+		if err == nil {
+			err = json.Unmarshal(raw, &e)
+		}
+		if err == nil {
+			return e, seq, true
+		}
+		log.Printf("[ERROR] [mqtt] 暂存文件%d不可读，丢弃：%v", seq, err)
+		s.drop(seq)
+	}
+	return spoolEntry{}, 0, false
+}
+
+// Remove 补发成功后删除队首消息
+func (s *spool) Remove(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.seqs) == 0 || s.seqs[0] != seq {
+		return // 已因超过上限被丢弃
+	}
+	s.drop(seq)
+}
+
+// Len 队列中的消息数
+func (s *spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.seqs)
+}
+
+// Bytes 队列中暂存文件总字节数
+func (s *spool) Bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bytes
+}
+
+// Dropped 因超过上限丢弃（淘汰）的消息数
+func (s *spool) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
@@ -0,0 +1,117 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSpool_OrderAndDropOldest 测试：按入队顺序出队，超过上限丢弃最旧消息，重启后接续队列
+func TestSpool_OrderAndDropOldest(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newSpool(dir, 3, 0)
+	if err != nil {
+		t.Fatalf("新建暂存队列失败：%v", err)
+	}
+	for _, topic := range []string{"t1", "t2", "t3", "t4", "t5"} {
+		if err := s.Push(spoolEntry{Topic: topic, Payload: json.RawMessage(`{}`)}); err != nil {
+			t.Fatalf("入队失败：%v", err)
+		}
+	}
+	if s.Len() != 3 || s.Dropped() != 2 {
+		t.Fatalf("超过上限应丢弃最旧：队列%d条，丢弃%d条", s.Len(), s.Dropped())
+	}
+
+	// 重启：从目录接续，顺序不变，新消息排在末尾
+	s, err = newSpool(dir, 3, 0)
+	if err != nil {
+		t.Fatalf("重新打开暂存队列失败：%v", err)
+	}
+	if err := s.Push(spoolEntry{Topic: "t6", Payload: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("入队失败：%v", err)
+	}
+	var got []string
+	for {
+		e, seq, ok := s.Peek()
+		if !ok {
+			break
+		}
+		got = append(got, e.Topic)
+		s.Remove(seq)
+	}
+	want := []string{"t4", "t5", "t6"}
+	if len(got) != len(want) {
+		t.Fatalf("出队顺序错误：期望%v，实际%v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("出队顺序错误：期望%v，实际%v", want, got)
+		}
+	}
+	if s.Len() != 0 {
+		t.Fatalf("全部出队后队列应为空，实际%d条", s.Len())
+	}
+}
+
+// TestSpool_MaxBytesEvictsOldest 测试：超过字节上限按入队顺序淘汰最旧消息并告警，重启时清理写入中断的临时文件并接续字节统计
+func TestSpool_MaxBytesEvictsOldest(t *testing.T) {
+	logs := &logCapture{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	entry := func(topic string) spoolEntry {
+		return spoolEntry{Topic: topic, Payload: json.RawMessage(`{"content":"0123456789"}`)}
+	}
+	raw, _ := json.Marshal(entry("t1"))
+	size := int64(len(raw))
+
+	s, err := newSpool(dir, 0, 3*size)
+	if err != nil {
+		t.Fatalf("新建暂存队列失败：%v", err)
+	}
+	for _, topic := range []string{"t1", "t2", "t3", "t4", "t5"} {
+		if err := s.Push(entry(topic)); err != nil {
+			t.Fatalf("入队失败：%v", err)
+		}
+	}
+	if s.Len() != 3 || s.Dropped() != 2 || s.Bytes() != 3*size {
+		t.Fatalf("超过字节上限应淘汰最旧：队列%d条/%d字节，淘汰%d条", s.Len(), s.Bytes(), s.Dropped())
+	}
+	if !strings.Contains(logs.String(), "[WARN] [mqtt] 暂存队列已满") {
+		t.Fatalf("淘汰未告警：%s", logs.String())
+	}
+
+	// 改名前断电残留的临时文件：重启时清理，不计入队列
+	if err := os.WriteFile(filepath.Join(dir, "00000000000000000099.json.tmp"), []byte(`{"to`), 0644); err != nil {
+		t.Fatalf("写入临时文件失败：%v", err)
+	}
+	s, err = newSpool(dir, 0, 3*size)
+	if err != nil {
+		t.Fatalf("重新打开暂存队列失败：%v", err)
+	}
+	if s.Bytes() != 3*size {
+		t.Fatalf("重启后字节统计错误：预期%d，实际%d", 3*size, s.Bytes())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00000000000000000099.json.tmp")); !os.IsNotExist(err) {
+		t.Fatalf("残留临时文件未清理：%v", err)
+	}
+	var got []string
+	for {
+		e, seq, ok := s.Peek()
+		if !ok {
+			break
+		}
+		got = append(got, e.Topic)
+		s.Remove(seq)
+	}
+	if strings.Join(got, ",") != "t3,t4,t5" {
+		t.Fatalf("淘汰顺序错误：期望t3,t4,t5，实际%v", got)
+	}
+	if s.Bytes() != 0 {
+		t.Fatalf("全部出队后字节数应为0，实际%d", s.Bytes())
+	}
+}
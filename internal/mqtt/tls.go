@@ -0,0 +1,44 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"opm-mqtt-gateway/internal/config"
+)
+
+// isTLSBroker 服务端地址是否为TLS连接（tls://、ssl://）
+func isTLSBroker(broker string) bool {
+	b := strings.ToLower(broker)
+	return strings.HasPrefix(b, "tls://") || strings.HasPrefix(b, "ssl://")
+}
+
+// newTLSConfig 按MQTT配置构建TLS配置：tls_ca为空使用系统根证书，配置tls_cert/tls_key时启用双向认证
+func newTLSConfig(mc config.MQTTConfig) (*tls.Config, error) {
+	tc := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: mc.TLSInsecureSkipVerify,
+	}
+	if mc.TLSCA != "" {
+		raw, err := os.ReadFile(mc.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("读取CA证书失败：%w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, fmt.Errorf("CA证书%s中无有效PEM证书", mc.TLSCA)
+		}
+		tc.RootCAs = pool
+	}
+	if mc.TLSCert != "" || mc.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(mc.TLSCert, mc.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败：%w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
@@ -0,0 +1,61 @@
+package mqtt
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"opm-mqtt-gateway/internal/config"
+)
+
+// TestNewTLSConfig_MutualTLS 测试：从PEM文件构建TLS配置（CA+客户端证书），客户端证书可由CA校验
+func TestNewTLSConfig_MutualTLS(t *testing.T) {
+	tc, err := newTLSConfig(config.MQTTConfig{
+		TLSCA:   "testdata/ca.pem",
+		TLSCert: "testdata/client.pem",
+		TLSKey:  "testdata/client.key",
+	})
+	if err != nil {
+		t.Fatalf("构建TLS配置失败：%v", err)
+	}
+	if tc.RootCAs == nil || len(tc.Certificates) != 1 || tc.InsecureSkipVerify {
+		t.Fatalf("TLS配置错误：RootCAs=%v，证书数%d，跳过校验%v", tc.RootCAs != nil, len(tc.Certificates), tc.InsecureSkipVerify)
+	}
+	leaf, err := x509.ParseCertificate(tc.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatalf("解析客户端证书失败：%v", err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: tc.RootCAs, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		t.Fatalf("客户端证书未能由配置的CA校验：%v", err)
+	}
+
+	// 仅配置CA：单向TLS
+	tc, err = newTLSConfig(config.MQTTConfig{TLSCA: "testdata/ca.pem", TLSInsecureSkipVerify: true})
+	if err != nil || len(tc.Certificates) != 0 || !tc.InsecureSkipVerify {
+		t.Fatalf("单向TLS配置错误：err=%v", err)
+	}
+}
+
+// TestNewTLSConfig_Invalid 测试：CA文件非PEM、证书缺少私钥时返回错误
+func TestNewTLSConfig_Invalid(t *testing.T) {
+	if _, err := newTLSConfig(config.MQTTConfig{TLSCA: "testdata/client.key"}); err == nil {
+		t.Errorf("CA文件无证书时应返回错误")
+	}
+	if _, err := newTLSConfig(config.MQTTConfig{TLSCert: "testdata/client.pem"}); err == nil {
+		t.Errorf("客户端证书缺少私钥时应返回错误")
+	}
+}
+
+// TestIsTLSBroker 测试：tls://、ssl://为TLS连接，tcp://不是
+func TestIsTLSBroker(t *testing.T) {
+	cases := map[string]bool{
+		"tls://broker:8883": true,
+		"SSL://broker:8883": true,
+		"tcp://broker:1883": false,
+		"ws://broker:8080":  false,
+	}
+	for broker, want := range cases {
+		if got := isTLSBroker(broker); got != want {
+			t.Errorf("isTLSBroker(%q)=%v，期望%v", broker, got, want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package parser
+
+import "fmt"
+
+// decodeBCD 解码2字节压缩BCD码（每个半字节一位十进制数，0x0520 → 520），半字节大于9时返回错误
+func decodeBCD(hi, lo byte) (int, error) {
+	v := 0
+	for _, b := range []byte{hi, lo} {
+		for _, n := range []byte{b >> 4, b & 0x0F} {
+			if n > 9 {
+				return 0, fmt.Errorf("%w0x%02X%02X（半字节0x%X大于9）", ErrBadBCD, hi, lo, n)
+			}
+			v = v*10 + int(n)
+		}
+	}
+	return v, nil
+}
+
+// decodePH 解码PH值（2字节BCD，两位小数：0x0520 → 5.20）
+func decodePH(b []byte) (float64, error) {
+	if len(b) != 2 {
+		return 0, fmt.Errorf("PH字段应为2字节，实际%d", len(b))
+	}
+	v, err := decodeBCD(b[0], b[1])
+	if err != nil {
+		return 0, err
+	}
+	return float64(v) / 100, nil
+}
+
+// decodeSpecificGravity 解码比重（2字节BCD，三位小数：0x1010 → 1.010，0x1040 → 1.040）
+func decodeSpecificGravity(b []byte) (float64, error) {
+	if len(b) != 2 {
+		return 0, fmt.Errorf("比重字段应为2字节，实际%d", len(b))
+	}
+	v, err := decodeBCD(b[0], b[1])
+	if err != nil {
+		return 0, err
+	}
+	return float64(v) / 1000, nil
+}
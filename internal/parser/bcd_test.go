@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestDecodeBCD 测试：压缩BCD码边界值解码，半字节大于9时报错
+func TestDecodeBCD(t *testing.T) {
+	cases := []struct {
+		hi, lo  byte
+		want    int
+		wantErr bool
+	}{
+		{0x00, 0x00, 0, false},
+		{0x05, 0x20, 520, false},
+		{0x10, 0x10, 1010, false},
+		{0x99, 0x99, 9999, false},
+		{0x0A, 0x00, 0, true}, // 低半字节A
+		{0xA0, 0x00, 0, true}, // 高半字节A
+		{0x00, 0x0F, 0, true},
+		{0x00, 0xF0, 0, true},
+	}
+	for _, c := range cases {
+		got, err := decodeBCD(c.hi, c.lo)
+		if c.wantErr != errors.Is(err, ErrBadBCD) || got != c.want {
+			t.Errorf("decodeBCD(0x%02X, 0x%02X) = %d, %v；预期%d，错误%v", c.hi, c.lo, got, err, c.want, c.wantErr)
+		}
+	}
+}
+
+// TestDecodePHAndSpecificGravity 测试：PH两位小数、比重三位小数，非法半字节/长度报错
+func TestDecodePHAndSpecificGravity(t *testing.T) {
+	cases := []struct {
+		name    string
+		decode  func([]byte) (float64, error)
+		in      []byte
+		want    float64
+		wantErr bool
+	}{
+		{"PH 5.20", decodePH, []byte{0x05, 0x20}, 5.20, false},
+		{"PH 0.00", decodePH, []byte{0x00, 0x00}, 0, false},
+		{"PH 14.00", decodePH, []byte{0x14, 0x00}, 14.00, false},
+		{"PH 非法半字节", decodePH, []byte{0x05, 0x2A}, 0, true},
+		{"PH 长度错误", decodePH, []byte{0x05}, 0, true},
+		{"比重 1.010", decodeSpecificGravity, []byte{0x10, 0x10}, 1.010, false},
+		{"比重 1.040", decodeSpecificGravity, []byte{0x10, 0x40}, 1.040, false},
+		{"比重 1.003", decodeSpecificGravity, []byte{0x10, 0x03}, 1.003, false},
+		{"比重 非法半字节", decodeSpecificGravity, []byte{0x1F, 0x10}, 0, true},
+		{"比重 长度错误", decodeSpecificGravity, []byte{0x10, 0x10, 0x00}, 0, true},
+	}
+	for _, c := range cases {
+		got, err := c.decode(c.in)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("%s：结果%v，错误%v；预期%v，错误%v", c.name, got, err, c.want, c.wantErr)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"opm-mqtt-gateway/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ItemKeys 检测项键（与数据段字节分布、检测数据JSON字段名一致）
+var ItemKeys = []string{
+	"ph", "protein", "glucose", "ketone", "occult_blood", "leukocyte",
+	"erythrocyte", "urobilinogen", "bilirubin", "nitrite", "specific_grav", "vc",
+}
+
+// ItemInfo 检测项元数据（名称/单位/参考范围/LOINC编码），解析时附到检测数据，随分项主题消息输出
+type ItemInfo = models.ItemMeta
+
+// DecodeTable 解码码表（等级编码/亚硝酸盐编码/检测项元数据），新固件可通过外部文件扩展，无需重新编译
+type DecodeTable struct {
+	Grades  map[int]string      `yaml:"grades" json:"grades"`   // 等级型检测项编码 → 等级
+	Nitrite map[int]string      `yaml:"nitrite" json:"nitrite"` // 亚硝酸盐编码 → 结果
+	Items   map[string]ItemInfo `yaml:"items" json:"items"`     // 检测项键 → 元数据
+}
+
+// DefaultDecodeTable 内置码表（OPM-1560B出厂固件编码规则）
+func DefaultDecodeTable() *DecodeTable {
+	return &DecodeTable{
+		Grades: map[int]string{
+			0: "-", 1: "+", 2: "±", 3: "++", 4: "+++", 5: "++++",
+		},
+		Nitrite: map[int]string{
+			0: "-", 1: "+",
+		},
+		Items: map[string]ItemInfo{
+			"ph":            {Name: "酸碱度", Reference: "4.5-8.0"},
+			"protein":       {Name: "尿蛋白", Reference: "-"},
+			"glucose":       {Name: "葡萄糖", Reference: "-"},
+			"ketone":        {Name: "酮体", Reference: "-"},
+			"occult_blood":  {Name: "隐血", Reference: "-"},
+			"leukocyte":     {Name: "白细胞", Reference: "-"},
+			"erythrocyte":   {Name: "红细胞", Reference: "-"},
+			"urobilinogen":  {Name: "尿胆原", Reference: "-"},
+			"bilirubin":     {Name: "胆红素", Reference: "-"},
+			"nitrite":       {Name: "亚硝酸盐", Reference: "-"},
+			"specific_grav": {Name: "比重", Reference: "1.003-1.030"},
+			"vc":            {Name: "维生素C", Reference: "-"},
+		},
+	}
+}
+
+// LoadDecodeTable 加载外部码表文件（YAML/JSON均可），逐项覆盖内置码表
+func LoadDecodeTable(path string) (*DecodeTable, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取码表文件失败：%w", err)
+	}
+
+	// 拒绝未知字段，避免拼写错误被静默忽略（JSON对象键为字符串，需按扩展名区分解码器）
+	var custom DecodeTable
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&custom)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		err = dec.Decode(&custom)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析码表文件失败：%w", err)
+	}
+	if err := custom.validate(); err != nil {
+		return nil, fmt.Errorf("码表校验失败：%w", err)
+	}
+
+	table := DefaultDecodeTable()
+	table.merge(&custom)
+	return table, nil
+}
+
+// validate 校验码表：编码须在单字节范围内，结果非空，检测项键须为已知项
+func (t *DecodeTable) validate() error {
+	for name, codes := range map[string]map[int]string{"grades": t.Grades, "nitrite": t.Nitrite} {
+		for code, label := range codes {
+			if code < 0 || code > 0xFF {
+				return fmt.Errorf("%s编码%d超出单字节范围", name, code)
+			}
+			if label == "" {
+				return fmt.Errorf("%s编码%d结果为空", name, code)
+			}
+		}
+	}
+	for key := range t.Items {
+		if !knownItem(key) {
+			return fmt.Errorf("未知检测项：%s", key)
+		}
+	}
+	return nil
+}
+
+// merge 逐项覆盖：编码按键覆盖，检测项元数据仅覆盖非空字段
+func (t *DecodeTable) merge(o *DecodeTable) {
+	for code, label := range o.Grades {
+		t.Grades[code] = label
+	}
+	for code, label := range o.Nitrite {
+		t.Nitrite[code] = label
+	}
+	for key, info := range o.Items {
+		cur := t.Items[key]
+		if info.Name != "" {
+			cur.Name = info.Name
+		}
+		if info.Unit != "" {
+			cur.Unit = info.Unit
+		}
+		if info.Reference != "" {
+			cur.Reference = info.Reference
+		}
+		if info.LOINC != "" {
+			cur.LOINC = info.LOINC
+		}
+		t.Items[key] = cur
+	}
+}
+
+// knownItem 是否为已知检测项键
+func knownItem(key string) bool {
+	for _, k := range ItemKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTable 写入临时码表文件
+func writeTable(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("写入码表文件失败：%v", err)
+	}
+	return path
+}
+
+// TestLoadDecodeTable_CustomGrades 测试：外部码表扩展等级编码并覆盖检测项元数据，内置项保留
+func TestLoadDecodeTable_CustomGrades(t *testing.T) {
+	path := writeTable(t, "table.yaml", `
+grades:
+  6: "+++++"
+items:
+  ph:
+    loinc: "5803-2"
+`)
+	table, err := LoadDecodeTable(path)
+	if err != nil {
+		t.Fatalf("加载码表失败：%v", err)
+	}
+	if table.Grades[1] != "+" || table.Grades[6] != "+++++" {
+		t.Fatalf("等级编码合并错误：%v", table.Grades)
+	}
+	if ph := table.Items["ph"]; ph.LOINC != "5803-2" || ph.Name != "酸碱度" {
+		t.Fatalf("检测项元数据合并错误：%+v", ph)
+	}
+
+	// 尿蛋白编码6：内置码表为invalid，自定义码表解析为+++++
+	frame, _ := hex.DecodeString("AA05200600000000000000001010004B55")
+	p := NewParser()
+	p.SetDecodeTable(table)
+	data, err := p.Parse(frame)
+	if err != nil {
+		t.Fatalf("自定义码表解析失败：%v", err)
+	}
+	if data.Protein != "+++++" {
+		t.Fatalf("尿蛋白解析错误，预期+++++，实际%s", data.Protein)
+	}
+
+	// 码表元数据随分项消息输出
+	raw, err := json.Marshal(data.Items()[0])
+	if err != nil {
+		t.Fatalf("分项序列化失败：%v", err)
+	}
+	for _, want := range []string{`"item":"ph"`, `"name":"酸碱度"`, `"reference":"4.5-8.0"`, `"loinc":"5803-2"`} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("分项消息缺少%s：%s", want, raw)
+		}
+	}
+}
+
+// TestLoadDecodeTable_JSON 测试：JSON格式码表
+func TestLoadDecodeTable_JSON(t *testing.T) {
+	path := writeTable(t, "table.json", `{"nitrite": {"2": "++"}}`)
+	table, err := LoadDecodeTable(path)
+	if err != nil {
+		t.Fatalf("加载JSON码表失败：%v", err)
+	}
+	if table.Nitrite[2] != "++" || table.Nitrite[0] != "-" {
+		t.Fatalf("亚硝酸盐编码合并错误：%v", table.Nitrite)
+	}
+}
+
+// TestLoadDecodeTable_Invalid 测试：非法码表加载失败（超范围编码/空结果/未知检测项/未知字段）
+func TestLoadDecodeTable_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"超范围编码": "grades:\n  256: \"x\"\n",
+		"空结果":   "grades:\n  6: \"\"\n",
+		"未知检测项": "items:\n  foo:\n    name: x\n",
+		"未知字段":  "grade:\n  6: \"x\"\n",
+	}
+	for name, content := range cases {
+		if _, err := LoadDecodeTable(writeTable(t, "table.yaml", content)); err == nil {
+			t.Fatalf("%s：非法码表应加载失败", name)
+		}
+	}
+}
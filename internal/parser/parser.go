@@ -5,50 +5,111 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"strconv"
 	"strings"
 
 	"opm-mqtt-gateway/internal/config"
 	"opm-mqtt-gateway/internal/models"
 )
 
+// 解析失败哨兵错误（Error()保持原中文文案，调用方以errors.Is判断类别）
+var (
+	ErrFrameTooShort    = errors.New("帧长度不足")
+	ErrBadHeader        = errors.New("帧头校验失败（非AA）")
+	ErrBadTrailer       = errors.New("帧尾校验失败（非55）")
+	ErrBadLengthField   = errors.New("长度字段校验失败")
+	ErrChecksumMismatch = errors.New("和校验失败")
+	ErrBadBCD           = errors.New("非法BCD码")
+	ErrExtract          = errors.New("提取数据失败")  // 数据段提取/编码解析失败（包裹具体原因，如ErrDataTooShort/ErrBadBCD）
+	ErrDataTooShort     = errors.New("数据段长度不足") // 数据段不足14字节
+)
+
 // Parser OPM-1560B协议解析器实例（贴合硬件帧格式+数据编码，核心层）
 type Parser struct {
-	frameStart  []byte // 帧头（0xAA）
-	frameEnd    []byte // 帧尾（0x55）
-	checkType   string // 校验方式（sum，和校验）
-	minFrameLen int    // 最小帧长度（16字节）
-	deviceID    string // 设备SN
-	deviceModel string // 设备型号（OPM-1560B）
+	frameStart  []byte       // 帧头（0xAA）
+	frameEnd    []byte       // 帧尾（0x55）
+	checkType   string       // 校验方式（sum，和校验）
+	minFrameLen int          // 最小帧长度（16字节）
+	deviceID    string       // 设备SN
+	deviceModel string       // 设备型号（OPM-1560B）
+	fieldHex    bool         // 是否附带各检测项原始字节16进制
+	hasLength   bool         // 帧头后是否带长度字节（长度字段模式）
+	quality     bool         // 是否附带质量评分
+	plausible   bool         // 是否校验PH/比重物理可能范围
+	rawEncoding string       // 原始帧编码（hex/base64）
+	table       *DecodeTable // 解码码表（默认内置，可由外部文件覆盖）
+	// 参考范围（未配置项使用内置范围）
+	ranges map[string]models.ReferenceRange
+	// 累计解析计数（Stats快照）
+	stats parserCounters
+	// 等级项数值代理阶梯（未开启emit_numeric_proxy时为nil）
+	proxy map[string]map[string]float64
 }
 
 // NewParser 新建解析器实例（基于全局硬件配置初始化）
 func NewParser() *Parser {
-	cfg := config.GlobalConfig
-	return &Parser{
-		frameStart:  config.GetFrameStart(),
-		frameEnd:    config.GetFrameEnd(),
+	return NewParserFor(config.GlobalConfig)
+}
+
+// NewParserFor 按指定设备配置新建解析器（多设备模式每台设备一份配置）
+func NewParserFor(cfg *config.Config) *Parser {
+	p := &Parser{
+		frameStart:  cfg.Parser.FrameStartBytes(),
+		frameEnd:    cfg.Parser.FrameEndBytes(),
 		checkType:   cfg.Parser.CheckType,
 		minFrameLen: cfg.Parser.FrameMinLen,
 		deviceID:    cfg.Device.DeviceID,
 		deviceModel: cfg.Device.Model,
+		fieldHex:    cfg.Parser.IncludeFieldHex,
+		hasLength:   cfg.Parser.HasLengthField,
+		quality:     cfg.Parser.QualityScore,
+		plausible:   cfg.Parser.PlausibilityCheck,
+		rawEncoding: cfg.Parser.RawEncoding,
+		ranges:      cfg.Parser.ReferenceRanges,
+		table:       DefaultDecodeTable(),
+	}
+	if cfg.Parser.EmitNumericProxy {
+		p.proxy = cfg.Parser.NumericProxy
 	}
+	return p
 }
 
-// Parse 核心：解析OPM-1560B有效帧，流程：三重校验→数据提取→编码解析→模型映射
+// SetDecodeTable 替换解码码表（外部码表文件由LoadDecodeTable加载校验）
+func (p *Parser) SetDecodeTable(t *DecodeTable) {
+	p.table = t
+}
+
+// DecodeTable 当前解码码表（检测项名称/单位/参考范围/LOINC查询）
+func (p *Parser) DecodeTable() *DecodeTable {
+	return p.table
+}
+
+// Parse 核心：解析OPM-1560B有效帧，流程：三重校验→数据提取→编码解析→模型映射；结果计入Stats
 func (p *Parser) Parse(frame []byte) (*models.OPM1560BDeviceData, error) {
+	return p.ParseFrame(models.Frame{Raw: frame})
+}
+
+// ParseFrame 解析串口层提取的帧，帧提取标记（如补全帧尾）计入质量评分
+func (p *Parser) ParseFrame(f models.Frame) (*models.OPM1560BDeviceData, error) {
+	p.stats.received.Add(1)
+	data, err := p.parse(f.Raw, f.Flags)
+	p.stats.record(err)
+	return data, err
+}
+
+// parse 解析流程实现（不含计数）
+func (p *Parser) parse(frame []byte, flags models.FrameFlags) (*models.OPM1560BDeviceData, error) {
 	// 1. 第一重校验：帧长度（硬件约束，不足16字节直接丢弃）
 	if len(frame) < p.minFrameLen {
-		return nil, fmt.Errorf("帧长度不足，实际%d，要求%d", len(frame), p.minFrameLen)
+		return nil, fmt.Errorf("%w，实际%d，要求%d", ErrFrameTooShort, len(frame), p.minFrameLen)
 	}
 
 	// 2. 第二重校验：帧头/帧尾（硬件约束，AA开头/55结尾）
 	startLen, endLen := len(p.frameStart), len(p.frameEnd)
 	if !p.compareBytes(frame[:startLen], p.frameStart) {
-		return nil, errors.New("帧头校验失败（非AA）")
+		return nil, ErrBadHeader
 	}
 	if !p.compareBytes(frame[len(frame)-endLen:], p.frameEnd) {
-		return nil, errors.New("帧尾校验失败（非55）")
+		return nil, ErrBadTrailer
 	}
 
 	// 3. 提取校验位和原始帧（硬件格式：AA+数据段+校验位+55）
@@ -57,33 +118,101 @@ func (p *Parser) Parse(frame []byte) (*models.OPM1560BDeviceData, error) {
 
 	// 4. 第三重校验：和校验（硬件固化算法，数据段字节和取低8位）
 	if p.checkType == models.CheckTypeSum {
-		if !p.checkSumValid(serialFrame.Data, checkSum) {
-			calcSum := p.calcSum(serialFrame.Data)
-			log.Printf("[ERROR] [parser] 和校验失败，计算值0x%02X，帧中值0x%02X，原始帧%s", calcSum, checkSum, models.HexStr(frame))
-			return nil, errors.New("和校验失败")
+		if err := p.verifyChecksum(frame); err != nil {
+			return nil, err
 		}
+	} else {
+		flags |= models.FrameChecksumUnverified
 	}
 
 	log.Printf("[INFO] [parser] 帧校验通过，数据段长度%d，原始帧%s",
 		len(serialFrame.Data), models.HexStr(frame))
 
-	// 5. 核心：从数据段提取检测数据（硬件数据段字节分布精准映射）
-	deviceData, err := p.extractDetectData(serialFrame.Data)
+	// 5. 长度字段模式：校验声明长度并跳过长度字节（和校验范围包含长度字节）
+	dataSeg := serialFrame.Data
+	if p.hasLength {
+		if len(dataSeg) == 0 || int(dataSeg[0]) != len(dataSeg)-1 {
+			return nil, fmt.Errorf("%w，数据段实际%d字节", ErrBadLengthField, len(dataSeg)-1)
+		}
+		dataSeg = dataSeg[1:]
+	}
+
+	// 6. 核心：从数据段提取检测数据（硬件数据段字节分布精准映射）
+	deviceData, err := p.extractDetectData(dataSeg)
 	if err != nil {
-		return nil, fmt.Errorf("提取数据失败：%w", err)
+		return nil, fmt.Errorf("%w：%w", ErrExtract, err)
 	}
 
-	// 6. 留存原始帧16进制（调试/溯源）
-	deviceData.RawFrameHex = strings.ToUpper(hex.EncodeToString(frame))
-	// 7. 校验数据医学有效性，标记状态
-	deviceData.CheckDataValid()
+	// 7. 留存原始帧（调试/溯源，按配置编码）
+	if p.rawEncoding == models.RawEncodingBase64 {
+		deviceData.RawFrameBase64 = models.RawStr(frame, models.RawEncodingBase64)
+	} else {
+		deviceData.RawFrameHex = models.RawStr(frame, models.RawEncodingHex)
+	}
+	// 8. 校验数据医学有效性，标记状态
+	deviceData.CheckDataValidRanges(p.ranges)
+	if p.plausible {
+		deviceData.CheckPlausible()
+	}
+	if p.proxy != nil {
+		deviceData.ApplyNumericProxy(p.proxy)
+	}
+	// 9. 质量评分（平台对临界结果加权）
+	if p.quality {
+		score := deviceData.QualityScore(flags)
+		deviceData.Quality = &score
+	}
 
 	return deviceData, nil
 }
 
-// checkSumValid 验证和校验是否有效（OPM-1560B硬件固化算法）
-func (p *Parser) checkSumValid(data []byte, frameCheckSum byte) bool {
-	return p.calcSum(data) == frameCheckSum
+// 解析失败分类（隔离文件/统计使用）
+const (
+	ErrKindFrameLength = "frame_length" // 帧长度不足
+	ErrKindFrameHeader = "frame_header" // 帧头校验失败
+	ErrKindFrameEnd    = "frame_end"    // 帧尾校验失败
+	ErrKindLengthField = "length_field" // 长度字段校验失败
+	ErrKindChecksum    = "checksum"     // 和校验失败
+	ErrKindExtract     = "extract"      // 数据段提取/编码解析失败
+	ErrKindUnknown     = "unknown"      // 未分类
+)
+
+// ErrorKind 解析失败分类（按Parse返回的哨兵错误归类）
+func ErrorKind(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrFrameTooShort):
+		return ErrKindFrameLength
+	case errors.Is(err, ErrBadHeader):
+		return ErrKindFrameHeader
+	case errors.Is(err, ErrBadTrailer):
+		return ErrKindFrameEnd
+	case errors.Is(err, ErrBadLengthField):
+		return ErrKindLengthField
+	case errors.Is(err, ErrChecksumMismatch):
+		return ErrKindChecksum
+	case errors.Is(err, ErrExtract):
+		return ErrKindExtract
+	default:
+		return ErrKindUnknown
+	}
+}
+
+// verifyChecksum 验证和校验（OPM-1560B硬件固化算法）：帧头与校验位之间的数据段字节和取低8位，
+// 与帧尾55前1字节比对；帧不足以容纳帧头+校验位+帧尾时返回帧长度不足
+func (p *Parser) verifyChecksum(frame []byte) error {
+	startLen, endLen := len(p.frameStart), len(p.frameEnd)
+	if len(frame) < startLen+1+endLen {
+		return fmt.Errorf("%w，实际%d，要求至少%d", ErrFrameTooShort, len(frame), startLen+1+endLen)
+	}
+	checkSum := frame[len(frame)-endLen-1]
+	calcSum := p.calcSum(frame[startLen : len(frame)-endLen-1])
+	if calcSum != checkSum {
+		log.Printf("[ERROR] [parser] 和校验失败，计算值0x%02X，帧中值0x%02X，原始帧%s", calcSum, checkSum, models.HexStr(frame))
+		return ErrChecksumMismatch
+	}
+	return nil
 }
 
 // calcSum 计算和校验（硬件算法：数据段所有字节相加，结果取低8位）
@@ -112,16 +241,15 @@ func (p *Parser) calcSum(data []byte) byte {
 func (p *Parser) extractDetectData(data []byte) (*models.OPM1560BDeviceData, error) {
 	// 初始化检测数据模型
 	deviceData := models.NewOPM1560BDeviceData(p.deviceID, p.deviceModel)
+	deviceData.ItemMeta = p.table.Items
 
 	// 数据段长度校验（硬件约束14字节，不足则解析失败）
 	if len(data) < 14 {
-		return nil, fmt.Errorf("数据段长度不足，实际%d，要求14", len(data))
+		return nil, fmt.Errorf("%w，实际%d，要求14", ErrDataTooShort, len(data))
 	}
 
-	// 1. 解析PH值（BCD码：字节0-1 → 浮点数）
-	phBCD := (uint16(data[0]) << 8) | uint16(data[1])
-	phStr := fmt.Sprintf("%04d", phBCD)
-	ph, err := strconv.ParseFloat(phStr[:1]+"."+phStr[1:], 64)
+	// 1. 解析PH值（压缩BCD码：字节0-1，两位小数，0x0520 → 5.20）
+	ph, err := decodePH(data[0:2])
 	if err != nil {
 		return nil, fmt.Errorf("解析PH值失败：%w", err)
 	}
@@ -139,45 +267,53 @@ func (p *Parser) extractDetectData(data []byte) (*models.OPM1560BDeviceData, err
 	deviceData.VC = p.parseGrade(data[13])          // 维生素C
 
 	// 3. 解析亚硝酸盐（硬件编码：0:-/1:+）
-	switch data[10] {
-	case 0:
-		deviceData.Nitrite = "-"
-	case 1:
-		deviceData.Nitrite = "+"
-	default:
-		deviceData.Nitrite = "invalid"
-	}
+	deviceData.Nitrite = p.lookup(p.table.Nitrite, data[10])
 
-	// 4. 解析比重（BCD码：字节11-12 → 浮点数）
-	sgBCD := (uint16(data[11]) << 8) | uint16(data[12])
-	sgStr := fmt.Sprintf("%04d", sgBCD)
-	sg, err := strconv.ParseFloat(sgStr[:1]+"."+sgStr[1:], 64)
+	// 4. 解析比重（压缩BCD码：字节11-12，三位小数，0x1010 → 1.010）
+	sg, err := decodeSpecificGravity(data[11:13])
 	if err != nil {
 		return nil, fmt.Errorf("解析比重失败：%w", err)
 	}
 	deviceData.SpecificGrav = sg
 
+	// 5. 审计溯源：记录各检测项对应的原始字节
+	if p.fieldHex {
+		deviceData.FieldHex = fieldHexMap(data)
+	}
+
 	return deviceData, nil
 }
 
-// parseGrade 解析硬件等级编码（OPM-1560B固化编码规则）
+// fieldHexMap 按硬件数据段字节分布，生成各检测项原始字节16进制（键同JSON字段名）
+func fieldHexMap(data []byte) map[string]string {
+	hexOf := func(b []byte) string { return strings.ToUpper(hex.EncodeToString(b)) }
+	return map[string]string{
+		"ph":            hexOf(data[0:2]),
+		"protein":       hexOf(data[2:3]),
+		"glucose":       hexOf(data[3:4]),
+		"ketone":        hexOf(data[4:5]),
+		"occult_blood":  hexOf(data[5:6]),
+		"leukocyte":     hexOf(data[6:7]),
+		"erythrocyte":   hexOf(data[7:8]),
+		"urobilinogen":  hexOf(data[8:9]),
+		"bilirubin":     hexOf(data[9:10]),
+		"nitrite":       hexOf(data[10:11]),
+		"specific_grav": hexOf(data[11:13]),
+		"vc":            hexOf(data[13:14]),
+	}
+}
+
+// parseGrade 解析硬件等级编码（默认0-5对应-/+/±/++/+++/++++，可由码表扩展）
 func (p *Parser) parseGrade(b byte) string {
-	switch b {
-	case 0:
-		return "-"
-	case 1:
-		return "+"
-	case 2:
-		return "±"
-	case 3:
-		return "++"
-	case 4:
-		return "+++"
-	case 5:
-		return "++++"
-	default:
-		return "invalid"
+	return p.lookup(p.table.Grades, b)
+}
+
+// lookup 码表查询，未定义编码返回invalid
+func (p *Parser) lookup(codes map[int]string, b byte) string {
+	if label, ok := codes[int(b)]; ok {
+		return label
 	}
+	return models.GradeInvalid
 }
 
 // compareBytes 工具方法：比较字节数组是否相等（帧头/帧尾匹配）
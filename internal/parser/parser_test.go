@@ -2,6 +2,7 @@ package parser
 
 import (
 	"encoding/hex"
+	"errors"
 	"testing"
 
 	"opm-mqtt-gateway/internal/config"
@@ -25,10 +26,10 @@ func init() {
 }
 
 // TestParse_NormalFrame 测试：正常帧解析（OPM-1560B真实硬件帧）
-// 帧：AA 0520 01 00 00 00 00 00 00 00 1010 00 29 55
-// 预期：PH=5.20，尿蛋白=+，葡萄糖=-，比重=1.010，和校验=0x29，数据状态normal
+// 帧：AA 0520 01 00 00 00 00 00 00 00 00 1010 00 46 55（数据段14字节：PH/8项等级/亚硝酸盐/比重/VC）
+// 预期：PH=5.20，尿蛋白=+，葡萄糖=-，比重=1.010，和校验=0x46，数据状态normal
 func TestParse_NormalFrame(t *testing.T) {
-	frameHex := "AA052001000000000000001010002955"
+	frameHex := "AA05200100000000000000001010004655"
 	frame, _ := hex.DecodeString(frameHex)
 
 	parser := NewParser()
@@ -60,7 +61,7 @@ func TestParse_NormalFrame(t *testing.T) {
 // TestParse_CheckSumError 测试：和校验失败帧（硬件常见异常，应解析失败）
 func TestParse_CheckSumError(t *testing.T) {
 	// 校验位改为0x99，其余与正常帧一致
-	frameHex := "AA052001000000000000001010009955"
+	frameHex := "AA05200100000000000000001010009955"
 	frame, _ := hex.DecodeString(frameHex)
 
 	parser := NewParser()
@@ -68,7 +69,7 @@ func TestParse_CheckSumError(t *testing.T) {
 	if err == nil {
 		t.Fatal("和校验失败帧未返回错误，不符合预期")
 	}
-	if err.Error() != "和校验失败" {
+	if !errors.Is(err, ErrChecksumMismatch) {
 		t.Errorf("错误类型错误，预期和校验失败，实际%v", err)
 	}
 	t.Logf("和校验失败帧解析符合预期，错误：%v", err)
@@ -77,7 +78,7 @@ func TestParse_CheckSumError(t *testing.T) {
 // TestParse_FrameHeaderError 测试：帧头错误帧（非AA，应解析失败）
 func TestParse_FrameHeaderError(t *testing.T) {
 	// 帧头改为0xBB，其余与正常帧一致
-	frameHex := "BB052001000000000000001010002955"
+	frameHex := "BB05200100000000000000001010004655"
 	frame, _ := hex.DecodeString(frameHex)
 
 	parser := NewParser()
@@ -85,7 +86,7 @@ func TestParse_FrameHeaderError(t *testing.T) {
 	if err == nil {
 		t.Fatal("帧头错误帧未返回错误，不符合预期")
 	}
-	if err.Error() != "帧头校验失败（非AA）" {
+	if !errors.Is(err, ErrBadHeader) {
 		t.Errorf("错误类型错误，预期帧头校验失败，实际%v", err)
 	}
 	t.Logf("帧头错误帧解析符合预期，错误：%v", err)
@@ -93,8 +94,8 @@ func TestParse_FrameHeaderError(t *testing.T) {
 
 // TestParse_AbnormalData 测试：异常数据帧（PH=3.00超出医学范围，应标记abnormal）
 func TestParse_AbnormalData(t *testing.T) {
-	// PH=3.00（BCD码0x0300），其余与正常帧一致，和校验=0x0C
-	frameHex := "AA030001000000000000001010000C55"
+	// PH=3.00（BCD码0x0300），其余与正常帧一致，和校验=0x24
+	frameHex := "AA03000100000000000000001010002455"
 	frame, _ := hex.DecodeString(frameHex)
 
 	parser := NewParser()
@@ -108,3 +109,168 @@ func TestParse_AbnormalData(t *testing.T) {
 	}
 	t.Logf("异常数据帧解析成功，数据状态：%s", data.DataState)
 }
+
+// TestParseFrame_QualityScore 测试：临床异常结果不扣质量分，补全帧尾提交的帧按修补扣分
+func TestParseFrame_QualityScore(t *testing.T) {
+	frame, _ := hex.DecodeString("AA03000100000000000000001010002455") // PH=3.00，临床异常
+
+	parser := NewParser()
+	parser.quality = true
+	data, err := parser.Parse(frame)
+	if err != nil {
+		t.Fatalf("帧解析失败：%v", err)
+	}
+	if data.DataState != models.DataStateAbnormal || data.Quality == nil || *data.Quality != 100 {
+		t.Fatalf("临床异常结果评分错误，预期abnormal/100，实际%s/%v", data.DataState, data.Quality)
+	}
+
+	data, err = parser.ParseFrame(models.Frame{Raw: frame, Flags: models.FrameRepaired})
+	if err != nil {
+		t.Fatalf("帧解析失败：%v", err)
+	}
+	if want := 100 - models.QualityPenaltyRepaired; *data.Quality != want {
+		t.Fatalf("修补帧评分错误，预期%d，实际%d", want, *data.Quality)
+	}
+}
+
+// TestParseFrame_QualityScoreDegraded 测试：经Parse得到的无法解码项、未做和校验的帧按规则扣分
+func TestParseFrame_QualityScoreDegraded(t *testing.T) {
+	frame, _ := hex.DecodeString("AA05200109000000000000001010004F55") // 葡萄糖编码0x09超出码表
+
+	parser := NewParser()
+	parser.quality = true
+	data, err := parser.Parse(frame)
+	if err != nil {
+		t.Fatalf("帧解析失败：%v", err)
+	}
+	if data.Glucose != models.GradeInvalid || *data.Quality != 100-models.QualityPenaltyInvalidItem {
+		t.Fatalf("无法解码项评分错误，葡萄糖%s，评分%d", data.Glucose, *data.Quality)
+	}
+
+	parser.checkType = "none"
+	data, err = parser.Parse(frame)
+	if err != nil {
+		t.Fatalf("帧解析失败：%v", err)
+	}
+	if want := 100 - models.QualityPenaltyInvalidItem - models.QualityPenaltyChecksumUnverified; *data.Quality != want {
+		t.Fatalf("未校验帧评分错误，预期%d，实际%d", want, *data.Quality)
+	}
+}
+
+// TestParse_IncludeFieldHex 测试：开启include_field_hex后，各检测项附带对应原始字节
+// 帧：AA 0520 01 00 00 00 00 00 00 00 00 1010 00 46 55（14字节数据段，和校验=0x46）
+func TestParse_IncludeFieldHex(t *testing.T) {
+	frame, _ := hex.DecodeString("AA05200100000000000000001010004655")
+
+	parser := NewParser()
+	parser.fieldHex = true
+	data, err := parser.Parse(frame)
+	if err != nil {
+		t.Fatalf("帧解析失败：%v", err)
+	}
+	if data.FieldHex["ph"] != "0520" {
+		t.Errorf("PH原始字节错误，预期0520，实际%s", data.FieldHex["ph"])
+	}
+	if data.FieldHex["specific_grav"] != "1010" {
+		t.Errorf("比重原始字节错误，预期1010，实际%s", data.FieldHex["specific_grav"])
+	}
+	if data.FieldHex["protein"] != "01" {
+		t.Errorf("尿蛋白原始字节错误，预期01，实际%s", data.FieldHex["protein"])
+	}
+
+	// 默认关闭时不输出
+	data, _ = NewParser().Parse(frame)
+	if data.FieldHex != nil {
+		t.Errorf("未开启时仍输出原始字节：%v", data.FieldHex)
+	}
+}
+
+// TestParse_LengthField 测试：长度字段模式跳过长度字节解析数据段，声明长度不符返回错误
+func TestParse_LengthField(t *testing.T) {
+	frame, _ := hex.DecodeString("AA0E0520010000000000000000101055A955")
+
+	parser := NewParser()
+	parser.hasLength = true
+	data, err := parser.Parse(frame)
+	if err != nil {
+		t.Fatalf("长度字段帧解析失败：%v", err)
+	}
+	if data.Protein != "+" || data.VC != "invalid" {
+		t.Errorf("数据段偏移错误，尿蛋白=%s，维生素C=%s", data.Protein, data.VC)
+	}
+
+	// 声明长度0x0F与实际14字节不符（同步修正和校验）
+	bad, _ := hex.DecodeString("AA0F0520010000000000000000101055AA55")
+	if _, err := parser.Parse(bad); ErrorKind(err) != ErrKindLengthField {
+		t.Errorf("长度不符未返回长度字段错误，实际%v", err)
+	}
+}
+
+// TestNewParserFor_PerDeviceFrame 测试：帧头/帧尾取自传入的设备配置而非全局配置
+func TestNewParserFor_PerDeviceFrame(t *testing.T) {
+	frame, _ := hex.DecodeString("BB052001000000000000000010100046EE")
+
+	dev := *config.GlobalConfig
+	dev.Parser.FrameStart = "BB"
+	dev.Parser.FrameEnd = "EE"
+	if _, err := NewParserFor(&dev).Parse(frame); err != nil {
+		t.Fatalf("设备配置帧头/帧尾未生效：%v", err)
+	}
+	if _, err := NewParser().Parse(frame); err == nil {
+		t.Error("全局配置（AA/55）不应接受BB/EE帧")
+	}
+}
+
+// TestParse_ExtractErrors 测试：数据段提取失败以ErrExtract包裹具体原因，ErrorKind按errors.Is归类为extract，错误文案不变
+func TestParse_ExtractErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		frameHex string
+		cause    error
+	}{
+		{"数据段13字节", "AA052001000000000000000010104655", ErrDataTooShort},
+		{"PH非法BCD", "AA0A200100000000000000001010004B55", ErrBadBCD},
+	}
+	for _, c := range cases {
+		frame, _ := hex.DecodeString(c.frameHex)
+		_, err := NewParser().Parse(frame)
+		if !errors.Is(err, ErrExtract) || !errors.Is(err, c.cause) {
+			t.Errorf("%s：错误应同时匹配ErrExtract与%v，实际%v", c.name, c.cause, err)
+		}
+		if kind := ErrorKind(err); kind != ErrKindExtract {
+			t.Errorf("%s：错误分类应为extract，实际%s", c.name, kind)
+		}
+	}
+
+	frame, _ := hex.DecodeString("AA052001000000000000000010104655")
+	_, err := NewParser().Parse(frame)
+	if want := "提取数据失败：数据段长度不足，实际13，要求14"; err == nil || err.Error() != want {
+		t.Errorf("错误文案变化，预期%q，实际%v", want, err)
+	}
+}
+
+// TestVerifyChecksum 测试：和校验取数据段字节和低8位，与帧尾前1字节比对；过短帧返回帧长度不足而非越界
+func TestVerifyChecksum(t *testing.T) {
+	p := NewParser()
+	cases := []struct {
+		name     string
+		frameHex string
+		wantErr  error
+	}{
+		{"正常帧", "AA05200100000000000000001010004655", nil},
+		{"校验位错误", "AA05200100000000000000001010009955", ErrChecksumMismatch},
+		{"和溢出取低8位", "AAFFFFFE55", nil}, // 0xFF+0xFF=0x1FE，低8位0xFE
+		{"仅帧头帧尾", "AA55", ErrFrameTooShort},
+		{"空帧", "", ErrFrameTooShort},
+	}
+	for _, c := range cases {
+		frame, _ := hex.DecodeString(c.frameHex)
+		err := p.verifyChecksum(frame)
+		switch {
+		case c.wantErr == nil && err != nil:
+			t.Errorf("%s：预期通过，实际%v", c.name, err)
+		case c.wantErr != nil && !errors.Is(err, c.wantErr):
+			t.Errorf("%s：预期错误%v，实际%v", c.name, c.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"opm-mqtt-gateway/internal/models"
+)
+
+// WorkerPool 解析协程池：按设备键哈希分配到固定协程，多设备并行解析，同一设备的帧严格保序
+// （各设备链路共用一个协程池，handle按key分发到对应设备）
+type WorkerPool struct {
+	queues []chan poolJob
+	wg     sync.WaitGroup
+}
+
+// poolJob 待处理的帧及其设备键
+type poolJob struct {
+	key   string
+	frame models.Frame
+}
+
+// NewWorkerPool 新建解析协程池（workers<1按1处理，queueLen为每个协程的队列长度）
+func NewWorkerPool(workers, queueLen int, handle func(key string, frame models.Frame)) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &WorkerPool{queues: make([]chan poolJob, workers)}
+	for i := range p.queues {
+		q := make(chan poolJob, queueLen)
+		p.queues[i] = q
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range q {
+				handle(job.key, job.frame)
+			}
+		}()
+	}
+	return p
+}
+
+// Submit 提交帧（同一key始终进入同一协程队列，队列满时阻塞，向上游施加背压）
+func (p *WorkerPool) Submit(key string, frame models.Frame) {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	p.queues[h.Sum32()%uint32(len(p.queues))] <- poolJob{key: key, frame: frame}
+}
+
+// Close 关闭协程池并等待队列中剩余帧处理完毕（Close后不可再Submit）
+func (p *WorkerPool) Close() {
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.wg.Wait()
+}
@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"opm-mqtt-gateway/internal/models"
+)
+
+// TestWorkerPool_PerDeviceOrder 测试：多协程并发处理时，同一设备的帧按提交顺序处理
+func TestWorkerPool_PerDeviceOrder(t *testing.T) {
+	const devices, perDevice = 6, 200
+	var mu sync.Mutex
+	got := make(map[string][]int)
+
+	pool := NewWorkerPool(4, 16, func(dev string, f models.Frame) {
+		seq := int(f.Raw[0])<<8 | int(f.Raw[1])
+		time.Sleep(time.Duration(rand.Intn(50)) * time.Microsecond) // 打乱各协程进度
+		mu.Lock()
+		got[dev] = append(got[dev], seq)
+		mu.Unlock()
+	})
+	for i := 0; i < perDevice; i++ {
+		for d := 0; d < devices; d++ {
+			dev := fmt.Sprintf("D%02d", d)
+			pool.Submit(dev, models.Frame{Raw: []byte{byte(i >> 8), byte(i)}})
+		}
+	}
+	pool.Close()
+
+	for d := 0; d < devices; d++ {
+		dev := fmt.Sprintf("D%02d", d)
+		seqs := got[dev]
+		if len(seqs) != perDevice {
+			t.Fatalf("设备%s处理%d帧，预期%d帧", dev, len(seqs), perDevice)
+		}
+		for i, seq := range seqs {
+			if seq != i {
+				t.Fatalf("设备%s第%d帧顺序错误：%d", dev, i, seq)
+			}
+		}
+	}
+}
+
+// BenchmarkWorkerPool 基准：多设备帧经协程池解析的吞吐（对比单协程：-bench=WorkerPool/workers=1）
+func BenchmarkWorkerPool(b *testing.B) {
+	frame := []byte{0xAA, 0x05, 0x20, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x10, 0x00, 0x46, 0x55}
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			p := &Parser{frameStart: []byte{0xAA}, frameEnd: []byte{0x55}, minFrameLen: 16, table: DefaultDecodeTable()}
+			pool := NewWorkerPool(workers, 64, func(_ string, f models.Frame) { _, _ = p.ParseFrame(f) })
+			keys := []string{"SN01", "SN02", "SN03", "SN04", "SN05", "SN06", "SN07", "SN08"}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				pool.Submit(keys[i%len(keys)], models.Frame{Raw: frame})
+			}
+			pool.Close()
+		})
+	}
+}
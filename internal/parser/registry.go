@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"opm-mqtt-gateway/internal/config"
+	"opm-mqtt-gateway/internal/models"
+)
+
+// 解析模式
+const (
+	ModeBinary = "binary" // 二进制帧（AA+数据段+校验位+55）
+)
+
+// ModelParser 设备型号解析器：不同型号的协议实现注册到解析器注册表，启动时按device.model选择
+type ModelParser interface {
+	Parse(frame []byte) (*models.OPM1560BDeviceData, error)        // 解析有效帧为检测数据
+	ParseFrame(f models.Frame) (*models.OPM1560BDeviceData, error) // 解析串口层提取的帧（携带帧提取标记）
+	Mode() string                                                  // 协议模式（如binary）
+}
+
+// ParserFactory 解析器构造函数（启动时基于设备配置构造，多设备模式每台设备调用一次）
+type ParserFactory func(cfg *config.Config) ModelParser
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]ParserFactory)
+)
+
+// init 注册内置型号解析器
+func init() {
+	Register("OPM-1560B", func(cfg *config.Config) ModelParser { return NewParserFor(cfg) })
+}
+
+// Register 注册设备型号解析器（型号重复注册时覆盖，便于替换内置实现）
+func Register(model string, factory ParserFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[model] = factory
+}
+
+// NewForModel 按设备型号构造解析器（基于全局配置），型号未注册时返回错误（列出已支持型号）
+func NewForModel(model string) (ModelParser, error) {
+	return newFor(model, config.GlobalConfig)
+}
+
+// NewForConfig 按设备配置的device.model构造解析器（多设备模式每台设备一份配置）
+func NewForConfig(cfg *config.Config) (ModelParser, error) {
+	return newFor(cfg.Device.Model, cfg)
+}
+
+// newFor 查找型号对应的构造函数并以cfg构造解析器
+func newFor(model string, cfg *config.Config) (ModelParser, error) {
+	registryMu.RLock()
+	factory, ok := registry[model]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("不支持的设备型号%q，已支持：%v", model, Models())
+	}
+	return factory(cfg), nil
+}
+
+// Models 已注册的设备型号（按名称排序）
+func Models() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	out := make([]string, 0, len(registry))
+	for m := range registry {
+		out = append(out, m)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Mode OPM-1560B为二进制帧协议
+func (p *Parser) Mode() string {
+	return ModeBinary
+}
@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	"opm-mqtt-gateway/internal/config"
+	"opm-mqtt-gateway/internal/models"
+)
+
+// stubParser 模拟其他型号解析器（记录收到的帧）
+type stubParser struct {
+	frames [][]byte
+}
+
+func (s *stubParser) Parse(frame []byte) (*models.OPM1560BDeviceData, error) {
+	s.frames = append(s.frames, frame)
+	if len(frame) == 0 {
+		return nil, errors.New("空帧")
+	}
+	return models.NewOPM1560BDeviceData("SN-STUB", "STUB-100"), nil
+}
+func (s *stubParser) ParseFrame(f models.Frame) (*models.OPM1560BDeviceData, error) {
+	return s.Parse(f.Raw)
+}
+func (s *stubParser) Mode() string { return "stub" }
+
+// TestRegistry_RouteByModel 测试：按型号选择解析器，内置OPM-1560B已注册，未注册型号返回错误
+func TestRegistry_RouteByModel(t *testing.T) {
+	stub := &stubParser{}
+	Register("STUB-100", func(*config.Config) ModelParser { return stub })
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "STUB-100")
+		registryMu.Unlock()
+	}()
+
+	p, err := NewForModel("STUB-100")
+	if err != nil {
+		t.Fatalf("已注册型号构造失败：%v", err)
+	}
+	data, err := p.Parse([]byte{0x01})
+	if err != nil || p.Mode() != "stub" || data.DeviceModel != "STUB-100" || len(stub.frames) != 1 {
+		t.Fatalf("未路由到桩解析器：mode=%s，data=%+v，err=%v", p.Mode(), data, err)
+	}
+
+	builtin, err := NewForModel("OPM-1560B")
+	if err != nil {
+		t.Fatalf("内置型号未注册：%v", err)
+	}
+	if _, ok := builtin.(*Parser); !ok || builtin.Mode() != ModeBinary {
+		t.Fatalf("OPM-1560B应使用内置二进制解析器，实际%T（%s）", builtin, builtin.Mode())
+	}
+
+	if _, err := NewForModel("UNKNOWN-1"); err == nil {
+		t.Fatalf("未注册型号应返回错误")
+	}
+}
+
+// TestNewForConfig 测试：按设备配置构造解析器，设备SN取自该配置而非全局配置（多设备模式）
+func TestNewForConfig(t *testing.T) {
+	unit := *config.GlobalConfig
+	unit.Device.DeviceID = "SN-UNIT-2"
+	p, err := NewForConfig(&unit)
+	if err != nil {
+		t.Fatalf("按设备配置构造解析器失败：%v", err)
+	}
+	if got := p.(*Parser).deviceID; got != "SN-UNIT-2" {
+		t.Fatalf("解析器设备SN错误：期望SN-UNIT-2，实际%s", got)
+	}
+}
@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"sync"
+	"time"
+
+	"opm-mqtt-gateway/internal/models"
+)
+
+// RetriggerFilter 重复触发过滤器（同一样本重复按键/卡条导致1秒内连发两帧时丢弃后一帧）
+type RetriggerFilter struct {
+	mu      sync.Mutex
+	window  time.Duration              // 最小样本间隔，0为关闭
+	last    *models.OPM1560BDeviceData // 上一次放行的检测结果
+	lastAt  time.Time                  // 上一次放行时间
+	dropped uint64                     // 累计丢弃次数（监控用）
+	now     func() time.Time           // 时钟（测试可替换）
+}
+
+// NewRetriggerFilter 新建重复触发过滤器（window<=0时全部放行）
+func NewRetriggerFilter(window time.Duration) *RetriggerFilter {
+	return &RetriggerFilter{window: window, now: time.Now}
+}
+
+// Allow 判断检测结果是否放行：窗口内且检测值与上一结果一致则视为重复触发
+func (f *RetriggerFilter) Allow(data *models.OPM1560BDeviceData) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	if f.window > 0 && f.last != nil && now.Sub(f.lastAt) < f.window && sameSample(f.last, data) {
+		f.dropped++
+		return false
+	}
+	f.last, f.lastAt = data, now
+	return true
+}
+
+// Dropped 获取累计丢弃的重复触发次数
+func (f *RetriggerFilter) Dropped() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.dropped
+}
+
+// sameSample 比较两次结果的检测值是否一致（忽略检测时间/原始帧等非检测字段）
+func sameSample(a, b *models.OPM1560BDeviceData) bool {
+	return a.PH == b.PH &&
+		a.SpecificGrav == b.SpecificGrav &&
+		a.Protein == b.Protein &&
+		a.Glucose == b.Glucose &&
+		a.Ketone == b.Ketone &&
+		a.OccultBlood == b.OccultBlood &&
+		a.Leukocyte == b.Leukocyte &&
+		a.Erythrocyte == b.Erythrocyte &&
+		a.Urobilinogen == b.Urobilinogen &&
+		a.Bilirubin == b.Bilirubin &&
+		a.Nitrite == b.Nitrite &&
+		a.VC == b.VC
+}
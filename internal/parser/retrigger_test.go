@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"opm-mqtt-gateway/internal/models"
+)
+
+// newSample 构建测试检测结果
+func newSample(ph float64, protein string) *models.OPM1560BDeviceData {
+	data := models.NewOPM1560BDeviceData("SN1234567890", "OPM-1560B")
+	data.PH = ph
+	data.Protein = protein
+	data.SpecificGrav = 1.010
+	return data
+}
+
+// TestRetriggerFilter_DropNearDuplicate 测试：窗口内相同结果丢弃，内容不同或超出窗口放行
+func TestRetriggerFilter_DropNearDuplicate(t *testing.T) {
+	now := time.Date(2026, 2, 3, 10, 15, 30, 0, time.UTC)
+	f := NewRetriggerFilter(time.Second)
+	f.now = func() time.Time { return now }
+
+	if !f.Allow(newSample(5.2, "+")) {
+		t.Fatal("首个结果未放行")
+	}
+
+	// 300ms后同一样本重复触发
+	now = now.Add(300 * time.Millisecond)
+	if f.Allow(newSample(5.2, "+")) {
+		t.Error("窗口内重复触发未丢弃")
+	}
+
+	// 窗口内但检测值不同（真实的新样本）
+	now = now.Add(100 * time.Millisecond)
+	if !f.Allow(newSample(6.0, "-")) {
+		t.Error("窗口内内容不同的结果被错误丢弃")
+	}
+
+	// 超出窗口的相同结果
+	now = now.Add(2 * time.Second)
+	if !f.Allow(newSample(6.0, "-")) {
+		t.Error("超出窗口的结果被错误丢弃")
+	}
+
+	if f.Dropped() != 1 {
+		t.Errorf("丢弃计数错误，预期1，实际%d", f.Dropped())
+	}
+}
+
+// TestRetriggerFilter_Disabled 测试：窗口为0时全部放行
+func TestRetriggerFilter_Disabled(t *testing.T) {
+	f := NewRetriggerFilter(0)
+	for i := 0; i < 3; i++ {
+		if !f.Allow(newSample(5.2, "+")) {
+			t.Fatalf("关闭过滤时第%d个结果被丢弃", i+1)
+		}
+	}
+}
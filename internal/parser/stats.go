@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ParserStats 解析器累计计数快照（自进程启动起，供发布/查询）
+type ParserStats struct {
+	Received       uint64 `json:"received"`        // 进入解析的帧数
+	Parsed         uint64 `json:"parsed"`          // 解析成功帧数
+	ChecksumFailed uint64 `json:"checksum_failed"` // 和校验失败帧数
+	FrameInvalid   uint64 `json:"frame_invalid"`   // 帧长度/帧头/帧尾/长度字段校验失败帧数
+	ExtractFailed  uint64 `json:"extract_failed"`  // 数据段提取/编码解析失败帧数
+}
+
+// parserCounters 解析器内部原子计数（并发worker共享同一解析器）
+type parserCounters struct {
+	received       atomic.Uint64
+	parsed         atomic.Uint64
+	checksumFailed atomic.Uint64
+	frameInvalid   atomic.Uint64
+	extractFailed  atomic.Uint64
+}
+
+// record 按Parse结果累加对应计数
+func (c *parserCounters) record(err error) {
+	switch {
+	case err == nil:
+		c.parsed.Add(1)
+	case errors.Is(err, ErrChecksumMismatch):
+		c.checksumFailed.Add(1)
+	case errors.Is(err, ErrExtract):
+		c.extractFailed.Add(1)
+	default:
+		c.frameInvalid.Add(1)
+	}
+}
+
+// Stats 解析器计数快照
+func (p *Parser) Stats() ParserStats {
+	return ParserStats{
+		Received:       p.stats.received.Load(),
+		Parsed:         p.stats.parsed.Load(),
+		ChecksumFailed: p.stats.checksumFailed.Load(),
+		FrameInvalid:   p.stats.frameInvalid.Load(),
+		ExtractFailed:  p.stats.extractFailed.Load(),
+	}
+}
@@ -0,0 +1,27 @@
+package parser
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// TestParserStats 测试：正常/和校验失败/帧头错误/过短帧分别计入对应计数
+func TestParserStats(t *testing.T) {
+	p := NewParser()
+	frames := []string{
+		"AA05200100000000000000001010004655", // 正常
+		"AA05200100000000000000001010004655", // 正常
+		"AA05200100000000000000001010009955", // 和校验失败
+		"BB05200100000000000000001010004655", // 帧头错误
+		"AA55",                               // 过短
+	}
+	for _, h := range frames {
+		frame, _ := hex.DecodeString(h)
+		p.Parse(frame)
+	}
+	got := p.Stats()
+	want := ParserStats{Received: 5, Parsed: 2, ChecksumFailed: 1, FrameInvalid: 2}
+	if got != want {
+		t.Fatalf("计数错误，预期%+v，实际%+v", want, got)
+	}
+}
@@ -0,0 +1,100 @@
+package serial
+
+import (
+	"bytes"
+	"log"
+	"time"
+
+	"opm-mqtt-gateway/internal/config"
+
+	"go.bug.st/serial"
+)
+
+// baudProbeWindow 每个候选波特率的采样时长（测试可缩短）
+var baudProbeWindow = 2 * time.Second
+
+// baudProbeTimeout 采样期间单次读超时
+const baudProbeTimeout = 100 * time.Millisecond
+
+// probeBaudRates 自动探测的候选波特率（OPM-1560B仅支持这两种，按顺序尝试）
+var probeBaudRates = []int{9600, 19200}
+
+// probeBaud 依次以候选波特率采样，按采样数据判定设备实际波特率并切换；
+// 无法判定（采样期间未收到和校验通过的完整帧）时保持配置波特率。判定成功时返回该速率下的采样数据，供调用方放回缓冲区避免丢帧
+// 调用方需持有r.mu；采样期间（每个速率baudProbeWindow）释放r.mu，返回后调用方须检查阅读器是否已关闭
+func (r *Reader) probeBaud(port serial.Port) []byte {
+	base := r.portMode
+	samples := make(map[int][]byte, len(probeBaudRates))
+	r.mu.Unlock()
+	for _, rate := range probeBaudRates {
+		mode := base
+		mode.BaudRate = rate
+		if err := port.SetMode(&mode); err != nil {
+			log.Printf("[WARN] [serial] 波特率探测：切换到%d失败：%v", rate, err)
+			continue
+		}
+		samples[rate] = sampleBytes(port, baudProbeWindow)
+	}
+	r.mu.Lock()
+
+	rate, ok := detectBaud(r.cfg.Parser, samples)
+	if !ok {
+		log.Printf("[WARN] [serial] 波特率探测：采样期间未收到和校验通过的完整帧，使用配置波特率%d", r.portMode.BaudRate)
+		if err := port.SetMode(&r.portMode); err != nil {
+			log.Printf("[WARN] [serial] 恢复配置波特率%d失败：%v", r.portMode.BaudRate, err)
+		}
+		return nil
+	}
+	r.portMode.BaudRate = rate
+	if err := port.SetMode(&r.portMode); err != nil {
+		log.Printf("[WARN] [serial] 切换到探测波特率%d失败：%v", rate, err)
+		return nil
+	}
+	log.Printf("[INFO] [serial] 波特率探测：串口%s检测到波特率%d", r.portName, rate)
+	return samples[rate]
+}
+
+// sampleBytes 在采样时长内持续读取串口数据
+func sampleBytes(port serial.Port, window time.Duration) []byte {
+	if err := port.SetReadTimeout(baudProbeTimeout); err != nil {
+		return nil
+	}
+	var sample []byte
+	buf := make([]byte, 128)
+	for deadline := time.Now().Add(window); time.Now().Before(deadline); {
+		n, err := port.Read(buf)
+		if err != nil {
+			break
+		}
+		sample = append(sample, buf[:n]...)
+	}
+	return sample
+}
+
+// detectBaud 按各候选波特率的采样判定实际波特率：选采样中含和校验通过的完整帧的速率；
+// 仅有帧头不作为依据（错误速率下的乱码也可能偶然出现0xAA），均无完整帧则判定失败
+func detectBaud(pc config.ParserConfig, samples map[int][]byte) (int, bool) {
+	for _, rate := range probeBaudRates {
+		if containsValidFrame(pc, samples[rate]) {
+			return rate, true
+		}
+	}
+	return 0, false
+}
+
+// containsValidFrame 采样中是否含帧头/帧尾齐全且和校验通过的帧
+func containsValidFrame(pc config.ParserConfig, sample []byte) bool {
+	frameStart, frameEnd := pc.FrameStartBytes(), pc.FrameEndBytes()
+	minLen := pc.FrameMinLen
+	for i := 0; i < len(sample); i++ {
+		if !bytes.HasPrefix(sample[i:], frameStart) {
+			continue
+		}
+		for end := i + minLen; end <= len(sample); end++ {
+			if bytes.HasSuffix(sample[i:end], frameEnd) && frameSumValid(sample[i:end], len(frameStart), len(frameEnd)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package serial
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"opm-mqtt-gateway/internal/config"
+	"opm-mqtt-gateway/internal/models"
+)
+
+// FileReader 文件回放数据源：按帧间间隔把录制的帧依次送入frameChan，替代串口用于无硬件联调/CI
+type FileReader struct {
+	path      string                 // 回放文件路径
+	frames    [][]byte               // 待回放的帧（按文件顺序）
+	delay     time.Duration          // 帧间间隔
+	frameChan chan models.Frame      // 有效帧输出通道（传给解析器）
+	ctx       context.Context        // 协程管理上下文
+	cancel    context.CancelFunc     // 协程取消函数
+	done      chan struct{}          // 回放协程退出信号
+	mu        sync.Mutex             // 状态互斥锁
+	connected bool                   // 回放进行中视为在线
+	started   bool                   // 是否已启动回放协程
+	onState   models.StateChangeFunc // 连接状态变化回调
+	closeOnce sync.Once              // 保证通道只关闭一次
+}
+
+// NewFileReader 新建文件回放数据源（按全局配置拆帧，加载失败或文件中无帧时返回错误）
+func NewFileReader(path string, delay time.Duration, frameChan chan models.Frame) (*FileReader, error) {
+	return NewFileReaderFor(config.GlobalConfig, path, delay, frameChan)
+}
+
+// NewFileReaderFor 按指定设备配置新建文件回放数据源（原始录制按该设备的定界规则拆帧）
+func NewFileReaderFor(cfg *config.Config, path string, delay time.Duration, frameChan chan models.Frame) (*FileReader, error) {
+	frames, err := LoadReplayFramesFor(cfg, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("回放文件%s中无有效帧", path)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	log.Printf("[INFO] [serial] 回放文件已加载：%s，共%d帧，帧间间隔%v", path, len(frames), delay)
+	return &FileReader{
+		path:      path,
+		frames:    frames,
+		delay:     delay,
+		frameChan: frameChan,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// LoadReplayFrames 加载回放文件：.hex/.txt为16进制文本（每行一帧，#开头为注释，允许空格分隔），
+// 其余视为原始串口录制数据，按串口层同样的帧头/帧尾规则拆帧
+func LoadReplayFrames(path string) ([][]byte, error) {
+	return LoadReplayFramesFor(config.GlobalConfig, path)
+}
+
+// LoadReplayFramesFor 按指定设备配置加载回放文件（原始录制按该设备的帧头/帧尾/长度字段拆帧）
+func LoadReplayFramesFor(cfg *config.Config, path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取回放文件失败：%w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hex", ".txt":
+		return parseHexDump(data)
+	default:
+		return splitFrames(cfg, data), nil
+	}
+}
+
+// parseHexDump 解析16进制文本，每个非空非注释行为一帧
+func parseHexDump(data []byte) ([][]byte, error) {
+	var frames [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		frame, err := hex.DecodeString(strings.ReplaceAll(line, " ", ""))
+		if err != nil {
+			return nil, fmt.Errorf("第%d行16进制非法：%w", lineNo, err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, scanner.Err()
+}
+
+// splitFrames 按串口阅读器的定界规则（帧头/帧尾/长度字段/和校验重对齐）从原始录制数据中拆帧
+func splitFrames(cfg *config.Config, data []byte) [][]byte {
+	r := &Reader{
+		ctx:       context.Background(),
+		buffer:    make([]byte, 0, len(data)),
+		frameChan: make(chan models.Frame, len(data)/cfg.Parser.FrameMinLen+1),
+		now:       time.Now,
+		cfg:       cfg,
+	}
+	r.handleData(data)
+	close(r.frameChan)
+	var frames [][]byte
+	for frame := range r.frameChan {
+		frames = append(frames, frame.Raw)
+	}
+	return frames
+}
+
+// Start 启动回放协程：依次发送各帧，帧间等待delay；回放结束后保持在线，等待Close
+func (f *FileReader) Start() {
+	f.mu.Lock()
+	f.started = true
+	f.mu.Unlock()
+	f.setConnected(true, "replay_started")
+	go func() {
+		defer close(f.done)
+		for i, frame := range f.frames {
+			if i > 0 && f.delay > 0 {
+				select {
+				case <-f.ctx.Done():
+					return
+				case <-time.After(f.delay):
+				}
+			}
+			select {
+			case <-f.ctx.Done():
+				return
+			case f.frameChan <- models.Frame{Raw: frame}:
+				log.Printf("[INFO] [serial] 回放第%d/%d帧，原始16进制：%s", i+1, len(f.frames), hex.EncodeToString(frame))
+			}
+		}
+		log.Printf("[INFO] [serial] 回放文件%s已全部发送", f.path)
+	}()
+}
+
+// Close 停止回放并关闭帧通道（等待回放协程退出，避免向已关闭通道发送）
+func (f *FileReader) Close() {
+	f.cancel()
+	f.closeOnce.Do(func() {
+		f.mu.Lock()
+		started := f.started
+		f.mu.Unlock()
+		if started {
+			<-f.done
+		}
+		close(f.frameChan)
+	})
+	f.setConnected(false, "replay_closed")
+}
+
+// OnStateChange 注册连接状态变化回调（回放开始/关闭时触发）
+func (f *FileReader) OnStateChange(fn models.StateChangeFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onState = fn
+}
+
+// IsConnected 回放是否进行中（Start后至Close前）
+func (f *FileReader) IsConnected() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connected
+}
+
+// HealthState 回放健康状态（回放无静默判定，仅online/offline）
+func (f *FileReader) HealthState() string {
+	return models.ConnState(f.IsConnected())
+}
+
+// setConnected 更新在线状态，发生变化时在锁外触发回调
+func (f *FileReader) setConnected(connected bool, reason string) {
+	f.mu.Lock()
+	old := f.connected
+	f.connected = connected
+	fn := f.onState
+	f.mu.Unlock()
+	if old != connected && fn != nil {
+		fn(models.ConnState(old), models.ConnState(connected), reason)
+	}
+}
@@ -0,0 +1,64 @@
+package serial
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"opm-mqtt-gateway/internal/models"
+)
+
+// TestFileReader_ReplayInOrder 测试：回放16进制样例文件，帧按文件顺序输出，Close后通道关闭
+func TestFileReader_ReplayInOrder(t *testing.T) {
+	frameChan := make(chan models.Frame, 10)
+	fr, err := NewFileReader("testdata/replay.hex", time.Millisecond, frameChan)
+	if err != nil {
+		t.Fatalf("加载回放文件失败：%v", err)
+	}
+	fr.Start()
+
+	want := []string{
+		"aa05200100000000000000001010004655",
+		"aa06000201000000000000001020003955",
+		"aa03000100000000000000001010002455",
+	}
+	for i, w := range want {
+		select {
+		case frame := <-frameChan:
+			if got := hex.EncodeToString(frame.Raw); got != w {
+				t.Fatalf("第%d帧错误，预期%s，实际%s", i+1, w, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("第%d帧未按时回放", i+1)
+		}
+	}
+	if !fr.IsConnected() {
+		t.Fatalf("回放期间应为在线")
+	}
+
+	fr.Close()
+	if _, ok := <-frameChan; ok {
+		t.Fatalf("Close后通道应已关闭")
+	}
+	if fr.IsConnected() {
+		t.Fatalf("Close后应为离线")
+	}
+}
+
+// TestLoadReplayFrames_Raw 测试：原始串口录制按帧头/帧尾拆帧（粘包+帧前噪声）
+func TestLoadReplayFrames_Raw(t *testing.T) {
+	raw, _ := hex.DecodeString("0011" + "AA052001000000000000001010004655" + "AA052001000000000000001010004655")
+	path := filepath.Join(t.TempDir(), "capture.bin")
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	frames, err := LoadReplayFrames(path)
+	if err != nil {
+		t.Fatalf("加载原始录制失败：%v", err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("拆帧数量错误，预期2，实际%d", len(frames))
+	}
+}
@@ -1,38 +1,113 @@
 package serial
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"opm-mqtt-gateway/internal/config"
+	"opm-mqtt-gateway/internal/models"
+	"opm-mqtt-gateway/internal/sink"
 
 	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
+)
+
+const (
+	drainReadTimeout = 20 * time.Millisecond // 排空读超时（仅取系统缓冲已到达的数据，不等待新数据）
+)
+
+// 帧定界结果（非负值为帧结束位置）
+const (
+	frameIncomplete = -1 // 帧未接收完整，保留缓冲区等待后续数据
+	frameInvalid    = -2 // 帧头后数据不构成合法帧，跳过该帧头重新查找
+)
+
+// openFunc/listFunc/detailFunc 串口打开/枚举/详细枚举函数（默认serial.Open/serial.GetPortsList/enumerator.GetDetailedPortsList）
+type (
+	openFunc   func(name string, mode *serial.Mode) (serial.Port, error)
+	listFunc   func() ([]string, error)
+	detailFunc func() ([]*enumerator.PortDetails, error)
 )
 
 // Reader OPM-1560B串口阅读器实例（贴合硬件串口特性，基于serial v1.6.4实现）
 type Reader struct {
-	port        serial.Port        // 串口端口句柄
-	portMode    serial.Mode        // 串口配置（映射硬件参数）
-	portName    string             // 串口号
-	ctx         context.Context    // 协程管理上下文
-	cancel      context.CancelFunc // 协程取消函数
-	mu          sync.Mutex         // 读写互斥锁（并发安全）
-	buffer      []byte             // 数据缓冲区（处理粘包/拆包）
-	frameChan   chan []byte        // 有效帧输出通道（传给解析器）
-	isConnected bool               // 串口连接状态
-	retryCnt    int                // 打开重试次数
-	retryInt    time.Duration      // 重试间隔
-	readTimeout time.Duration      // 读超时（防止协程阻塞）
+	port        serial.Port            // 串口端口句柄
+	portMode    serial.Mode            // 串口配置（映射硬件参数）
+	portName    string                 // 串口号
+	ctx         context.Context        // 协程管理上下文
+	cancel      context.CancelFunc     // 协程取消函数
+	mu          sync.Mutex             // 读写互斥锁（并发安全）
+	buffer      []byte                 // 数据缓冲区（处理粘包/拆包）
+	frameChan   chan models.Frame      // 有效帧输出通道（传给解析器）
+	isConnected bool                   // 串口连接状态
+	retryCnt    int                    // 打开重试次数
+	retryInt    time.Duration          // 重试间隔
+	readTimeout time.Duration          // 读超时（防止协程阻塞）
+	maxDrain    int                    // 单次读取最多排空字节数（减少帧拆分）
+	failStreak  int                    // 连续和校验失败次数（帧头重对齐判定）
+	onState     models.StateChangeFunc // 连接状态变化回调（外部告警）
+	frameGap    time.Duration          // 帧间静默超时（超时丢弃残留半帧）
+	salvage     bool                   // 静默超时时尝试挽救帧尾丢失但和校验通过的帧
+	lastDataAt  time.Time              // 最近一次收到数据的时间
+	dupWindow   time.Duration          // 重复帧合并窗口（窗口内字节完全相同的连续帧视为设备重发）
+	lastFrame   []byte                 // 最近一次提交的帧（重复帧判定）
+	lastFrameAt time.Time              // 最近一次提交帧的时间
+	collapsed   uint64                 // 累计合并的重复帧数
+	discardN    int                    // 每次（重）连接后丢弃的前N帧（设备上电噪声）
+	discardLeft int                    // 本次连接剩余待丢弃帧数
+	handshake   bool                   // 打开串口后须收到有效帧才判定在线（排除仅有USB转串口适配器）
+	hsTimeout   time.Duration          // 握手等待超时（超时告警，仍保持未在线）
+	awaiting    bool                   // 串口已打开，等待首个有效帧
+	hsDeadline  time.Time              // 本次握手截止时间
+	hsWarned    bool                   // 本次握手超时是否已告警
+	openPort    openFunc               // 打开串口（测试可替换）
+	listPorts   listFunc               // 枚举串口（测试可替换）
+	now         func() time.Time       // 时钟（测试可替换）
+	// 串口层丢弃和校验失败帧（drop_bad_checksum）及累计丢弃数
+	dropBad bool
+	dropped uint64
+	// USB自动匹配（serial.port=auto:VID:PID）：每次打开前重新枚举，重启后设备号变化仍可找到
+	autoVID, autoPID string
+	listDetails      detailFunc
+	// 保证帧通道只关闭一次（Close可能被主流程与读协程重复调用）
+	closeOnce sync.Once
+	// 发送帧与关闭帧通道互斥（独立于mu：消费端阻塞时不影响Close/HealthState/Dropped等调用）
+	sendMu sync.Mutex
+	// 单次读缓冲大小（serial.read_chunk_size）
+	chunkSize int
+	// 打开后设置的RTS/DTR信号线状态（nil不修改）
+	rts, dtr *bool
+	// 打开/重连后清空驱动输入缓冲（serial.flush_on_open）
+	flushOnOpen bool
+	// 原始字节抓包（serial.capture_path，未配置为nil）
+	capture *sink.Capture
+	// 打开后自动探测波特率（serial.baud_auto）
+	baudAuto bool
+	// 等待帧尾时缓冲区保留上限（serial.max_frame_bytes）
+	maxFrameBytes int
+	// 静默看门狗：超过silenceTimeout未收到字节判定设备异常（0关闭），lastRxAt为最近收到字节（或打开串口）的时间
+	silenceTimeout time.Duration
+	lastRxAt       time.Time
+	silent         bool // 当前是否处于静默异常（状态切换日志用）
+	// 设备配置（帧头/帧尾/校验/长度字段等定界规则按设备取，多设备模式各不相同）
+	cfg *config.Config
 }
 
 // NewReader 新建串口阅读器实例（基于全局硬件配置初始化，带重试）
-func NewReader(frameChan chan []byte) (*Reader, error) {
-	cfg := config.GlobalConfig
+func NewReader(frameChan chan models.Frame) (*Reader, error) {
+	return NewReaderFor(config.GlobalConfig, frameChan)
+}
+
+// NewReaderFor 按指定设备配置新建串口阅读器（多设备模式每台设备一份配置）
+func NewReaderFor(cfg *config.Config, frameChan chan models.Frame) (*Reader, error) {
 	// 1. 映射硬件串口参数到serial.Mode（贴合OPM-1560B固化特性）
 	portMode := serial.Mode{
 		BaudRate: cfg.Serial.BaudRate,
@@ -67,13 +142,57 @@ func NewReader(frameChan chan []byte) (*Reader, error) {
 		retryCnt:    cfg.Serial.RetryCnt,
 		retryInt:    time.Duration(cfg.Serial.RetryInt) * time.Second,
 		readTimeout: time.Duration(cfg.Serial.Timeout) * time.Second,
+		maxDrain:    cfg.Serial.MaxDrain,
+		chunkSize:   cfg.Serial.ReadChunkSize,
+		rts:         cfg.Serial.RTS,
+		dtr:         cfg.Serial.DTR,
+		flushOnOpen: *cfg.Serial.FlushOnOpen,
+		baudAuto:    cfg.Serial.BaudAuto,
+		frameGap:    time.Duration(cfg.Serial.FrameGapMs) * time.Millisecond,
+		salvage:     cfg.Serial.SalvageOnGap,
+		dupWindow:   time.Duration(cfg.Serial.DupWindowMs) * time.Millisecond,
+		discardN:    cfg.Serial.DiscardFirstFrames,
+		handshake:   cfg.Serial.RequireHandshake,
+		hsTimeout:   time.Duration(cfg.Serial.HandshakeTimeoutSec) * time.Second,
+		dropBad:     cfg.Serial.DropBadChecksum,
+		openPort:    serial.Open,
+		listPorts:   serial.GetPortsList,
+		now:         time.Now,
 		isConnected: false,
+		cfg:         cfg,
+	}
+
+	r.maxFrameBytes = cfg.Serial.MaxFrameBytes
+	r.silenceTimeout = time.Duration(cfg.Serial.SilenceTimeoutS) * time.Second
+
+	// USB自动匹配（auto:VID:PID）：实际串口名在每次打开前按VID/PID解析
+	if strings.HasPrefix(r.portName, config.AutoPortPrefix) {
+		r.autoVID, r.autoPID, _ = config.ParseAutoPort(r.portName) // Load时已校验
+		r.listDetails = enumerator.GetDetailedPortsList
+	}
+
+	// 原始字节抓包（现场排查用，异步写入不阻塞读协程）
+	if path := cfg.Serial.CapturePath; path != "" {
+		capture, err := sink.NewCapture(path, int64(cfg.Serial.CaptureMaxMB)<<20, cfg.Serial.CaptureMaxBackups)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("初始化抓包文件失败: %w", err)
+		}
+		r.capture = capture
+		log.Printf("[INFO] [serial] 原始字节抓包已开启：%s", path)
+	}
+
+	// TCP透传（tcp://host:port）：仅替换底层连接，读取/拆帧/重连逻辑不变
+	if isTCPPort(r.portName) {
+		r.openPort = dialTCP
+		log.Printf("[INFO] [serial] 经串口服务器TCP透传连接：%s", r.portName)
 	}
 
 	// 4. 打开串口（带重试，解决工业现场端口偶发占用）
 	if err := r.openWithRetry(); err != nil {
 		return nil, fmt.Errorf("串口打开失败: %w", err)
 	}
+	r.setConnected(true, "serial_opened")
 
 	log.Printf("[INFO] [serial] 串口初始化成功，设备：%s，波特率：%d", r.portName, cfg.Serial.BaudRate)
 	return r, nil
@@ -90,24 +209,29 @@ func (r *Reader) Start() {
 				log.Printf("[INFO] [serial] 串口协程正常退出")
 				return
 			default:
-				if !r.isConnected {
+				if !r.portOpened() {
 					// 串口断开，自动重连
 					log.Printf("[WARN] [serial] 串口断开，开始重连（间隔：%v）", r.retryInt)
 					if err := r.openWithRetry(); err != nil {
 						time.Sleep(r.retryInt)
 						continue
 					}
+					r.setConnected(true, "serial_reconnected")
 					log.Printf("[INFO] [serial] 串口重连成功：%s", r.portName)
 				}
 
 				// 读取串口数据（带超时）
 				data, err := r.readData()
 				if err != nil {
+					if len(data) > 0 {
+						r.handleData(data) // 出错前已读到的数据照常处理
+					}
+					if r.ctx.Err() != nil {
+						continue // 已关闭（句柄已释放），回到循环顶部退出
+					}
 					log.Printf("[ERROR] [serial] 读数据失败：%v，标记断开", err)
-					r.mu.Lock()
-					r.isConnected = false
-					r.mu.Unlock()
-					_ = r.port.Close() // 释放句柄，防止泄漏
+					r.setConnected(false, "serial_read_error")
+					r.closePort() // 释放句柄，防止泄漏
 					time.Sleep(r.retryInt)
 					continue
 				}
@@ -115,6 +239,8 @@ func (r *Reader) Start() {
 				// 处理数据，提取有效帧（核心：解决粘包/拆包）
 				if len(data) > 0 {
 					r.handleData(data)
+				} else {
+					r.handleIdle()
 				}
 			}
 		}
@@ -128,6 +254,20 @@ func (r *Reader) openWithRetry() error {
 
 	var err error
 	for i := 1; i <= r.retryCnt; i++ {
+		// 已关闭则不再重连（读协程可能在Close前刚判定断开）
+		if r.ctx.Err() != nil {
+			return errors.New("串口阅读器已关闭")
+		}
+
+		// USB自动匹配：按VID/PID解析实际串口名
+		if r.autoVID != "" {
+			if err = r.resolveAutoPort(); err != nil {
+				log.Printf("[ERROR] [serial] 重试%d/%d：%v", i, r.retryCnt, err)
+				time.Sleep(r.retryInt)
+				continue
+			}
+		}
+
 		// 先检查串口是否存在（减少无效重试）
 		if !r.isPortExist() {
 			err = fmt.Errorf("串口%s不存在", r.portName)
@@ -137,24 +277,106 @@ func (r *Reader) openWithRetry() error {
 		}
 
 		// 打开串口（serial v1.6.4标准方法）
-		port, err := serial.Open(r.portName, &r.portMode)
+		var port serial.Port
+		port, err = r.openPort(r.portName, &r.portMode)
 		if err != nil {
 			log.Printf("[ERROR] [serial] 重试%d/%d：打开失败：%v", i, r.retryCnt, err)
 			time.Sleep(r.retryInt)
 			continue
 		}
 
-		// 打开成功，初始化参数
+		// 按配置设置信号线（部分线缆须置位DTR/RTS设备才发送）
+		r.applyLines(port)
+
+		// 清空断线前残留数据：驱动输入缓冲中的半帧及内部缓冲区，避免跨连接拼帧
+		if r.flushOnOpen {
+			if err = port.ResetInputBuffer(); err != nil {
+				log.Printf("[WARN] [serial] 清空串口%s输入缓冲失败：%v", r.portName, err)
+			}
+		}
+		r.buffer = r.buffer[:0]
+		r.failStreak = 0
+		r.lastRxAt = r.now() // 静默从打开时开始计时
+
+		// 波特率自动探测（TCP透传由串口服务器侧配置速率，不探测）；探测采样放回缓冲区，避免丢失采样期间的帧
+		// 采样期间释放r.mu，期间已关闭则释放新句柄
+		if r.baudAuto && !isTCPPort(r.portName) {
+			sample := r.probeBaud(port)
+			if r.ctx.Err() != nil {
+				_ = port.Close()
+				return errors.New("串口阅读器已关闭")
+			}
+			r.buffer = append(r.buffer, sample...)
+		}
+
+		// 打开成功，初始化参数（连接状态由调用方setConnected更新并触发回调）
 		r.port = port
-		r.isConnected = true
 		return nil
 	}
 	return fmt.Errorf("重试%d次后失败：%v", r.retryCnt, err)
 }
 
+// resolveAutoPort 枚举USB串口，按VID/PID匹配并更新portName；多个匹配取第一个并列出全部候选（调用方需持有r.mu）
+func (r *Reader) resolveAutoPort() error {
+	ports, err := r.listDetails()
+	if err != nil {
+		return fmt.Errorf("枚举USB串口失败：%w", err)
+	}
+	name, candidates := matchUSBPort(ports, r.autoVID, r.autoPID)
+	if name == "" {
+		return fmt.Errorf("未找到VID:PID为%s:%s的USB串口（检查设备连接或驱动）", r.autoVID, r.autoPID)
+	}
+	if len(candidates) > 1 {
+		log.Printf("[WARN] [serial] VID:PID %s:%s匹配到多个串口%v，使用%s", r.autoVID, r.autoPID, candidates, name)
+	}
+	if name != r.portName {
+		log.Printf("[INFO] [serial] VID:PID %s:%s匹配串口：%s", r.autoVID, r.autoPID, name)
+		r.portName = name
+	}
+	return nil
+}
+
+// matchUSBPort 在详细串口列表中按VID/PID（不区分大小写）查找，返回首个匹配的串口名及全部匹配
+func matchUSBPort(ports []*enumerator.PortDetails, vid, pid string) (string, []string) {
+	var matched []string
+	for _, p := range ports {
+		if p.IsUSB && strings.EqualFold(p.VID, vid) && strings.EqualFold(p.PID, pid) {
+			matched = append(matched, p.Name)
+		}
+	}
+	if len(matched) == 0 {
+		return "", nil
+	}
+	return matched[0], matched
+}
+
+// applyLines 按配置置位/复位RTS/DTR（未配置的信号线保持驱动默认状态，设置失败仅告警）
+func (r *Reader) applyLines(port serial.Port) {
+	for _, line := range []struct {
+		name  string
+		value *bool
+		set   func(bool) error
+	}{
+		{"DTR", r.dtr, port.SetDTR},
+		{"RTS", r.rts, port.SetRTS},
+	} {
+		if line.value == nil {
+			continue
+		}
+		if err := line.set(*line.value); err != nil {
+			log.Printf("[WARN] [serial] 串口%s设置%s=%v失败：%v", r.portName, line.name, *line.value, err)
+			continue
+		}
+		log.Printf("[INFO] [serial] 串口%s已设置%s=%v", r.portName, line.name, *line.value)
+	}
+}
+
 // isPortExist 检查串口是否存在（辅助工具，排查硬件连接问题）
 func (r *Reader) isPortExist() bool {
-	ports, err := serial.GetPortsList()
+	if isTCPPort(r.portName) {
+		return true // 远端地址无法枚举，由连接结果判定
+	}
+	ports, err := r.listPorts()
 	if err != nil {
 		log.Printf("[WARN] [serial] 枚举串口失败，跳过存在性检查：%v", err)
 		return true
@@ -181,35 +403,126 @@ func (r *Reader) readData() ([]byte, error) {
 		return nil, fmt.Errorf("设置超时失败：%w", err)
 	}
 
-	// 读取数据（缓冲区128字节，适配OPM-1560B单帧最大长度）
-	buf := make([]byte, 128)
+	// 读取数据（缓冲区默认128字节，适配OPM-1560B单帧最大长度；多样本批量导出可调大）
+	buf := make([]byte, r.chunkSize)
+	// 读超时（无数据到达）不是断开，按无数据处理，仅真正的I/O错误交由读协程重连
 	n, err := r.port.Read(buf)
-	if err != nil {
+	if err != nil && !isTimeoutErr(err) {
 		return nil, fmt.Errorf("读操作失败：%w", err)
 	}
 
-	return buf[:n], nil
+	// 缓冲区读满说明系统缓冲可能仍有积压，继续排空后一次性交给handleData（排空中读错误时已读数据仍返回）
+	data := buf[:n]
+	var drainErr error
+	if n == len(buf) {
+		data, drainErr = r.drainPending(data)
+	}
+	if len(data) > 0 {
+		r.lastRxAt = r.now()
+		if r.silent {
+			r.silent = false
+			log.Printf("[INFO] [serial] 串口%s恢复收到数据，解除静默异常", r.portName)
+		}
+		if r.capture != nil {
+			r.capture.Write(data)
+		}
+	}
+	return data, drainErr
+}
+
+// drainPending 排空系统缓冲中已到达的数据（短超时连续读，累计不超过maxDrain字节）；
+// 读错误时返回已读数据与错误
+// 高波特率下突发数据超过单次读缓冲时，避免一帧被拆到多次handleData中
+func (r *Reader) drainPending(data []byte) ([]byte, error) {
+	if err := r.port.SetReadTimeout(drainReadTimeout); err != nil {
+		return data, nil // 无法缩短超时则放弃排空，避免阻塞读协程
+	}
+
+	buf := make([]byte, r.chunkSize)
+	for len(data)+len(buf) <= r.maxDrain {
+		n, err := r.port.Read(buf)
+		if err != nil && !isTimeoutErr(err) {
+			return append(data, buf[:n]...), fmt.Errorf("读操作失败：%w", err) // 已读数据随错误一并返回，不丢弃
+		}
+		data = append(data, buf[:n]...)
+		if n < len(buf) || err != nil {
+			break // 未读满（或读超时），系统缓冲已排空
+		}
+	}
+	return data, nil
+}
+
+// isTimeoutErr 是否为读超时错误（超时内无数据到达，端口仍可用）：部分驱动/透传连接以错误形式返回超时
+func isTimeoutErr(err error) bool {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var te interface{ Timeout() bool }
+	return errors.As(err, &te) && te.Timeout()
+}
+
+// handleIdle 读超时无数据：检查残留半帧是否静默超时（帧尾丢失时无需等待下一帧即可挽救）
+// 挽救的帧在释放锁后发送，消费端阻塞时不影响Close/HealthState等调用
+func (r *Reader) handleIdle() {
+	r.mu.Lock()
+	out := r.expireStale(nil)
+	r.checkHandshake()
+	if r.silenceExceeded() && !r.silent {
+		r.silent = true
+		log.Printf("[WARN] [serial] 串口%s已%v未收到任何数据，判定设备异常", r.portName, r.now().Sub(r.lastRxAt).Truncate(time.Second))
+	}
+	r.mu.Unlock()
+	r.emitAll(out)
+}
+
+// silenceExceeded 串口在线但超过静默超时未收到字节（调用方需持有r.mu）
+func (r *Reader) silenceExceeded() bool {
+	return r.silenceTimeout > 0 && r.online() && !r.lastRxAt.IsZero() && r.now().Sub(r.lastRxAt) > r.silenceTimeout
+}
+
+// HealthState 串口健康状态：离线offline；在线但静默超时error（设备异常）；否则online
+func (r *Reader) HealthState() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case !r.online():
+		return models.DeviceStateOffline
+	case r.silenceExceeded():
+		return models.DeviceStateError
+	default:
+		return models.DeviceStateOnline
+	}
 }
 
 // handleData 核心：处理串口数据，提取OPM-1560B有效帧（解决粘包/拆包）
 // 硬件帧规则：AA开头 → 数据段 → 校验位 → 55结尾，基于帧头帧尾做缓冲区裁剪
+// 提取的帧在锁内收集、释放锁后发送，消费端阻塞时不影响Close/HealthState/Dropped等调用
 func (r *Reader) handleData(data []byte) {
 	r.mu.Lock()
+	out := r.flushStale(nil)
 	r.buffer = append(r.buffer, data...) // 新数据拼接到缓冲区
 	bufLen := len(r.buffer)
 	r.mu.Unlock()
 
 	// 硬件帧配置
-	frameStart := config.GetFrameStart()
-	frameEnd := config.GetFrameEnd()
-	minFrameLen := config.GlobalConfig.Parser.FrameMinLen
+	pc := r.cfg.Parser
+	frameStart := pc.FrameStartBytes()
+	frameEnd := pc.FrameEndBytes()
+	minFrameLen := pc.FrameMinLen
+	checkSum := pc.CheckType == "sum"
+	resyncAfter := pc.ResyncAfterFailures
+	hasLength := pc.HasLengthField
+	maxFrameLen := pc.FrameMaxLen
 	startLen, endLen := len(frameStart), len(frameEnd)
 
 	// 缓冲区数据不足最小帧长度，直接返回
 	if bufLen < minFrameLen {
+		r.emitAll(out)
 		return
 	}
 
+	// 释放锁后发送收集的帧（首帧送达时完成握手）
+	defer func() { r.emitAll(out) }()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -240,29 +553,212 @@ func (r *Reader) handleData(data []byte) {
 			break
 		}
 
-		// 3. 查找帧尾（55）位置，无帧尾则保留帧头缓冲区（拆包场景）
-		endIdx := -1
-		for i := startIdx + minFrameLen - endLen; i <= bufLen-endLen; i++ {
-			if compareBytes(r.buffer[i:i+endLen], frameEnd) {
-				endIdx = i + endLen // 帧尾结束位置
-				break
+		// 3. 定位帧尾：长度字段模式按声明长度定界，否则查找帧尾（55）；未接收完整则保留帧头缓冲区（拆包场景）
+		var endIdx int
+		if hasLength {
+			endIdx = r.lengthFrameEnd(startIdx, startLen, frameEnd, minFrameLen, maxFrameLen)
+		} else {
+			var nextStart []byte
+			if pc.StrictBoundary {
+				nextStart = frameStart
 			}
+			endIdx = r.scanFrameEnd(startIdx, frameEnd, minFrameLen, nextStart)
+		}
+		if endIdx == frameInvalid {
+			log.Printf("[WARN] [serial] 帧头后长度字段非法或帧尾不匹配，跳过该帧头：%s", hex.EncodeToString(r.buffer[startIdx:]))
+			r.buffer = r.buffer[startIdx+startLen:]
+			continue
 		}
-		if endIdx == -1 {
+		if endIdx == frameIncomplete {
 			r.buffer = r.buffer[startIdx:]
+			// 帧尾迟迟未到：超过上限则丢弃至下一个帧头候选（无则全部丢弃），避免缓冲区无限增长
+			if r.maxFrameBytes > 0 && len(r.buffer) > r.maxFrameBytes {
+				next := bytes.Index(r.buffer[startLen:], frameStart)
+				dropped := len(r.buffer)
+				if next == -1 {
+					r.buffer = make([]byte, 0, 1024)
+				} else {
+					dropped = startLen + next
+					r.buffer = r.buffer[dropped:]
+				}
+				r.dropped++
+				log.Printf("[WARN] [serial] 帧头后%d字节仍无帧尾，超过上限%d，丢弃%d字节（累计丢弃%d）", len(r.buffer)+dropped, r.maxFrameBytes, dropped, r.dropped)
+				continue
+			}
 			break
 		}
 
-		// 4. 提取有效帧，发送到解析通道
+		// 4. 和校验失败：重对齐优先——连续失败达到阈值，疑似把数据段中的AA误当帧头，跳过该帧头重新查找，避免吞掉后面的真实帧
+		//    （resync_after_failures=1时每次失败都重对齐）；未达阈值且开启drop_bad_checksum时丢弃该帧，不交给解析器；
+		//    两种丢弃均计入Dropped
 		validFrame := r.buffer[startIdx:endIdx]
-		r.frameChan <- validFrame
-		log.Printf("[INFO] [serial] 提取有效帧，长度：%d，原始16进制：%s", len(validFrame), hex.EncodeToString(validFrame))
+		if checkSum && !frameSumValid(validFrame, startLen, endLen) {
+			r.failStreak++
+			if resyncAfter > 0 && r.failStreak >= resyncAfter {
+				r.dropped++
+				log.Printf("[WARN] [serial] 连续%d次和校验失败，跳过疑似帧头重新对齐（累计丢弃%d），候选帧：%s", r.failStreak, r.dropped, hex.EncodeToString(validFrame))
+				r.buffer = r.buffer[startIdx+startLen:]
+				continue
+			}
+			if r.dropBad {
+				r.dropped++
+				log.Printf("[WARN] [serial] 和校验失败，丢弃帧（累计%d），原始16进制：%s", r.dropped, hex.EncodeToString(validFrame))
+				r.buffer = r.buffer[endIdx:]
+				continue
+			}
+		} else {
+			r.failStreak = 0
+		}
 
-		// 5. 裁剪缓冲区：保留帧尾后的数据（粘包场景，下一次循环处理）
+		// 5. 提取有效帧，发送到解析通道（连接后前N帧视为上电噪声丢弃；窗口内与上一帧字节完全相同视为设备重发，合并为一帧）
+		if r.discardLeft > 0 {
+			r.discardLeft--
+			log.Printf("[WARN] [serial] 丢弃连接后第%d帧（上电噪声），原始16进制：%s", r.discardN-r.discardLeft, hex.EncodeToString(validFrame))
+		} else if r.isDuplicate(validFrame) {
+			r.collapsed++
+			log.Printf("[WARN] [serial] 合并重复帧（累计%d），原始16进制：%s", r.collapsed, hex.EncodeToString(validFrame))
+		} else {
+			out = append(out, models.Frame{Raw: bytes.Clone(validFrame)}) // 复制：缓冲区后续会被复用
+			log.Printf("[INFO] [serial] 提取有效帧，长度：%d，原始16进制：%s", len(validFrame), hex.EncodeToString(validFrame))
+		}
+
+		// 6. 裁剪缓冲区：保留帧尾后的数据（粘包场景，下一次循环处理）
 		r.buffer = r.buffer[endIdx:]
 	}
 }
 
+// isDuplicate 判断是否为窗口内的重复帧，并记录本帧用于下次比较（调用方需持有r.mu）
+// 间隔超过窗口的相同帧视为独立样本（如两次检测结果一致），正常提交
+func (r *Reader) isDuplicate(frame []byte) bool {
+	if r.dupWindow <= 0 {
+		return false
+	}
+	now := r.now()
+	dup := r.lastFrame != nil && bytes.Equal(frame, r.lastFrame) && now.Sub(r.lastFrameAt) < r.dupWindow
+	r.lastFrame = append(r.lastFrame[:0], frame...)
+	r.lastFrameAt = now
+	return dup
+}
+
+// Collapsed 获取累计合并的重复帧数
+func (r *Reader) Collapsed() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.collapsed
+}
+
+// Dropped 获取串口层累计丢弃的候选帧数（和校验失败丢弃、重对齐跳过、超长无帧尾、静默残留半帧）
+func (r *Reader) Dropped() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+// flushStale 帧间静默超时则丢弃缓冲区残留的半帧（设备发送中途重启，避免旧前缀污染重启后的首帧）
+// 挽救的帧追加到out返回，由调用方释放锁后发送；调用方需持有r.mu
+func (r *Reader) flushStale(out []models.Frame) []models.Frame {
+	out = r.expireStale(out)
+	r.lastDataAt = r.now()
+	return out
+}
+
+// expireStale 静默超过帧间超时：先尝试挽救丢失帧尾的帧，再丢弃残留数据（读超时空闲时也会调用）
+// 挽救的帧追加到out返回，由调用方释放锁后发送；调用方需持有r.mu
+func (r *Reader) expireStale(out []models.Frame) []models.Frame {
+	now := r.now()
+	if r.frameGap <= 0 || len(r.buffer) == 0 || r.lastDataAt.IsZero() || now.Sub(r.lastDataAt) <= r.frameGap {
+		return out
+	}
+	if r.salvage {
+		if frame := r.salvageFrame(); frame != nil {
+			log.Printf("[WARN] [serial] 静默超时，帧尾缺失但和校验通过，补全帧尾后提交：%s", hex.EncodeToString(frame))
+			r.buffer = r.buffer[:0]
+			return append(out, models.Frame{Raw: frame, Flags: models.FrameRepaired})
+		}
+	}
+	r.dropped++
+	log.Printf("[WARN] [serial] 静默%v超过帧间超时，丢弃残留半帧（累计丢弃%d）：%s", now.Sub(r.lastDataAt).Truncate(time.Millisecond), r.dropped, hex.EncodeToString(r.buffer))
+	r.buffer = r.buffer[:0]
+	return out
+}
+
+// salvageFrame 尽力挽救帧尾丢失的帧：帧头之后的数据补全帧尾，和校验（及长度字段）通过才返回
+// 调用方需持有r.mu
+func (r *Reader) salvageFrame() []byte {
+	pc := r.cfg.Parser
+	if pc.CheckType != "sum" {
+		return nil // 无和校验无法确认数据完整，不挽救
+	}
+	frameStart := pc.FrameStartBytes()
+	frameEnd := pc.FrameEndBytes()
+	startLen, endLen := len(frameStart), len(frameEnd)
+
+	startIdx := bytes.Index(r.buffer, frameStart)
+	if startIdx == -1 {
+		return nil
+	}
+	frame := make([]byte, 0, len(r.buffer)-startIdx+endLen)
+	frame = append(frame, r.buffer[startIdx:]...)
+	frame = append(frame, frameEnd...)
+	if len(frame) < pc.FrameMinLen {
+		return nil
+	}
+	if pc.HasLengthField && int(frame[startLen]) != len(frame)-startLen-1-1-endLen {
+		return nil
+	}
+	if !frameSumValid(frame, startLen, endLen) {
+		return nil
+	}
+	return frame
+}
+
+// scanFrameEnd 查找帧尾（55）位置，返回帧结束位置（帧尾之后），无帧尾返回frameIncomplete
+// nextStart非空为严格边界模式：帧尾之后须紧跟帧头（或缓冲区结束），否则视为数据中的55继续查找
+func (r *Reader) scanFrameEnd(startIdx int, frameEnd []byte, minFrameLen int, nextStart []byte) int {
+	endLen := len(frameEnd)
+	for i := startIdx + minFrameLen - endLen; i <= len(r.buffer)-endLen; i++ {
+		if !compareBytes(r.buffer[i:i+endLen], frameEnd) {
+			continue
+		}
+		endIdx := i + endLen
+		if nextStart != nil && !r.boundaryFollows(endIdx, nextStart) {
+			continue
+		}
+		return endIdx
+	}
+	return frameIncomplete
+}
+
+// boundaryFollows 帧尾之后是否为帧头或缓冲区结束（帧头仅收到前缀时按前缀比较）
+func (r *Reader) boundaryFollows(endIdx int, nextStart []byte) bool {
+	rest := r.buffer[endIdx:]
+	if len(rest) > len(nextStart) {
+		rest = rest[:len(nextStart)]
+	}
+	return bytes.HasPrefix(nextStart, rest)
+}
+
+// lengthFrameEnd 长度字段模式：按帧头后的长度字节（数据段字节数）定界，数据中出现55也不会误切分
+// 帧格式：帧头+长度字节+数据段+校验位+帧尾，声明长度超出[min,max]或帧尾不匹配返回frameInvalid
+func (r *Reader) lengthFrameEnd(startIdx, startLen int, frameEnd []byte, minFrameLen, maxFrameLen int) int {
+	lenIdx := startIdx + startLen
+	if lenIdx >= len(r.buffer) {
+		return frameIncomplete
+	}
+	total := startLen + 1 + int(r.buffer[lenIdx]) + 1 + len(frameEnd)
+	if total < minFrameLen || total > maxFrameLen {
+		return frameInvalid
+	}
+	if len(r.buffer)-startIdx < total {
+		return frameIncomplete
+	}
+	endIdx := startIdx + total
+	if !compareBytes(r.buffer[endIdx-len(frameEnd):endIdx], frameEnd) {
+		return frameInvalid
+	}
+	return endIdx
+}
+
 // compareBytes 工具方法：比较两个字节数组是否相等（帧头/帧尾匹配）
 func compareBytes(a, b []byte) bool {
 	if len(a) != len(b) {
@@ -276,8 +772,73 @@ func compareBytes(a, b []byte) bool {
 	return true
 }
 
-// Close 优雅关闭串口：释放句柄+取消协程+关闭通道（程序退出/重连必备）
+// frameSumValid 和校验（数据段字节和取低8位，与帧尾前1字节比较，算法同解析器）
+func frameSumValid(frame []byte, startLen, endLen int) bool {
+	if len(frame) < startLen+endLen+1 {
+		return false
+	}
+	var sum byte
+	for _, b := range frame[startLen : len(frame)-endLen-1] {
+		sum += b
+	}
+	return sum == frame[len(frame)-endLen-1]
+}
+
+// emit 发送有效帧到解析通道，已关闭时放弃发送（调用方需持有r.sendMu）
+// Close先取消上下文再持sendMu关闭通道：持锁期间上下文未取消则通道必未关闭，阻塞中的发送也会因取消而放弃
+func (r *Reader) emit(f models.Frame) bool {
+	if r.ctx.Err() != nil {
+		return false
+	}
+	select {
+	case r.frameChan <- f:
+		return true
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+// emitAll 依次发送收集的帧，有帧送达时完成握手并在锁外触发在线回调
+// （调用方不得持有r.mu：消费端阻塞时发送会等待；被丢弃/合并的帧不完成握手）
+func (r *Reader) emitAll(frames []models.Frame) {
+	if len(frames) == 0 || r.sendFrames(frames) == 0 {
+		return
+	}
+	r.mu.Lock()
+	online := r.completeHandshake()
+	fn := r.onState
+	r.mu.Unlock()
+	if online && fn != nil {
+		fn(models.ConnState(false), models.ConnState(true), "serial_handshake")
+	}
+}
+
+// sendFrames 持r.sendMu依次发送，返回送达的帧数（已关闭时停止）
+func (r *Reader) sendFrames(frames []models.Frame) int {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+	for i, f := range frames {
+		if !r.emit(f) {
+			return i
+		}
+	}
+	return len(frames)
+}
+
+// closePort 释放串口句柄（读失败后重连前调用）
+func (r *Reader) closePort() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.port != nil {
+		_ = r.port.Close()
+	}
+}
+
+// Close 优雅关闭串口：取消协程+释放句柄+关闭通道（程序退出/重连必备，可重复调用）
 func (r *Reader) Close() {
+	// 先取消：阻塞在发送上的读协程随即放弃发送
+	r.cancel()
+	defer r.setConnected(false, "serial_closed") // 释放锁后更新状态并触发回调
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -286,19 +847,80 @@ func (r *Reader) Close() {
 		r.port = nil
 		log.Printf("[INFO] [serial] 串口已关闭：%s", r.portName)
 	}
-	r.isConnected = false
-	r.cancel()
-	// 通道非空时关闭（防止下游阻塞）
-	select {
-	case <-r.frameChan:
-	default:
+	r.closeOnce.Do(func() {
+		r.sendMu.Lock() // 等待进行中的发送因取消而放弃
+		defer r.sendMu.Unlock()
 		close(r.frameChan)
+		if r.capture != nil {
+			_ = r.capture.Close()
+		}
+	})
+}
+
+// OnStateChange 注册连接状态变化回调（串口打开/断开/重连/关闭时触发）
+func (r *Reader) OnStateChange(fn models.StateChangeFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onState = fn
+}
+
+// setConnected 更新串口打开状态，在线状态发生变化时在锁外触发回调
+// 开启握手时串口打开后暂不判定在线，首个有效帧送达后由completeHandshake触发在线回调
+func (r *Reader) setConnected(connected bool, reason string) {
+	r.mu.Lock()
+	old := r.online()
+	opened := connected && !r.isConnected
+	r.isConnected = connected
+	if opened {
+		r.discardLeft = r.discardN // 每次（重）连接重新计数上电噪声帧
+		if r.handshake {
+			r.awaiting, r.hsWarned = true, false
+			r.hsDeadline = r.now().Add(r.hsTimeout)
+			log.Printf("[INFO] [serial] 串口已打开，等待设备有效帧（超时%v）", r.hsTimeout)
+		}
+	}
+	now := r.online()
+	fn := r.onState
+	r.mu.Unlock()
+
+	if old != now && fn != nil {
+		fn(models.ConnState(old), models.ConnState(now), reason)
 	}
 }
 
-// IsConnected 获取串口连接状态（供上游判断是否可读取数据）
-func (r *Reader) IsConnected() bool {
+// completeHandshake 有效帧已送达：结束握手等待，返回是否由此转为在线（调用方需持有r.mu，在锁外触发回调）
+func (r *Reader) completeHandshake() bool {
+	if !r.awaiting {
+		return false
+	}
+	r.awaiting = false
+	log.Printf("[INFO] [serial] 收到设备有效帧，握手完成：%s", r.portName)
+	return r.isConnected
+}
+
+// checkHandshake 握手超时告警（同一次打开只告警一次，保持未在线，调用方需持有r.mu）
+func (r *Reader) checkHandshake() {
+	if r.awaiting && !r.hsWarned && r.now().After(r.hsDeadline) {
+		r.hsWarned = true
+		log.Printf("[WARN] [serial] 串口%s已打开但%v内未收到有效帧，设备可能未连接（仅有USB转串口适配器）", r.portName, r.hsTimeout)
+	}
+}
+
+// online 串口已打开且（开启握手时）已收到有效帧（调用方需持有r.mu）
+func (r *Reader) online() bool {
+	return r.isConnected && !r.awaiting
+}
+
+// portOpened 串口句柄是否处于打开状态（读协程据此决定是否重连）
+func (r *Reader) portOpened() bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	return r.isConnected
 }
+
+// IsConnected 获取串口在线状态（开启握手时须已收到有效帧）
+func (r *Reader) IsConnected() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.online()
+}
@@ -0,0 +1,980 @@
+package serial
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"opm-mqtt-gateway/internal/config"
+	"opm-mqtt-gateway/internal/models"
+
+	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
+)
+
+// init 模拟全局配置初始化（单元测试无需加载配置文件，直接模拟硬件参数）
+func init() {
+	config.GlobalConfig = &config.Config{
+		Device: config.DeviceConfig{
+			DeviceID: "SN1234567890", // 测试设备SN
+			Model:    "OPM-1560B",
+		},
+		Serial: config.SerialConfig{
+			Port:          "COM_TEST",
+			BaudRate:      9600,
+			DataBits:      8,
+			StopBits:      1,
+			Timeout:       3,
+			RetryCnt:      1,
+			RetryInt:      1,
+			MaxDrain:      1024,
+			ReadChunkSize: 128,
+			MaxFrameBytes: 4096,
+			FrameGapMs:    2000,
+		},
+		Parser: config.ParserConfig{
+			FrameStart:  "AA",
+			FrameEnd:    "55",
+			CheckType:   "sum",
+			FrameMinLen: 16,
+		},
+	}
+}
+
+// fakePort 模拟串口（实现serial.Port，Read从pending中取数据，无数据时模拟超时返回0）
+type fakePort struct {
+	mu      sync.Mutex
+	pending []byte // 系统缓冲中已到达、待读取的数据
+	readErr error  // 非nil时Read返回该错误（模拟拔线）
+	drained error  // 非nil时pending读空后Read返回该错误（模拟读完积压后拔线）
+}
+
+func (f *fakePort) SetMode(mode *serial.Mode) error { return nil }
+
+func (f *fakePort) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.readErr != nil {
+		return 0, f.readErr
+	}
+	if len(f.pending) == 0 && f.drained != nil {
+		return 0, f.drained
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+func (f *fakePort) Write(p []byte) (int, error)                          { return len(p), nil }
+func (f *fakePort) Drain() error                                         { return nil }
+func (f *fakePort) ResetInputBuffer() error                              { return nil }
+func (f *fakePort) ResetOutputBuffer() error                             { return nil }
+func (f *fakePort) SetDTR(dtr bool) error                                { return nil }
+func (f *fakePort) SetRTS(rts bool) error                                { return nil }
+func (f *fakePort) GetModemStatusBits() (*serial.ModemStatusBits, error) { return nil, nil }
+func (f *fakePort) SetReadTimeout(t time.Duration) error                 { return nil }
+func (f *fakePort) Close() error                                         { return nil }
+func (f *fakePort) Break(time.Duration) error                            { return nil }
+
+// remaining 剩余未读取字节数
+func (f *fakePort) remaining() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.pending)
+}
+
+// newTestReader 基于fakePort新建阅读器（跳过真实串口打开流程）
+func newTestReader(port *fakePort, frameChan chan models.Frame) *Reader {
+	cfg := config.GlobalConfig
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Reader{
+		port:        port,
+		ctx:         ctx,
+		cancel:      cancel,
+		portName:    cfg.Serial.Port,
+		frameChan:   frameChan,
+		buffer:      make([]byte, 0, 1024),
+		retryCnt:    cfg.Serial.RetryCnt,
+		retryInt:    time.Duration(cfg.Serial.RetryInt) * time.Second,
+		readTimeout: time.Duration(cfg.Serial.Timeout) * time.Second,
+		maxDrain:    cfg.Serial.MaxDrain,
+		chunkSize:   cfg.Serial.ReadChunkSize,
+		frameGap:    time.Duration(cfg.Serial.FrameGapMs) * time.Millisecond,
+		now:         time.Now,
+		isConnected: true,
+		cfg:         cfg,
+	}
+	r.maxFrameBytes = cfg.Serial.MaxFrameBytes
+	return r
+}
+
+// TestReadData_DrainLargeBurst 测试：突发数据超过128字节时一次排空，减少交给handleData的次数
+func TestReadData_DrainLargeBurst(t *testing.T) {
+	countHandoffs := func(maxDrain int) int {
+		port := &fakePort{pending: make([]byte, 400)}
+		r := newTestReader(port, make(chan models.Frame, 10))
+		r.maxDrain = maxDrain
+
+		handoffs := 0
+		for port.remaining() > 0 {
+			data, err := r.readData()
+			if err != nil {
+				t.Fatalf("读数据失败：%v", err)
+			}
+			if len(data) > 0 {
+				handoffs++
+			}
+		}
+		return handoffs
+	}
+
+	withDrain := countHandoffs(1024)
+	withoutDrain := countHandoffs(128)
+	if withDrain != 1 {
+		t.Errorf("排空模式交付次数错误，预期1，实际%d", withDrain)
+	}
+	if withoutDrain != 4 {
+		t.Errorf("非排空模式交付次数错误，预期4，实际%d", withoutDrain)
+	}
+	t.Logf("400字节突发：排空交付%d次，非排空交付%d次", withDrain, withoutDrain)
+}
+
+// TestReadData_DrainErrorKeepsData 测试：排空过程中读错误时，已读到的数据随错误一并返回
+func TestReadData_DrainErrorKeepsData(t *testing.T) {
+	port := &fakePort{pending: make([]byte, 256), drained: errors.New("device unplugged")}
+	r := newTestReader(port, make(chan models.Frame, 10))
+
+	data, err := r.readData()
+	if err == nil {
+		t.Fatal("排空时读错误应返回错误")
+	}
+	if len(data) != 256 {
+		t.Fatalf("已读数据被丢弃，预期256字节，实际%d", len(data))
+	}
+}
+
+// TestReadData_ChunkSize 测试：read_chunk_size调大到512且关闭排空时，400字节单次读取完整返回
+func TestReadData_ChunkSize(t *testing.T) {
+	port := &fakePort{pending: make([]byte, 400)}
+	r := newTestReader(port, make(chan models.Frame, 10))
+	r.chunkSize, r.maxDrain = 512, 512
+
+	data, err := r.readData()
+	if err != nil {
+		t.Fatalf("读数据失败：%v", err)
+	}
+	if len(data) != 400 || port.remaining() != 0 {
+		t.Errorf("单次读取长度错误，预期400，实际%d，剩余%d", len(data), port.remaining())
+	}
+}
+
+// TestReadData_DrainBounded 测试：排空累计不超过maxDrain，剩余数据留给下一次读取
+func TestReadData_DrainBounded(t *testing.T) {
+	port := &fakePort{pending: make([]byte, 1000)}
+	r := newTestReader(port, make(chan models.Frame, 10))
+	r.maxDrain = 512
+
+	data, err := r.readData()
+	if err != nil {
+		t.Fatalf("读数据失败：%v", err)
+	}
+	if len(data) != 512 {
+		t.Errorf("排空长度错误，预期512，实际%d", len(data))
+	}
+	if port.remaining() != 488 {
+		t.Errorf("剩余长度错误，预期488，实际%d", port.remaining())
+	}
+}
+
+// TestHandleData_ResyncFalseHeader 测试：数据中的0xAA被误判为帧头时，跳过该帧头重新对齐到真实帧
+func TestHandleData_ResyncFalseHeader(t *testing.T) {
+	config.GlobalConfig.Parser.ResyncAfterFailures = 1
+	defer func() { config.GlobalConfig.Parser.ResyncAfterFailures = 0 }()
+
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+
+	realFrame, _ := hex.DecodeString("AA052001000000000000001010004655")
+	// 真实帧前残留半帧数据，其中含0xAA（伪帧头）
+	data := append([]byte{0xAA, 0x01, 0x02}, realFrame...)
+	r.handleData(data)
+
+	select {
+	case frame := <-frameChan:
+		if !bytes.Equal(frame.Raw, realFrame) {
+			t.Fatalf("重对齐后帧错误，预期%X，实际%X", realFrame, frame.Raw)
+		}
+	default:
+		t.Fatal("未提取到真实帧")
+	}
+	if len(frameChan) != 0 {
+		t.Errorf("多余帧数量：%d", len(frameChan))
+	}
+	if r.failStreak != 0 {
+		t.Errorf("对齐到真实帧后失败计数未清零：%d", r.failStreak)
+	}
+	if r.Dropped() != 1 {
+		t.Errorf("重对齐跳过的候选帧未计入丢弃，预期1，实际%d", r.Dropped())
+	}
+}
+
+// TestHandleData_BadChecksumReachesParser 测试：默认不重对齐，和校验失败帧交给解析器（计数/隔离），不在串口层丢弃
+func TestHandleData_BadChecksumReachesParser(t *testing.T) {
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+
+	badFrame, _ := hex.DecodeString("AA052001000000000000001010009955")
+	r.handleData(badFrame)
+	if len(frameChan) != 1 {
+		t.Fatalf("默认配置下校验失败帧未交给解析器，通道帧数：%d", len(frameChan))
+	}
+	if got := <-frameChan; !bytes.Equal(got.Raw, badFrame) {
+		t.Errorf("提交帧错误，预期%X，实际%X", badFrame, got.Raw)
+	}
+}
+
+// TestHandleData_ResyncThreshold 测试：未达到重对齐阈值时，校验失败的候选帧照常交给解析器
+func TestHandleData_ResyncThreshold(t *testing.T) {
+	config.GlobalConfig.Parser.ResyncAfterFailures = 2
+	defer func() { config.GlobalConfig.Parser.ResyncAfterFailures = 0 }()
+
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+
+	badFrame, _ := hex.DecodeString("AA052001000000000000001010009955")
+	r.handleData(badFrame)
+	if len(frameChan) != 1 {
+		t.Fatalf("未达阈值时候选帧未交给解析器，通道帧数：%d", len(frameChan))
+	}
+	if r.failStreak != 1 {
+		t.Errorf("和校验失败计数错误，预期1，实际%d", r.failStreak)
+	}
+}
+
+// TestHandleData_DropBadChecksum 测试：开启串口层和校验时，校验失败帧丢弃计数且不进入通道，后续正常帧照常提交
+func TestHandleData_DropBadChecksum(t *testing.T) {
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+	r.dropBad = true
+
+	badFrame, _ := hex.DecodeString("AA052001000000000000001010009955")
+	r.handleData(badFrame)
+	if len(frameChan) != 0 || r.Dropped() != 1 {
+		t.Fatalf("和校验失败帧未丢弃，通道帧数：%d，丢弃数：%d", len(frameChan), r.Dropped())
+	}
+
+	goodFrame, _ := hex.DecodeString("AA052001000000000000001010004655")
+	r.handleData(goodFrame)
+	if len(frameChan) != 1 {
+		t.Fatalf("正常帧未提交，通道帧数：%d", len(frameChan))
+	}
+}
+
+// TestHandleData_DropBadWithResync 测试：同时开启重对齐与串口层丢弃时重对齐优先；两种丢弃都计入Dropped，均不进入通道
+func TestHandleData_DropBadWithResync(t *testing.T) {
+	defer func() { config.GlobalConfig.Parser.ResyncAfterFailures = 0 }()
+	badFrame, _ := hex.DecodeString("AA052001000000000000001010009955")
+
+	// resync=1：每次失败都重对齐（跳过帧头后剩余数据无帧头）；resync=2：首次失败未达阈值，drop_bad_checksum丢弃整帧
+	for _, resync := range []int{1, 2} {
+		config.GlobalConfig.Parser.ResyncAfterFailures = resync
+		frameChan := make(chan models.Frame, 10)
+		r := newTestReader(&fakePort{}, frameChan)
+		r.dropBad = true
+
+		r.handleData(badFrame)
+		if len(frameChan) != 0 || r.Dropped() != 1 || r.failStreak != 1 {
+			t.Errorf("resync=%d：通道%d帧，丢弃%d，连续失败%d", resync, len(frameChan), r.Dropped(), r.failStreak)
+		}
+	}
+}
+
+// TestOnStateChange_ReadErrorAndClose 测试：读失败（拔线）触发online→offline回调，关闭时不重复触发
+func TestOnStateChange_ReadErrorAndClose(t *testing.T) {
+	port := &fakePort{readErr: errors.New("device disconnected")}
+	r := newTestReader(port, make(chan models.Frame, 10))
+
+	type change struct{ old, new, reason string }
+	changes := make(chan change, 10)
+	r.OnStateChange(func(old, new, reason string) {
+		changes <- change{old, new, reason}
+	})
+
+	r.Start()
+	select {
+	case c := <-changes:
+		if c.old != "online" || c.new != "offline" || c.reason != "serial_read_error" {
+			t.Errorf("状态变化回调错误：%+v", c)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("读失败后未触发状态变化回调")
+	}
+
+	r.cancel()
+	r.Close()
+	select {
+	case c := <-changes:
+		t.Errorf("已离线状态关闭时重复触发回调：%+v", c)
+	default:
+	}
+}
+
+// TestOnStateChange_Reconnect 测试：重连成功触发offline→online回调
+func TestOnStateChange_Reconnect(t *testing.T) {
+	r := newTestReader(&fakePort{}, make(chan models.Frame, 10))
+	r.isConnected = false
+
+	var got []string
+	r.OnStateChange(func(old, new, reason string) {
+		got = append(got, old+"->"+new+":"+reason)
+	})
+	r.setConnected(true, "serial_reconnected")
+	r.setConnected(true, "serial_reconnected") // 状态未变化，不触发
+	r.setConnected(false, "serial_read_error")
+
+	want := []string{"offline->online:serial_reconnected", "online->offline:serial_read_error"}
+	if len(got) != len(want) {
+		t.Fatalf("回调次数错误，预期%v，实际%v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("第%d次回调错误，预期%s，实际%s", i+1, want[i], got[i])
+		}
+	}
+}
+
+// TestHandleData_LengthField 测试：长度字段模式按声明长度定界，数据段中的0x55不会导致提前切分
+// 帧：AA 0E(数据段14字节) 0520 01 00×7 00 1010 55(维生素C) A9 55
+func TestHandleData_LengthField(t *testing.T) {
+	frame, _ := hex.DecodeString("AA0E0520010000000000000000101055A955")
+
+	// 帧尾扫描模式：数据段中的0x55被误判为帧尾
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+	r.handleData(frame)
+	if len(frameChan) == 1 {
+		if got := <-frameChan; bytes.Equal(got.Raw, frame) {
+			t.Fatal("帧尾扫描模式预期被提前切分，测试帧构造有误")
+		}
+	}
+
+	// 长度字段模式：按声明长度完整提取（两帧粘包）
+	config.GlobalConfig.Parser.HasLengthField = true
+	config.GlobalConfig.Parser.FrameMaxLen = 128
+	defer func() { config.GlobalConfig.Parser.HasLengthField = false }()
+
+	frameChan = make(chan models.Frame, 10)
+	r = newTestReader(&fakePort{}, frameChan)
+	r.handleData(append(append([]byte{}, frame...), frame...))
+	if len(frameChan) != 2 {
+		t.Fatalf("长度字段模式提取帧数错误，预期2，实际%d", len(frameChan))
+	}
+	for i := 0; i < 2; i++ {
+		if got := <-frameChan; !bytes.Equal(got.Raw, frame) {
+			t.Errorf("第%d帧错误，预期%X，实际%X", i+1, frame, got)
+		}
+	}
+}
+
+// TestHandleData_PerDeviceConfig 测试：定界规则取自阅读器自身的设备配置而非全局配置（多设备各自生效）
+func TestHandleData_PerDeviceConfig(t *testing.T) {
+	frame, _ := hex.DecodeString("AA0E0520010000000000000000101055A955")
+
+	dev := *config.GlobalConfig
+	dev.Parser.HasLengthField = true
+	dev.Parser.FrameMaxLen = 128
+
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+	r.cfg = &dev
+	r.handleData(frame)
+	if len(frameChan) != 1 {
+		t.Fatalf("设备配置的长度字段模式未生效，预期1帧，实际%d", len(frameChan))
+	}
+	if got := <-frameChan; !bytes.Equal(got.Raw, frame) {
+		t.Errorf("提取帧错误，预期%X，实际%X", frame, got.Raw)
+	}
+	if config.GlobalConfig.Parser.HasLengthField {
+		t.Error("设备配置不应修改全局配置")
+	}
+}
+
+// TestHandleData_LengthFieldInvalid 测试：声明长度超出上限时跳过该帧头，继续查找后续真实帧
+func TestHandleData_LengthFieldInvalid(t *testing.T) {
+	config.GlobalConfig.Parser.HasLengthField = true
+	config.GlobalConfig.Parser.FrameMaxLen = 128
+	defer func() { config.GlobalConfig.Parser.HasLengthField = false }()
+
+	frame, _ := hex.DecodeString("AA0E0520010000000000000000101055A955")
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+	r.handleData(append([]byte{0xAA, 0xFF, 0x00}, frame...)) // 伪帧头声明长度255
+	if len(frameChan) != 1 {
+		t.Fatalf("提取帧数错误，预期1，实际%d", len(frameChan))
+	}
+	if got := <-frameChan; !bytes.Equal(got.Raw, frame) {
+		t.Errorf("帧错误，预期%X，实际%X", frame, got)
+	}
+}
+
+// TestHandleData_FlushStalePartial 测试：设备发送中途重启，静默超时后残留半帧被丢弃，不污染重启后的首帧
+func TestHandleData_FlushStalePartial(t *testing.T) {
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+	now := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	frame, _ := hex.DecodeString("AA05200100000000000000001010004655")
+	r.handleData(frame[:6]) // 重启前发出的半帧
+
+	// 间隔内续传的数据不丢弃
+	now = now.Add(500 * time.Millisecond)
+	r.handleData(frame[6:8])
+	if len(r.buffer) != 8 {
+		t.Fatalf("帧间隔内数据被错误丢弃，缓冲区长度%d", len(r.buffer))
+	}
+
+	// 重启后静默3秒，再发完整帧
+	now = now.Add(3 * time.Second)
+	r.handleData(frame)
+	if len(frameChan) != 1 {
+		t.Fatalf("提取帧数错误，预期1，实际%d", len(frameChan))
+	}
+	if got := <-frameChan; !bytes.Equal(got.Raw, frame) {
+		t.Errorf("重启后首帧被残留半帧污染，预期%X，实际%X", frame, got)
+	}
+	if r.Dropped() != 1 {
+		t.Errorf("丢弃的残留半帧未计数，预期1，实际%d", r.Dropped())
+	}
+}
+
+// TestHandleIdle_SalvageMissingTrailer 测试：帧尾丢失但和校验通过，静默超时后补全帧尾挽救该帧并标记修补
+func TestHandleIdle_SalvageMissingTrailer(t *testing.T) {
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+	r.salvage = true
+	now := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	frame, _ := hex.DecodeString("AA05200100000000000000001010004655")
+	r.handleData(frame[:len(frame)-1]) // 帧尾55丢失
+
+	// 间隔内空闲不挽救（可能仍在接收）
+	now = now.Add(500 * time.Millisecond)
+	r.handleIdle()
+	if len(frameChan) != 0 || len(r.buffer) == 0 {
+		t.Fatalf("帧间隔内不应挽救/丢弃，通道%d，缓冲区%d", len(frameChan), len(r.buffer))
+	}
+
+	now = now.Add(3 * time.Second)
+	r.handleIdle()
+	if len(frameChan) != 1 {
+		t.Fatalf("挽救帧数错误，预期1，实际%d", len(frameChan))
+	}
+	if got := <-frameChan; !bytes.Equal(got.Raw, frame) || got.Flags != models.FrameRepaired {
+		t.Errorf("挽救帧错误，预期%X（标记修补），实际%X（标记%d）", frame, got.Raw, got.Flags)
+	}
+	if len(r.buffer) != 0 {
+		t.Errorf("挽救后缓冲区未清空，剩余%d字节", len(r.buffer))
+	}
+}
+
+// TestHandleIdle_SalvageChecksumMismatch 测试：帧尾丢失且和校验不通过，静默超时后丢弃不挽救
+func TestHandleIdle_SalvageChecksumMismatch(t *testing.T) {
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+	r.salvage = true
+	now := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	frame, _ := hex.DecodeString("AA05200100000000000000001010009955")
+	r.handleData(frame[:len(frame)-1])
+
+	now = now.Add(3 * time.Second)
+	r.handleIdle()
+	if len(frameChan) != 0 {
+		t.Fatalf("和校验失败的残留数据不应被挽救")
+	}
+	if len(r.buffer) != 0 || r.Dropped() != 1 {
+		t.Errorf("静默超时后残留数据未丢弃计数，剩余%d字节，丢弃%d", len(r.buffer), r.Dropped())
+	}
+}
+
+// TestHandleData_CollapseDuplicate 测试：设备重发的连续相同帧合并为一帧，超过窗口的相同帧视为独立样本
+func TestHandleData_CollapseDuplicate(t *testing.T) {
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+	r.dupWindow = 500 * time.Millisecond
+	now := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	frame, _ := hex.DecodeString("AA05200100000000000000001010004655")
+	r.handleData(append(append([]byte{}, frame...), frame...)) // 背靠背重发
+	if len(frameChan) != 1 {
+		t.Fatalf("重复帧未合并，预期1帧，实际%d", len(frameChan))
+	}
+	if r.Collapsed() != 1 {
+		t.Errorf("合并计数错误，预期1，实际%d", r.Collapsed())
+	}
+
+	// 间隔超过窗口：同结果的新样本，正常提交
+	now = now.Add(time.Second)
+	r.handleData(frame)
+	if len(frameChan) != 2 {
+		t.Fatalf("窗口外相同帧应正常提交，预期2帧，实际%d", len(frameChan))
+	}
+}
+
+// TestHandleData_StrictBoundary 测试：校验位恰为0x55时，严格边界模式不在校验位处提前切分
+// 帧：AA 0520 01 02 03 04 05 01 00 00 00 1010 00 55(校验位) 55(帧尾)
+func TestHandleData_StrictBoundary(t *testing.T) {
+	frame, _ := hex.DecodeString("AA05200102030405010000001010005555")
+	next, _ := hex.DecodeString("AA05200100000000000000001010004655")
+	stream := append(append([]byte{}, frame...), next...)
+
+	// 默认模式：在校验位55处提前切分，该帧丢失
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+	r.handleData(stream)
+	for len(frameChan) > 0 {
+		if got := <-frameChan; bytes.Equal(got.Raw, frame) {
+			t.Fatalf("默认模式不应完整提取校验位为55的帧（用例前提不成立）")
+		}
+	}
+
+	// 严格模式：帧尾后须紧跟帧头，两帧均完整提取
+	config.GlobalConfig.Parser.StrictBoundary = true
+	defer func() { config.GlobalConfig.Parser.StrictBoundary = false }()
+	frameChan = make(chan models.Frame, 10)
+	r = newTestReader(&fakePort{}, frameChan)
+	r.handleData(stream)
+	if len(frameChan) != 2 {
+		t.Fatalf("严格模式提取帧数错误，预期2，实际%d", len(frameChan))
+	}
+	if got := <-frameChan; !bytes.Equal(got.Raw, frame) {
+		t.Errorf("第一帧错误，预期%X，实际%X", frame, got)
+	}
+	if got := <-frameChan; !bytes.Equal(got.Raw, next) {
+		t.Errorf("第二帧错误，预期%X，实际%X", next, got)
+	}
+}
+
+// TestHandleData_DiscardFirstFrames 测试：连接后前N帧视为上电噪声丢弃，第N+1帧正常提交，重连后重新计数
+func TestHandleData_DiscardFirstFrames(t *testing.T) {
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+	r.isConnected = false
+	r.discardN = 2
+	r.setConnected(true, "serial_opened")
+
+	frame, _ := hex.DecodeString("AA05200100000000000000001010004655")
+	for i := 0; i < 3; i++ {
+		r.handleData(frame)
+	}
+	if len(frameChan) != 1 {
+		t.Fatalf("应丢弃前2帧仅提交第3帧，实际提交%d帧", len(frameChan))
+	}
+	<-frameChan
+
+	// 重连后重新丢弃前2帧
+	r.setConnected(false, "serial_read_error")
+	r.setConnected(true, "serial_reconnected")
+	r.handleData(frame)
+	if len(frameChan) != 0 {
+		t.Fatalf("重连后首帧应被丢弃")
+	}
+}
+
+// TestHandshake_NoFramesStaysOffline 测试：开启握手时串口打开但无有效帧，不判定在线；收到有效帧后才上报online
+func TestHandshake_NoFramesStaysOffline(t *testing.T) {
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+	r.isConnected = false
+	r.handshake = true
+	r.hsTimeout = 5 * time.Second
+	now := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	var events []string
+	r.OnStateChange(func(old, new, reason string) { events = append(events, new+"/"+reason) })
+
+	r.setConnected(true, "serial_opened")
+	if r.IsConnected() || len(events) != 0 {
+		t.Fatalf("串口打开但未收到有效帧不应判定在线，事件：%v", events)
+	}
+
+	// 超时仍无有效帧：告警但保持未在线，读协程不重连
+	now = now.Add(6 * time.Second)
+	r.handleIdle()
+	if !r.hsWarned || r.IsConnected() || !r.portOpened() {
+		t.Fatalf("握手超时应告警并保持未在线：warned=%v online=%v opened=%v", r.hsWarned, r.IsConnected(), r.portOpened())
+	}
+
+	frame, _ := hex.DecodeString("AA05200100000000000000001010004655")
+	r.handleData(frame)
+	if !r.IsConnected() {
+		t.Fatalf("收到有效帧后应判定在线")
+	}
+	if len(events) != 1 || events[0] != "online/serial_handshake" {
+		t.Errorf("在线回调错误：%v", events)
+	}
+}
+
+// TestHandshake_DiscardedFrameDoesNotComplete 测试：上电噪声丢弃的帧不完成握手，首个送达的帧才判定在线
+func TestHandshake_DiscardedFrameDoesNotComplete(t *testing.T) {
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+	r.isConnected = false
+	r.handshake = true
+	r.hsTimeout = 5 * time.Second
+	r.discardN = 1
+	var events []string
+	r.OnStateChange(func(old, new, reason string) { events = append(events, new+"/"+reason) })
+
+	r.setConnected(true, "serial_opened")
+	frame, _ := hex.DecodeString("AA05200100000000000000001010004655")
+	r.handleData(frame)
+	if r.IsConnected() || len(frameChan) != 0 || len(events) != 0 {
+		t.Fatalf("被丢弃的上电噪声帧不应完成握手：online=%v 事件%v", r.IsConnected(), events)
+	}
+
+	r.handleData(frame)
+	if !r.IsConnected() || len(frameChan) != 1 {
+		t.Fatalf("首个送达的帧应完成握手：online=%v 通道%d帧", r.IsConnected(), len(frameChan))
+	}
+	if len(events) != 1 || events[0] != "online/serial_handshake" {
+		t.Errorf("在线回调错误：%v", events)
+	}
+}
+
+// TestMatchUSBPort 测试：按VID/PID（不区分大小写）匹配USB串口，多个匹配取第一个，非USB口与无匹配时返回空
+func TestMatchUSBPort(t *testing.T) {
+	ports := []*enumerator.PortDetails{
+		{Name: "/dev/ttyS0"},
+		{Name: "/dev/ttyUSB0", IsUSB: true, VID: "0403", PID: "6001"},
+		{Name: "/dev/ttyUSB1", IsUSB: true, VID: "1a86", PID: "7523"},
+		{Name: "/dev/ttyUSB2", IsUSB: true, VID: "1A86", PID: "7523"},
+	}
+	name, candidates := matchUSBPort(ports, "1A86", "7523")
+	if name != "/dev/ttyUSB1" || len(candidates) != 2 {
+		t.Fatalf("匹配结果错误：%s，候选%v", name, candidates)
+	}
+	if name, _ := matchUSBPort(ports, "10C4", "EA60"); name != "" {
+		t.Fatalf("无匹配时应返回空，实际%s", name)
+	}
+
+	r := newTestReader(&fakePort{}, make(chan models.Frame, 1))
+	r.autoVID, r.autoPID = "10C4", "EA60"
+	r.listDetails = func() ([]*enumerator.PortDetails, error) { return ports, nil }
+	if err := r.resolveAutoPort(); err == nil {
+		t.Fatalf("无匹配设备时应返回错误")
+	}
+	r.autoVID, r.autoPID = "0403", "6001"
+	if err := r.resolveAutoPort(); err != nil || r.portName != "/dev/ttyUSB0" {
+		t.Fatalf("解析串口名错误：%s，%v", r.portName, err)
+	}
+}
+
+// TestClose_DuringActiveFlow 测试：数据持续到达且下游停止消费时关闭，不向已关闭通道发送（无panic）、不死锁
+func TestClose_DuringActiveFlow(t *testing.T) {
+	frame, _ := hex.DecodeString("AA052001000000000000001010004655")
+	for i := 0; i < 20; i++ {
+		port := &fakePort{}
+		frameChan := make(chan models.Frame, 2) // 小缓冲，读协程很快阻塞在发送上
+		r := newTestReader(port, frameChan)
+
+		stop := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					port.mu.Lock()
+					port.pending = append(port.pending, frame...)
+					port.mu.Unlock()
+					time.Sleep(100 * time.Microsecond)
+				}
+			}
+		}()
+
+		r.Start()
+		time.Sleep(2 * time.Millisecond)
+		done := make(chan struct{})
+		go func() {
+			r.Close()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("第%d轮：关闭阻塞", i+1)
+		}
+		close(stop)
+		for range frameChan {
+		}
+		r.Close() // 重复关闭不应panic
+	}
+}
+
+// linePort 记录RTS/DTR设置的模拟串口
+type linePort struct {
+	fakePort
+	lines map[string]bool
+}
+
+func (l *linePort) SetDTR(dtr bool) error   { l.lines["DTR"] = dtr; return nil }
+func (l *linePort) SetRTS(rts bool) error   { l.lines["RTS"] = rts; return nil }
+func (l *linePort) ResetInputBuffer() error { l.lines["flushed"] = true; return nil }
+
+// TestOpenWithRetry_ApplyLines 测试：配置的RTS/DTR在打开后设置，未配置的信号线不修改
+func TestOpenWithRetry_ApplyLines(t *testing.T) {
+	r := newTestReader(&fakePort{}, make(chan models.Frame, 1))
+	r.port = nil
+	r.portName = "/dev/ttyUSB0"
+	r.listPorts = func() ([]string, error) { return []string{"/dev/ttyUSB0"}, nil }
+	port := &linePort{lines: map[string]bool{}}
+	r.openPort = func(string, *serial.Mode) (serial.Port, error) { return port, nil }
+
+	on := true
+	r.dtr = &on
+	if err := r.openWithRetry(); err != nil {
+		t.Fatalf("打开失败：%v", err)
+	}
+	if v, ok := port.lines["DTR"]; !ok || !v {
+		t.Errorf("DTR未置位：%v", port.lines)
+	}
+	if _, ok := port.lines["RTS"]; ok {
+		t.Errorf("未配置的RTS不应修改：%v", port.lines)
+	}
+}
+
+// TestOpenWithRetry_FlushOnReconnect 测试：重连后清空驱动输入缓冲与内部缓冲区，断线前残留半帧不跨连接拼帧
+func TestOpenWithRetry_FlushOnReconnect(t *testing.T) {
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+	half, _ := hex.DecodeString("AA0520010000")
+	r.handleData(half)
+	if len(r.buffer) == 0 {
+		t.Fatalf("半帧应保留在缓冲区等待后续数据")
+	}
+
+	// 模拟断线重连
+	r.port = nil
+	r.isConnected = false
+	r.listPorts = func() ([]string, error) { return []string{r.portName}, nil }
+	port := &linePort{lines: map[string]bool{}}
+	r.openPort = func(string, *serial.Mode) (serial.Port, error) { return port, nil }
+	r.flushOnOpen = true
+	if err := r.openWithRetry(); err != nil {
+		t.Fatalf("重连失败：%v", err)
+	}
+	if len(r.buffer) != 0 {
+		t.Fatalf("重连后内部缓冲区未清空：%x", r.buffer)
+	}
+	if !port.lines["flushed"] {
+		t.Errorf("重连后未清空驱动输入缓冲")
+	}
+}
+
+// TestOpenWithRetry_BaudProbeReleasesLock 测试：波特率探测采样期间不持有r.mu（HealthState可立即返回），仅有帧头时保持配置波特率
+func TestOpenWithRetry_BaudProbeReleasesLock(t *testing.T) {
+	old := baudProbeWindow
+	baudProbeWindow = 300 * time.Millisecond
+	defer func() { baudProbeWindow = old }()
+
+	r := newTestReader(&fakePort{}, make(chan models.Frame, 1))
+	r.port = nil
+	r.portName = "/dev/ttyUSB0"
+	r.baudAuto = true
+	r.listPorts = func() ([]string, error) { return []string{"/dev/ttyUSB0"}, nil }
+	port := &fakePort{pending: []byte{0x13, 0xAA, 0x7F, 0x00, 0xE1}}
+	r.openPort = func(string, *serial.Mode) (serial.Port, error) { return port, nil }
+	configured := r.portMode.BaudRate
+
+	done := make(chan error, 1)
+	go func() { done <- r.openWithRetry() }()
+	time.Sleep(50 * time.Millisecond)
+
+	state := make(chan string, 1)
+	go func() { state <- r.HealthState() }()
+	select {
+	case <-state:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("探测采样期间HealthState被阻塞")
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("打开失败：%v", err)
+	}
+	if r.portMode.BaudRate != configured {
+		t.Errorf("仅有帧头不应切换波特率：预期%d，实际%d", configured, r.portMode.BaudRate)
+	}
+}
+
+// TestDetectBaud 测试：仅选择含和校验通过的完整帧的速率，仅有帧头或和校验失败均判定失败
+func TestDetectBaud(t *testing.T) {
+	frame, _ := hex.DecodeString("AA052001000000000000001010004655")
+	garbageWithHeader := []byte{0x13, 0xAA, 0x7F, 0x00, 0xE1}
+	garbage := []byte{0x13, 0x7F, 0x00, 0xE1}
+	badSum, _ := hex.DecodeString("AA052001000000000000001010009955")
+	cases := []struct {
+		name    string
+		samples map[int][]byte
+		want    int
+		ok      bool
+	}{
+		{"9600有效帧", map[int][]byte{9600: frame, 19200: garbage}, 9600, true},
+		{"19200有效帧优先于9600乱码帧头", map[int][]byte{9600: garbageWithHeader, 19200: append([]byte{0x00}, frame...)}, 19200, true},
+		{"仅帧头不作为依据", map[int][]byte{9600: garbage, 19200: garbageWithHeader}, 0, false},
+		{"帧头帧尾齐全但和校验失败", map[int][]byte{9600: garbage, 19200: badSum}, 0, false},
+		{"设备未发送", map[int][]byte{9600: nil, 19200: nil}, 0, false},
+		{"均为乱码", map[int][]byte{9600: garbage, 19200: garbage}, 0, false},
+	}
+	for _, c := range cases {
+		got, ok := detectBaud(config.GlobalConfig.Parser, c.samples)
+		if got != c.want || ok != c.ok {
+			t.Errorf("%s：预期%d/%v，实际%d/%v", c.name, c.want, c.ok, got, ok)
+		}
+	}
+}
+
+// TestHandleData_MaxFrameBytes 测试：帧头后持续收到无帧尾数据时缓冲区有界，丢弃后仍能提取后续正常帧
+func TestHandleData_MaxFrameBytes(t *testing.T) {
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(&fakePort{}, frameChan)
+	r.maxFrameBytes = 512
+
+	r.handleData([]byte{0xAA})
+	junk := bytes.Repeat([]byte{0x01}, 100)
+	for i := 0; i < 100; i++ {
+		r.handleData(junk)
+		if len(r.buffer) > r.maxFrameBytes {
+			t.Fatalf("第%d次写入后缓冲区超过上限：%d", i+1, len(r.buffer))
+		}
+	}
+
+	frame, _ := hex.DecodeString("AA052001000000000000001010004655")
+	r.handleData(frame)
+	if len(frameChan) != 1 {
+		t.Fatalf("丢弃后未能提取正常帧，通道帧数：%d", len(frameChan))
+	}
+	if r.Dropped() == 0 {
+		t.Errorf("超长无帧尾数据丢弃未计数")
+	}
+}
+
+// TestHealthState_Silence 测试：串口停止产生数据超过静默超时转为error，再次收到数据恢复online
+func TestHealthState_Silence(t *testing.T) {
+	port := &fakePort{pending: []byte{0xAA}}
+	r := newTestReader(port, make(chan models.Frame, 10))
+	clock := time.Now()
+	r.now = func() time.Time { return clock }
+	r.silenceTimeout = 30 * time.Second
+
+	if _, err := r.readData(); err != nil {
+		t.Fatalf("读数据失败：%v", err)
+	}
+	if s := r.HealthState(); s != "online" {
+		t.Fatalf("收到数据后应为online，实际%s", s)
+	}
+
+	clock = clock.Add(31 * time.Second) // 设备停止发送
+	if _, err := r.readData(); err != nil {
+		t.Fatalf("读数据失败：%v", err)
+	}
+	r.handleIdle()
+	if s := r.HealthState(); s != "error" || !r.silent {
+		t.Fatalf("静默超时应为error，实际%s", s)
+	}
+
+	port.mu.Lock()
+	port.pending = append(port.pending, 0x55)
+	port.mu.Unlock()
+	if _, err := r.readData(); err != nil {
+		t.Fatalf("读数据失败：%v", err)
+	}
+	if s := r.HealthState(); s != "online" || r.silent {
+		t.Fatalf("恢复收到数据后应为online，实际%s", s)
+	}
+}
+
+// timeoutPort 模拟以错误形式返回读超时的端口（部分驱动/透传连接），每次Read均超时无数据
+type timeoutPort struct {
+	fakePort
+	reads atomic.Int32
+}
+
+func (p *timeoutPort) Read([]byte) (int, error) {
+	p.reads.Add(1)
+	return 0, fmt.Errorf("read /dev/ttyUSB0: %w", os.ErrDeadlineExceeded)
+}
+
+// TestStart_ReadTimeoutKeepsPortOpen 测试：读超时（0字节+超时错误）不视为断开，端口保持打开且不触发状态变化
+func TestStart_ReadTimeoutKeepsPortOpen(t *testing.T) {
+	port := &timeoutPort{}
+	r := newTestReader(&port.fakePort, make(chan models.Frame, 10))
+	r.port = port
+	var changes atomic.Int32
+	r.OnStateChange(func(old, new, reason string) { changes.Add(1) })
+
+	r.Start()
+	deadline := time.Now().Add(2 * time.Second)
+	for port.reads.Load() < 5 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := port.reads.Load(); n < 5 {
+		t.Fatalf("读超时后读协程未继续读取，读取次数%d", n)
+	}
+	if !r.portOpened() || !r.IsConnected() {
+		t.Fatalf("读超时不应关闭端口或标记断开")
+	}
+	if n := changes.Load(); n != 0 {
+		t.Fatalf("读超时不应触发状态变化，实际触发%d次", n)
+	}
+	r.Close()
+}
+
+// TestHandleData_StalledConsumerDoesNotBlockReader 测试：消费端阻塞时发送在锁外等待，HealthState/Dropped不受影响，Close可正常结束
+func TestHandleData_StalledConsumerDoesNotBlockReader(t *testing.T) {
+	frameChan := make(chan models.Frame) // 无缓冲且无人接收，模拟消费端阻塞
+	r := newTestReader(&fakePort{}, frameChan)
+
+	frame, _ := hex.DecodeString("AA052001000000000000001010004655")
+	sent := make(chan struct{})
+	go func() {
+		r.handleData(frame)
+		close(sent)
+	}()
+	time.Sleep(20 * time.Millisecond) // 等待读协程阻塞在发送上
+
+	done := make(chan struct{})
+	go func() {
+		_ = r.HealthState()
+		_ = r.Dropped()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("消费端阻塞时状态查询被阻塞")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		r.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("消费端阻塞时Close未结束")
+	}
+	<-sent
+}
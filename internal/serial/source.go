@@ -0,0 +1,30 @@
+package serial
+
+import (
+	"time"
+
+	"opm-mqtt-gateway/internal/config"
+	"opm-mqtt-gateway/internal/models"
+)
+
+// Source 帧数据源（串口阅读器/文件回放）：向frameChan输出完整帧，主流程只依赖该接口
+type Source interface {
+	Start()
+	Close()
+	IsConnected() bool
+	HealthState() string // online/offline/error（error为在线但设备异常，如串口静默超时）
+	OnStateChange(fn models.StateChangeFunc)
+}
+
+// NewSource 按全局配置新建帧数据源：配置serial.replay_file时回放文件（无硬件联调/CI），否则打开串口
+func NewSource(frameChan chan models.Frame) (Source, error) {
+	return NewSourceFor(config.GlobalConfig, frameChan)
+}
+
+// NewSourceFor 按指定设备配置新建帧数据源（多设备模式每台设备一份配置）
+func NewSourceFor(cfg *config.Config, frameChan chan models.Frame) (Source, error) {
+	if cfg.Serial.ReplayFile != "" {
+		return NewFileReaderFor(cfg, cfg.Serial.ReplayFile, time.Duration(cfg.Serial.ReplayIntervalMs)*time.Millisecond, frameChan)
+	}
+	return NewReaderFor(cfg, frameChan)
+}
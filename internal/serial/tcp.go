@@ -0,0 +1,70 @@
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+const (
+	tcpScheme      = "tcp://"        // serial.port以该前缀开头时经串口服务器（如Moxa NPort）TCP透传连接
+	tcpDialTimeout = 5 * time.Second // TCP连接超时
+)
+
+// isTCPPort 串口号是否为TCP透传地址（tcp://host:port）
+func isTCPPort(name string) bool {
+	return strings.HasPrefix(name, tcpScheme)
+}
+
+// tcpPort TCP透传串口：以net.Conn实现serial.Port，读超时语义与本地串口一致（超时返回0字节而非错误）
+// 串口参数（波特率/校验位）由串口服务器侧配置，此处相关方法均为空操作
+type tcpPort struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+// dialTCP 连接TCP透传串口（openFunc实现，mode由串口服务器侧配置，忽略）
+func dialTCP(name string, _ *serial.Mode) (serial.Port, error) {
+	addr := strings.TrimPrefix(name, tcpScheme)
+	conn, err := net.DialTimeout("tcp", addr, tcpDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("连接串口服务器%s失败：%w", addr, err)
+	}
+	return &tcpPort{conn: conn}, nil
+}
+
+func (t *tcpPort) Read(p []byte) (int, error) {
+	if t.timeout > 0 {
+		if err := t.conn.SetReadDeadline(time.Now().Add(t.timeout)); err != nil {
+			return 0, err
+		}
+	}
+	n, err := t.conn.Read(p)
+	if isTimeoutErr(err) {
+		return n, nil // 读超时无数据，与本地串口一致
+	}
+	return n, err // 对端关闭（EOF）等错误交由读协程标记断开并重连
+}
+
+func (t *tcpPort) SetReadTimeout(timeout time.Duration) error {
+	t.timeout = timeout
+	return nil
+}
+
+func (t *tcpPort) Write(p []byte) (int, error) { return t.conn.Write(p) }
+func (t *tcpPort) Close() error                { return t.conn.Close() }
+
+func (t *tcpPort) SetMode(*serial.Mode) error { return nil }
+func (t *tcpPort) Drain() error               { return nil }
+func (t *tcpPort) ResetInputBuffer() error    { return nil }
+func (t *tcpPort) ResetOutputBuffer() error   { return nil }
+func (t *tcpPort) SetDTR(bool) error          { return nil }
+func (t *tcpPort) SetRTS(bool) error          { return nil }
+func (t *tcpPort) Break(time.Duration) error  { return nil }
+func (t *tcpPort) GetModemStatusBits() (*serial.ModemStatusBits, error) {
+	return nil, errors.New("TCP透传串口不支持读取调制解调器状态")
+}
@@ -0,0 +1,57 @@
+package serial
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"opm-mqtt-gateway/internal/models"
+)
+
+// TestTCPPort_ReadAndReconnect 测试：经本地TCP监听器接收帧，对端断开后读失败，重连后继续接收
+func TestTCPPort_ReadAndReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败：%v", err)
+	}
+	defer ln.Close()
+	frame, _ := hex.DecodeString("AA052001000000000000001010004655")
+	conns := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write(frame)
+			conns <- conn
+		}
+	}()
+
+	frameChan := make(chan models.Frame, 10)
+	r := newTestReader(nil, frameChan)
+	r.port = nil
+	r.portName = tcpScheme + ln.Addr().String()
+	r.openPort = dialTCP
+
+	for round := 1; round <= 2; round++ {
+		if err := r.openWithRetry(); err != nil {
+			t.Fatalf("第%d次连接失败：%v", round, err)
+		}
+		data, err := r.readData()
+		if err != nil {
+			t.Fatalf("第%d次读取失败：%v", round, err)
+		}
+		r.handleData(data)
+		if len(frameChan) != round {
+			t.Fatalf("第%d次连接后通道帧数错误：%d", round, len(frameChan))
+		}
+
+		// 对端断开：读返回错误，由读协程标记断开并重连
+		(<-conns).Close()
+		if _, err := r.readData(); err == nil {
+			t.Fatalf("对端断开后读取应返回错误")
+		}
+		_ = r.port.Close()
+	}
+}
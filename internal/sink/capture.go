@@ -0,0 +1,84 @@
+package sink
+
+import (
+	"encoding/hex"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// captureQueueLen 抓包写入队列长度（写文件跟不上时丢弃并计数，不阻塞串口读协程）
+const captureQueueLen = 256
+
+// captureChunk 一次串口读取的原始字节及接收时间
+type captureChunk struct {
+	at   time.Time
+	data []byte
+}
+
+// Capture 串口原始字节抓包文件（现场反馈"数据不对"时还原设备实际发送的字节）：
+// 每次读取一行"接收时间 16进制"，经通道由写协程异步落盘，按大小滚动
+type Capture struct {
+	out     *rotatingFile
+	mu      sync.RWMutex // 保护closed与通道关闭
+	closed  bool
+	ch      chan captureChunk
+	done    chan struct{}
+	dropped atomic.Uint64 // 队列满丢弃的读取块数
+}
+
+// NewCapture 新建抓包文件并启动写协程
+func NewCapture(path string, maxBytes int64, maxBackups int) (*Capture, error) {
+	out, err := openRotatingFile("抓包", path, maxBytes, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	c := &Capture{out: out, ch: make(chan captureChunk, captureQueueLen), done: make(chan struct{})}
+	go c.run()
+	return c, nil
+}
+
+// Write 提交一次读取的原始字节（复制后入队，队列满或已关闭时丢弃，不阻塞）
+func (c *Capture) Write(data []byte) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.ch <- captureChunk{at: time.Now(), data: append([]byte(nil), data...)}:
+	default:
+		c.dropped.Add(1)
+	}
+}
+
+// Dropped 队列满丢弃的读取块数
+func (c *Capture) Dropped() uint64 {
+	return c.dropped.Load()
+}
+
+// Close 停止接收，等待队列写完后关闭文件
+func (c *Capture) Close() error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.ch)
+	}
+	c.mu.Unlock()
+	<-c.done
+	return c.out.Close()
+}
+
+// run 写协程：逐块格式化写入文件
+func (c *Capture) run() {
+	defer close(c.done)
+	for chunk := range c.ch {
+		line := chunk.at.UTC().Format("2006-01-02T15:04:05.000Z07:00") + " " +
+			strings.ToUpper(hex.EncodeToString(chunk.data)) + "\n"
+		if err := c.out.Write([]byte(line)); err != nil {
+			log.Printf("[WARN] [sink] 写入抓包文件失败：%v", err)
+		}
+	}
+}
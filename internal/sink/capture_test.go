@@ -0,0 +1,46 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCapture_WritesChunks 测试：每次读取一行"时间 16进制"，关闭时队列全部落盘且顺序不变
+func TestCapture_WritesChunks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture", "serial.log")
+	c, err := NewCapture(path, 1<<20, 1)
+	if err != nil {
+		t.Fatalf("新建抓包文件失败：%v", err)
+	}
+	chunks := []string{"AA0520010000", "00000000001010004655", "AA03000100000000000000001010002455"}
+	for _, h := range chunks {
+		b, _ := hex.DecodeString(h)
+		c.Write(b)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("关闭抓包文件失败：%v", err)
+	}
+	c.Write([]byte{0xAA}) // 关闭后写入应被忽略
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("打开抓包文件失败：%v", err)
+	}
+	defer f.Close()
+	var got []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			t.Fatalf("抓包行格式错误：%q", sc.Text())
+		}
+		got = append(got, fields[1])
+	}
+	if strings.Join(got, ",") != strings.Join(chunks, ",") {
+		t.Fatalf("抓包内容错误，预期%v，实际%v", chunks, got)
+	}
+}
@@ -0,0 +1,53 @@
+package sink
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuarantineRecord 隔离记录（每行一条JSON，便于离线分析）
+type QuarantineRecord struct {
+	Time   string `json:"time"`    // 接收时间（RFC3339，UTC）
+	Kind   string `json:"kind"`    // 失败分类：checksum/frame_header等
+	Error  string `json:"error"`   // 原始错误信息
+	RawHex string `json:"raw_hex"` // 原始帧16进制
+}
+
+// Quarantine 解析失败帧隔离文件（按大小滚动，现场失败帧沉淀为可分析的样本）
+type Quarantine struct {
+	out *rotatingFile
+}
+
+// NewQuarantine 新建隔离文件（目录不存在则自动创建，追加模式保留历史）
+func NewQuarantine(path string, maxBytes int64, maxBackups int) (*Quarantine, error) {
+	out, err := openRotatingFile("隔离", path, maxBytes, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	return &Quarantine{out: out}, nil
+}
+
+// Write 写入一条失败帧记录（超过大小上限先滚动）
+func (q *Quarantine) Write(frame []byte, kind string, cause error) error {
+	rec := QuarantineRecord{
+		Time:   time.Now().UTC().Format(time.RFC3339),
+		Kind:   kind,
+		RawHex: strings.ToUpper(hex.EncodeToString(frame)),
+	}
+	if cause != nil {
+		rec.Error = cause.Error()
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("序列化隔离记录失败：%w", err)
+	}
+	return q.out.Write(append(line, '\n'))
+}
+
+// Close 关闭隔离文件
+func (q *Quarantine) Close() error {
+	return q.out.Close()
+}
@@ -0,0 +1,124 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"opm-mqtt-gateway/internal/config"
+	"opm-mqtt-gateway/internal/parser"
+)
+
+// init 模拟全局配置初始化（单元测试无需加载配置文件，直接模拟硬件参数）
+func init() {
+	config.GlobalConfig = &config.Config{
+		Device: config.DeviceConfig{
+			DeviceID: "SN1234567890", // 测试设备SN
+			Model:    "OPM-1560B",
+		},
+		Parser: config.ParserConfig{
+			FrameStart:  "AA",
+			FrameEnd:    "55",
+			CheckType:   "sum",
+			FrameMinLen: 16,
+		},
+	}
+}
+
+// readRecords 读取隔离文件全部记录
+func readRecords(t *testing.T, path string) []QuarantineRecord {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("打开隔离文件失败：%v", err)
+	}
+	defer f.Close()
+
+	var recs []QuarantineRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec QuarantineRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("隔离记录非法JSON：%v，行：%s", err, sc.Text())
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+// TestQuarantine_BadFramesClassified 测试：解析失败帧写入隔离文件，并按失败原因分类
+func TestQuarantine_BadFramesClassified(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quarantine", "bad_frames.log")
+	q, err := NewQuarantine(path, 1<<20, 3)
+	if err != nil {
+		t.Fatalf("新建隔离文件失败：%v", err)
+	}
+	defer q.Close()
+
+	cases := []struct {
+		frameHex string
+		kind     string
+	}{
+		{"AA0520010055", parser.ErrKindFrameLength},                       // 帧长度不足
+		{"BB05200100000000000000001010004655", parser.ErrKindFrameHeader}, // 帧头非AA
+		{"AA05200100000000000000001010004600", parser.ErrKindFrameEnd},    // 帧尾非55
+		{"AA05200100000000000000001010009955", parser.ErrKindChecksum},    // 和校验错误
+	}
+
+	p := parser.NewParser()
+	for _, c := range cases {
+		frame, _ := hex.DecodeString(c.frameHex)
+		_, perr := p.Parse(frame)
+		if perr == nil {
+			t.Fatalf("异常帧%s未返回解析错误", c.frameHex)
+		}
+		if err := q.Write(frame, parser.ErrorKind(perr), perr); err != nil {
+			t.Fatalf("写入隔离文件失败：%v", err)
+		}
+	}
+
+	recs := readRecords(t, path)
+	if len(recs) != len(cases) {
+		t.Fatalf("隔离记录数错误，预期%d，实际%d", len(cases), len(recs))
+	}
+	for i, c := range cases {
+		if recs[i].Kind != c.kind {
+			t.Errorf("第%d条分类错误，预期%s，实际%s（%s）", i+1, c.kind, recs[i].Kind, recs[i].Error)
+		}
+		if recs[i].RawHex != c.frameHex {
+			t.Errorf("第%d条原始帧错误，预期%s，实际%s", i+1, c.frameHex, recs[i].RawHex)
+		}
+	}
+}
+
+// TestQuarantine_Rotate 测试：超过大小上限后滚动，保留指定数量历史文件
+func TestQuarantine_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad_frames.log")
+	q, err := NewQuarantine(path, 200, 2)
+	if err != nil {
+		t.Fatalf("新建隔离文件失败：%v", err)
+	}
+	defer q.Close()
+
+	frame, _ := hex.DecodeString("AA05200100000000000000001010009955")
+	for i := 0; i < 10; i++ {
+		if err := q.Write(frame, parser.ErrKindChecksum, nil); err != nil {
+			t.Fatalf("写入隔离文件失败：%v", err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("滚动文件缺失：%v", err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("文件%s超过大小上限：%d", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("超出保留数量的历史文件未清理：%v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package sink
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// rotatingFile 按大小滚动的追加写文件（隔离文件/原始抓包文件共用）
+type rotatingFile struct {
+	mu         sync.Mutex
+	name       string   // 用途名（错误信息用，如"隔离"）
+	path       string   // 文件路径
+	maxBytes   int64    // 单个文件最大字节数
+	maxBackups int      // 滚动保留的历史文件数
+	file       *os.File // 当前文件句柄
+	size       int64    // 当前文件大小
+}
+
+// openRotatingFile 打开滚动文件（目录不存在则自动创建，追加模式保留历史）
+func openRotatingFile(name, path string, maxBytes int64, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建%s目录失败：%w", name, err)
+	}
+	f := &rotatingFile{name: name, path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write 写入一行（超过大小上限先滚动）
+func (f *rotatingFile) Write(line []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return fmt.Errorf("%s文件已关闭：%s", f.name, f.path)
+	}
+	if f.maxBytes > 0 && f.size+int64(len(line)) > f.maxBytes && f.size > 0 {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("写入%s文件失败：%w", f.name, err)
+	}
+	return nil
+}
+
+// Close 关闭文件
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// open 打开（或创建）当前文件并记录已有大小
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开%s文件失败：%w", f.name, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("读取%s文件信息失败：%w", f.name, err)
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// rotate 滚动：path.N-1→path.N … path→path.1，超出保留数的最旧文件被覆盖
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("关闭%s文件失败：%w", f.name, err)
+	}
+	f.file = nil
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	if f.maxBackups > 0 {
+		if err := os.Rename(f.path, f.path+".1"); err != nil {
+			return fmt.Errorf("滚动%s文件失败：%w", f.name, err)
+		}
+	} else if err := os.Truncate(f.path, 0); err != nil {
+		return fmt.Errorf("清空%s文件失败：%w", f.name, err)
+	}
+	return f.open()
+}